@@ -0,0 +1,373 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Hak akses file milik user lain. Pemilik selalu punya hak penuh; user lain butuh entri acl
+// untuk dirinya atau untuk grup tempat dia menjadi anggota. Hak write sudah termasuk read.
+// Hak atas folder berlaku untuk semua file dan subfolder di dalamnya (lihat folders.go).
+// File milik user lain dirujuk lewat parameter ?owner= di /download, /delete, /files/move dll.
+const (
+	PermRead  = "read"
+	PermWrite = "write"
+
+	GranteeUser  = "user"
+	GranteeGroup = "group"
+
+	ResourceFile   = "file"
+	ResourceFolder = "folder"
+)
+
+var (
+	errInvalidGrant  = errors.New("hak akses tidak valid")
+	errGrantNotFound = errors.New("hak akses tidak ditemukan")
+)
+
+type Grant struct {
+	ID          int64      `json:"id"`
+	File        string     `json:"file,omitempty"`
+	Folder      string     `json:"folder,omitempty"`
+	GranteeType string     `json:"grantee_type"` // user/group
+	Grantee     string     `json:"grantee"`
+	Permission  string     `json:"permission"` // read/write
+	CreatedAt   time.Time  `json:"created_at"`
+	SuspendedAt *time.Time `json:"suspended_at,omitempty"` // terisi selama filenya di tempat sampah
+}
+
+// SharedFile: file milik user lain yang bisa diakses user yang login
+type SharedFile struct {
+	Owner      string    `json:"owner"`
+	Filename   string    `json:"filename"`
+	Version    int64     `json:"version"`
+	Size       int64     `json:"size"`
+	Status     string    `json:"status"`
+	UploadedAt time.Time `json:"uploaded_at"`
+	Permission string    `json:"permission"`
+}
+
+// granteeMatch: kondisi SQL entri acl yang berlaku untuk satu user (argumen: username dua kali).
+// Entri yang dibekukan karena filenya di tempat sampah tidak berlaku.
+const granteeMatch = `(acl.suspended_at IS NULL AND ((acl.grantee_type = 'user' AND acl.grantee = ?)
+	OR (acl.grantee_type = 'group' AND acl.grantee IN (SELECT group_name FROM group_members WHERE username = ?))))`
+
+// resourceMatch: entri acl untuk resource itu sendiri atau salah satu folder induknya
+// (argumen: resource_type, path, path)
+const resourceMatch = `((acl.resource_type = ? AND acl.resource = ?)
+	OR (acl.resource_type = 'folder' AND substr(?, 1, length(acl.resource) + 1) = acl.resource || '/'))`
+
+// fileGrantMatch: entri acl yang mencakup baris uploads u, langsung atau lewat folder induknya
+const fileGrantMatch = `((acl.resource_type = 'file' AND acl.resource = u.filename)
+	OR (acl.resource_type = 'folder' AND substr(u.filename, 1, length(acl.resource) + 1) = acl.resource || '/'))`
+
+// permissionRank: 2 = write, 1 = read, supaya MAX() memilih hak tertinggi dari beberapa entri
+const permissionRank = "MAX(CASE acl.permission WHEN 'write' THEN 2 ELSE 1 END)"
+
+func rankPermission(rank int) string {
+	switch rank {
+	case 2:
+		return PermWrite
+	case 1:
+		return PermRead
+	}
+	return ""
+}
+
+// filePermission: hak username atas file owner/filename; "" kalau tidak punya akses
+func filePermission(username, owner, filename string) (string, error) {
+	return pathPermission(username, owner, ResourceFile, filename)
+}
+
+// folderPermission: hak username atas folder owner/path (root hanya untuk pemiliknya)
+func folderPermission(username, owner, path string) (string, error) {
+	return pathPermission(username, owner, ResourceFolder, path)
+}
+
+func pathPermission(username, owner, resourceType, path string) (string, error) {
+	if username == owner {
+		return PermWrite, nil
+	}
+	var rank int
+	err := DB.QueryRow("SELECT COALESCE("+permissionRank+", 0) FROM acl WHERE owner = ? AND "+resourceMatch+" AND "+granteeMatch,
+		owner, resourceType, path, path, username, username).Scan(&rank)
+	return rankPermission(rank), err
+}
+
+// permits: hak have mencukupi kebutuhan need
+func permits(have, need string) bool {
+	return have == PermWrite || (have == PermRead && need == PermRead)
+}
+
+// fileOwnerParam: pemilik file yang dirujuk request (?owner=), default user yang login
+func fileOwnerParam(r *http.Request, p *Principal) string {
+	if owner := r.URL.Query().Get("owner"); owner != "" {
+		return owner
+	}
+	return p.Username
+}
+
+// -------------------------
+// Akses tabel acl
+// -------------------------
+func grantAccess(owner, resourceType, resource, granteeType, grantee, permission string) (*Grant, error) {
+	if permission != PermRead && permission != PermWrite {
+		return nil, fmt.Errorf("%w: permission harus read atau write", errInvalidGrant)
+	}
+	switch granteeType {
+	case GranteeUser:
+		if grantee == owner {
+			return nil, fmt.Errorf("%w: pemilik sudah punya akses penuh", errInvalidGrant)
+		}
+		if _, err := getUser(grantee); err != nil {
+			return nil, err
+		}
+	case GranteeGroup:
+		if ok, err := groupExists(grantee); err != nil {
+			return nil, err
+		} else if !ok {
+			return nil, errGroupNotFound
+		}
+	default:
+		return nil, fmt.Errorf("%w: grantee_type harus user atau group", errInvalidGrant)
+	}
+	switch resourceType {
+	case ResourceFile:
+		if _, err := getUpload(owner, resource, 0); err != nil {
+			return nil, err
+		}
+	case ResourceFolder:
+		if resource == "" {
+			return nil, fmt.Errorf("%w: folder root tidak bisa dibagikan", errInvalidGrant)
+		}
+		if _, err := getFolder(DB, owner, resource); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errInvalidGrant
+	}
+
+	_, err := DB.Exec(`INSERT INTO acl (owner, resource_type, resource, grantee_type, grantee, permission, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(owner, resource_type, resource, grantee_type, grantee) DO UPDATE SET permission = excluded.permission, suspended_at = NULL`,
+		owner, resourceType, resource, granteeType, grantee, permission, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return scanGrant(DB.QueryRow("SELECT "+grantColumns+" FROM acl WHERE owner = ? AND resource_type = ? AND resource = ? AND grantee_type = ? AND grantee = ?",
+		owner, resourceType, resource, granteeType, grantee))
+}
+
+const grantColumns = "id, resource_type, resource, grantee_type, grantee, permission, created_at, suspended_at"
+
+func scanGrant(row interface{ Scan(...interface{}) error }) (*Grant, error) {
+	var g Grant
+	var resourceType, resource string
+	if err := row.Scan(&g.ID, &resourceType, &resource, &g.GranteeType, &g.Grantee, &g.Permission, &g.CreatedAt, &g.SuspendedAt); err != nil {
+		return nil, err
+	}
+	if resourceType == ResourceFolder {
+		g.Folder = resource
+	} else {
+		g.File = resource
+	}
+	return &g, nil
+}
+
+// listGrants: hak akses yang diberikan owner; resource "" = semua
+func listGrants(owner, resourceType, resource string) ([]Grant, error) {
+	query := "SELECT " + grantColumns + " FROM acl WHERE owner = ?"
+	args := []interface{}{owner}
+	if resource != "" {
+		query += " AND resource_type = ? AND resource = ?"
+		args = append(args, resourceType, resource)
+	}
+	rows, err := DB.Query(query+" ORDER BY resource_type, resource, id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	grants := []Grant{}
+	for rows.Next() {
+		g, err := scanGrant(rows)
+		if err != nil {
+			return nil, err
+		}
+		grants = append(grants, *g)
+	}
+	return grants, rows.Err()
+}
+
+func revokeGrant(owner string, id int64) error {
+	res, err := DB.Exec("DELETE FROM acl WHERE id = ? AND owner = ?", id, owner)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errGrantNotFound
+	}
+	return nil
+}
+
+// deleteOrphanGrants menghapus hak akses ke file yang sudah dihapus permanen (termasuk yang beku
+// dan item tempat sampahnya sudah dikosongkan), supaya file baru dengan nama yang sama tidak ikut
+// terbagi (grant folder dihapus di deleteFolder)
+func deleteOrphanGrants() {
+	_, err := DB.Exec(`DELETE FROM acl WHERE resource_type = ?
+		AND (NOT EXISTS (SELECT 1 FROM uploads WHERE uploads.username = acl.owner AND uploads.filename = acl.resource)
+			OR (suspended_at IS NOT NULL AND NOT EXISTS (SELECT 1 FROM uploads WHERE uploads.username = acl.owner
+				AND uploads.filename = acl.resource AND uploads.deleted_at = acl.suspended_at)))`, ResourceFile)
+	if err != nil {
+		log.Printf("deleteOrphanGrants: %v", err)
+	}
+}
+
+// sharedWithMe: versi aktif semua file user lain yang bisa diakses username,
+// baik dibagikan langsung maupun lewat folder induknya
+func sharedWithMe(username string) ([]SharedFile, error) {
+	rows, err := DB.Query(`SELECT u.username, u.filename, u.version, COALESCE(u.size, 0), u.status, u.uploaded_at, `+permissionRank+`
+		FROM acl JOIN uploads u ON u.username = acl.owner AND u.deleted_at IS NULL AND `+fileGrantMatch+`
+		WHERE `+granteeMatch+`
+		AND u.version = (SELECT MAX(version) FROM uploads v WHERE v.username = u.username AND v.filename = u.filename AND v.deleted_at IS NULL)
+		GROUP BY u.id ORDER BY u.uploaded_at DESC`, username, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := []SharedFile{}
+	for rows.Next() {
+		var f SharedFile
+		var rank int
+		if err := rows.Scan(&f.Owner, &f.Filename, &f.Version, &f.Size, &f.Status, &f.UploadedAt, &rank); err != nil {
+			return nil, err
+		}
+		f.Permission = rankPermission(rank)
+		files = append(files, f)
+	}
+	return files, rows.Err()
+}
+
+// -------------------------
+// Kelola hak akses (pemilik file)
+// -------------------------
+
+// GET [?file= | ?folder=]: daftar hak akses, POST {"file" | "folder", "grantee_type", "grantee", "permission"}:
+// beri/ubah hak, DELETE ?id=: cabut hak
+func ACLHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		resourceType, resource := ResourceFile, r.URL.Query().Get("file")
+		if folder := r.URL.Query().Get("folder"); folder != "" {
+			resourceType, resource = ResourceFolder, folder
+		}
+		grants, err := listGrants(p.Username, resourceType, resource)
+		if err != nil {
+			http.Error(w, "Gagal ambil daftar hak akses", http.StatusInternalServerError)
+			log.Printf("ACLHandler: list error: %v", err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(grants)
+
+	case http.MethodPost:
+		var req struct {
+			File        string `json:"file"`
+			Folder      string `json:"folder"`
+			GranteeType string `json:"grantee_type"`
+			Grantee     string `json:"grantee"`
+			Permission  string `json:"permission"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || (req.File == "") == (req.Folder == "") || req.Grantee == "" {
+			http.Error(w, "file atau folder (salah satu) dan grantee diperlukan", http.StatusBadRequest)
+			return
+		}
+		if req.GranteeType == "" {
+			req.GranteeType = GranteeUser
+		}
+		resourceType, resource := ResourceFile, req.File
+		if req.Folder != "" {
+			resourceType, resource = ResourceFolder, req.Folder
+		}
+		resource, err := cleanPath(resource)
+		if err != nil {
+			http.Error(w, "Nama atau path tidak valid", http.StatusBadRequest)
+			return
+		}
+		g, err := grantAccess(p.Username, resourceType, resource, req.GranteeType, req.Grantee, req.Permission)
+		switch {
+		case errors.Is(err, errInvalidGrant):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case errors.Is(err, errFileNotFound), errors.Is(err, errFolderNotFound), errors.Is(err, errUserNotFound), errors.Is(err, errGroupNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case err != nil:
+			http.Error(w, "Gagal memberi hak akses", http.StatusInternalServerError)
+			log.Printf("ACLHandler: grant error: %v", err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(g)
+		log.Printf("ACLHandler: user=%s memberi %s %s:%s ke %s %s", p.Username, g.Permission, g.GranteeType, g.Grantee, resourceType, resource)
+
+	case http.MethodDelete:
+		id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "id tidak valid", http.StatusBadRequest)
+			return
+		}
+		if err := revokeGrant(p.Username, id); errors.Is(err, errGrantNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Gagal mencabut hak akses", http.StatusInternalServerError)
+			log.Printf("ACLHandler: revoke %d error: %v", id, err)
+			return
+		}
+		fmt.Fprintf(w, "Hak akses %d dicabut", id)
+		log.Printf("ACLHandler: user=%s mencabut hak akses id=%d", p.Username, id)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// GET /shared-with-me: file milik user lain yang dibagikan ke user ini (langsung atau lewat grup)
+func SharedWithMeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	p, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+	files, err := sharedWithMe(p.Username)
+	if err != nil {
+		http.Error(w, "Gagal ambil data", http.StatusInternalServerError)
+		log.Printf("SharedWithMeHandler: DB error: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(files)
+}
+
+// writeAccessDenied: tanpa hak sama sekali file dianggap tidak ada; hak read saja tidak cukup untuk mengubah
+func writeAccessDenied(w http.ResponseWriter, perm string) {
+	if perm == "" {
+		http.Error(w, "File tidak ditemukan", http.StatusNotFound)
+		return
+	}
+	http.Error(w, "Tidak punya izin mengubah file ini", http.StatusForbidden)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// setupACLFixture: file dan folder milik alice, bob dapat read atas dua file, grup tim (carol)
+// dapat write atas folder docs, dave tidak punya hak apa pun
+func setupACLFixture(t *testing.T) {
+	t.Helper()
+	setupTestEnv(t)
+	for _, name := range []string{"alice", "bob", "carol", "dave"} {
+		if _, err := createUser(name, "password-"+name, RoleUser); err != nil {
+			t.Fatalf("createUser %s: %v", name, err)
+		}
+	}
+	for _, path := range []string{"docs", "docs/sub", "docs2"} {
+		if _, err := createFolder("alice", path); err != nil {
+			t.Fatalf("createFolder %s: %v", path, err)
+		}
+	}
+	for _, name := range []string{"laporan.pdf", "docs/a.pdf", "docs/sub/b.pdf", "docs2/c.pdf"} {
+		uploadTestFile(t, "alice", name, "isi "+name)
+	}
+	if err := createGroup("tim"); err != nil {
+		t.Fatalf("createGroup: %v", err)
+	}
+	if err := addGroupMember("tim", "carol"); err != nil {
+		t.Fatalf("addGroupMember: %v", err)
+	}
+	grants := []struct{ resourceType, resource, granteeType, grantee, permission string }{
+		{ResourceFile, "laporan.pdf", GranteeUser, "bob", PermRead},
+		{ResourceFile, "docs/a.pdf", GranteeUser, "bob", PermRead},
+		{ResourceFolder, "docs", GranteeGroup, "tim", PermWrite},
+		// Hak tertinggi yang berlaku: read langsung + write lewat grup = write
+		{ResourceFile, "docs/a.pdf", GranteeUser, "carol", PermRead},
+	}
+	for _, g := range grants {
+		if _, err := grantAccess("alice", g.resourceType, g.resource, g.granteeType, g.grantee, g.permission); err != nil {
+			t.Fatalf("grantAccess %+v: %v", g, err)
+		}
+	}
+}
+
+func TestFilePermission(t *testing.T) {
+	setupACLFixture(t)
+	tests := []struct {
+		username, filename, want string
+	}{
+		{"alice", "laporan.pdf", PermWrite}, // pemilik
+		{"bob", "laporan.pdf", PermRead},
+		{"bob", "docs/a.pdf", PermRead},
+		{"bob", "docs/sub/b.pdf", ""},
+		{"carol", "laporan.pdf", ""},
+		{"carol", "docs/a.pdf", PermWrite},
+		{"carol", "docs/sub/b.pdf", PermWrite}, // lewat folder induk
+		{"carol", "docs2/c.pdf", ""},           // awalan nama sama, folder lain
+		{"dave", "laporan.pdf", ""},
+		{"dave", "docs/a.pdf", ""},
+	}
+	for _, tc := range tests {
+		got, err := filePermission(tc.username, "alice", tc.filename)
+		if err != nil || got != tc.want {
+			t.Errorf("filePermission(%s, %s) = %q, %v; mau %q", tc.username, tc.filename, got, err, tc.want)
+		}
+	}
+
+	// Keluar dari grup = hak lewat grup hilang
+	if err := removeGroupMember("tim", "carol"); err != nil {
+		t.Fatalf("removeGroupMember: %v", err)
+	}
+	if got, _ := filePermission("carol", "alice", "docs/sub/b.pdf"); got != "" {
+		t.Errorf("setelah keluar grup: %q, mau tidak ada", got)
+	}
+	if got, _ := filePermission("carol", "alice", "docs/a.pdf"); got != PermRead {
+		t.Errorf("setelah keluar grup, grant langsung: %q, mau read", got)
+	}
+}
+
+func TestPermits(t *testing.T) {
+	tests := []struct {
+		have, need string
+		want       bool
+	}{
+		{PermWrite, PermWrite, true},
+		{PermWrite, PermRead, true},
+		{PermRead, PermRead, true},
+		{PermRead, PermWrite, false},
+		{"", PermRead, false},
+		{"", PermWrite, false},
+	}
+	for _, tc := range tests {
+		if got := permits(tc.have, tc.need); got != tc.want {
+			t.Errorf("permits(%q, %q) = %v, mau %v", tc.have, tc.need, got, tc.want)
+		}
+	}
+}
+
+func TestGrantAccessRejectsInvalid(t *testing.T) {
+	setupACLFixture(t)
+	tests := []struct {
+		desc                                                     string
+		resourceType, resource, granteeType, grantee, permission string
+		want                                                     error
+	}{
+		{"permission tidak dikenal", ResourceFile, "laporan.pdf", GranteeUser, "bob", "admin", errInvalidGrant},
+		{"grantee_type tidak dikenal", ResourceFile, "laporan.pdf", "role", "bob", PermRead, errInvalidGrant},
+		{"ke pemilik sendiri", ResourceFile, "laporan.pdf", GranteeUser, "alice", PermRead, errInvalidGrant},
+		{"folder root", ResourceFolder, "", GranteeUser, "bob", PermRead, errInvalidGrant},
+		{"user tidak ada", ResourceFile, "laporan.pdf", GranteeUser, "eve", PermRead, errUserNotFound},
+		{"grup tidak ada", ResourceFile, "laporan.pdf", GranteeGroup, "hantu", PermRead, errGroupNotFound},
+		{"file tidak ada", ResourceFile, "tidak-ada.pdf", GranteeUser, "bob", PermRead, errFileNotFound},
+		{"folder tidak ada", ResourceFolder, "arsip", GranteeUser, "bob", PermRead, errFolderNotFound},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			if _, err := grantAccess("alice", tc.resourceType, tc.resource, tc.granteeType, tc.grantee, tc.permission); !errors.Is(err, tc.want) {
+				t.Errorf("grantAccess = %v, mau %v", err, tc.want)
+			}
+		})
+	}
+}
+
+// Handler memakai hak yang sama: read cukup untuk unduh, hapus butuh write,
+// tanpa hak file dianggap tidak ada
+func TestACLHandlers(t *testing.T) {
+	setupACLFixture(t)
+	request := func(handler http.HandlerFunc, method, username, filename string) int {
+		q := url.Values{"owner": {"alice"}, "file": {filename}}
+		r := httptest.NewRequest(method, "/?"+q.Encode(), nil)
+		r = r.WithContext(withPrincipal(r.Context(), &Principal{Username: username, Roles: []string{RoleUser}}))
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w.Code
+	}
+	tests := []struct {
+		desc           string
+		handler        http.HandlerFunc
+		method         string
+		username, file string
+		want           int
+	}{
+		{"read boleh unduh", DownloadHandler, http.MethodGet, "bob", "laporan.pdf", http.StatusOK},
+		{"tanpa hak tidak bisa unduh", DownloadHandler, http.MethodGet, "dave", "laporan.pdf", http.StatusNotFound},
+		{"read tidak boleh hapus", DeleteHandler, http.MethodDelete, "bob", "laporan.pdf", http.StatusForbidden},
+		{"tanpa hak tidak bisa hapus", DeleteHandler, http.MethodDelete, "dave", "docs/a.pdf", http.StatusNotFound},
+		{"write lewat folder boleh hapus", DeleteHandler, http.MethodDelete, "carol", "docs/sub/b.pdf", http.StatusOK},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			if got := request(tc.handler, tc.method, tc.username, tc.file); got != tc.want {
+				t.Errorf("status %d, mau %d", got, tc.want)
+			}
+		})
+	}
+
+	// Hapus oleh carol masuk ke tempat sampah alice
+	if _, err := getUpload("alice", "docs/sub/b.pdf", 0); !errors.Is(err, errFileNotFound) {
+		t.Errorf("getUpload setelah dihapus carol = %v, mau errFileNotFound", err)
+	}
+	if items, err := listTrash("alice"); err != nil || len(items) != 1 {
+		t.Errorf("listTrash alice = %+v, %v; mau 1 item", items, err)
+	}
+}
@@ -1,23 +1,22 @@
 package main
 
 import (
-	"fmt"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var jwtKey = []byte("rahasia-super-aman")
-
-// hardcoded user buat contoh
-var users = map[string]string{
-	"user1": "pass1",
-}
+var jwtKey []byte // diisi dari config (jwt_secret)
 
 // Struktur klaim
 type Claims struct {
 	Username string `json:"username"`
+	Role     string `json:"role"`
 	jwt.RegisteredClaims
 }
 
@@ -26,59 +25,127 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 	username := r.FormValue("username")
 	password := r.FormValue("password")
 
-	if pass, ok := users[username]; !ok || pass != password {
+	u, err := authenticateUser(username, password)
+	if err != nil {
 		http.Error(w, "Username atau Password Salah!!", http.StatusUnauthorized)
 		return
 	}
-
-	expirationTime := time.Now().Add(1 * time.Hour)
-	claims := &Claims{
-		Username: username,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-		},
+	if u.Disabled {
+		http.Error(w, "Akun dinonaktifkan", http.StatusForbidden)
+		log.Printf("loginHandler: user=%s disabled, login ditolak", u.Username)
+		return
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtKey)
+	pair, err := issueTokenPair(u)
 	if err != nil {
 		http.Error(w, "Gagal Membuat Token", http.StatusInternalServerError)
+		log.Printf("loginHandler: gagal buat token user=%s: %v", u.Username, err)
 		return
 	}
 
-	fmt.Fprintf(w, tokenString)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(pair)
+}
+
+// parseBearerToken membaca header Authorization dan memvalidasi JWT-nya
+func parseBearerToken(r *http.Request) (*Claims, error) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" || len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		return nil, errors.New("header Authorization tidak valid")
+	}
+
+	tokenStr := authHeader[7:] // buang "Bearer "
+
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
+		return jwtKey, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("token tidak sah")
+	}
+	return claims, nil
 }
 
 func requireAuth(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		fmt.Println("Auth Header:", authHeader) // debug
+		claims, err := parseBearerToken(r)
+		if err != nil {
+			log.Printf("requireAuth: token ditolak: %v", err)
+			http.Error(w, "Token expired atau tidak sah", http.StatusUnauthorized)
+			return
+		}
 
-		if authHeader == "" || len(authHeader) < 8 || authHeader[:7] != "Bearer " {
-			http.Error(w, "Token Tidak Valid", http.StatusUnauthorized)
+		// Akun yang dihapus/dinonaktifkan tidak boleh lanjut walau tokennya belum expired
+		u, err := getUser(claims.Username)
+		if err != nil || u.Disabled {
+			log.Printf("requireAuth: user=%s tidak aktif atau tidak ada: %v", claims.Username, err)
+			http.Error(w, "Akun tidak aktif", http.StatusUnauthorized)
 			return
 		}
 
-		tokenStr := authHeader[7:] // buang "Bearer "
+		// Token yang sudah di-logout dicatat jti-nya di revoked_tokens
+		if claims.ID == "" {
+			http.Error(w, "Token expired atau tidak sah", http.StatusUnauthorized)
+			return
+		}
+		if revoked, err := isAccessTokenRevoked(claims.ID); err != nil || revoked {
+			log.Printf("requireAuth: jti=%s dicabut atau gagal dicek: %v", claims.ID, err)
+			http.Error(w, "Token sudah dicabut", http.StatusUnauthorized)
+			return
+		}
 
-		claims := &Claims{}
-		token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-			return jwtKey, nil
-		})
+		// token valid → lanjut, identitas user dibawa lewat context
+		p := &Principal{
+			Username:  u.Username,
+			Roles:     []string{u.Role},
+			TokenID:   claims.ID,
+			ExpiresAt: claims.ExpiresAt.Time,
+		}
+		next.ServeHTTP(w, r.WithContext(withPrincipal(r.Context(), p)))
+	}
+}
 
-		fmt.Println("=== AUTH DEBUG ===")
-		fmt.Println("Authorization Header:", authHeader)
-		fmt.Println("Token String:", tokenStr)
-		fmt.Println("Parse error:", err)
-		fmt.Println("Token valid?:", token.Valid)
+// -------------------------
+// Principal: identitas user yang sudah lolos requireAuth
+// -------------------------
+type Principal struct {
+	Username  string
+	Roles     []string
+	TokenID   string
+	ExpiresAt time.Time
+}
 
-		if err != nil || !token.Valid {
-			fmt.Println("Token parse error:", err) // debug
-			http.Error(w, "Token expired atau tidak sah", http.StatusUnauthorized)
-			return
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
 		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+func withPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFrom mengambil principal yang dipasang requireAuth; ok=false jika handler tidak dibungkus requireAuth
+func PrincipalFrom(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil && p.Username != ""
+}
 
-		// token valid → lanjut
-		next.ServeHTTP(w, r)
+// currentPrincipal dipakai handler: kalau principal tidak ada, langsung balas 401
+func currentPrincipal(w http.ResponseWriter, r *http.Request) (*Principal, bool) {
+	p, ok := PrincipalFrom(r.Context())
+	if !ok {
+		http.Error(w, "Token tidak valid", http.StatusUnauthorized)
+		log.Printf("currentPrincipal: %s %s tanpa principal (lupa requireAuth?)", r.Method, r.URL.Path)
 	}
+	return p, ok
 }
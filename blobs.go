@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Isi file disimpan sekali per SHA-256 di key blobs/<2>/<2>/<sha256>. Baris uploads hanya
+// menunjuk ke blob (kolom blob_sha256); blobs.refcount menghitung jumlah penunjuknya, dan
+// objek blob baru dihapus dari storage saat penunjuk terakhir hilang.
+
+var errFileNotFound = errors.New("file tidak ditemukan")
+
+func blobKey(sum string) string {
+	return "blobs/" + sum[:2] + "/" + sum[2:4] + "/" + sum
+}
+
+// blobLocks menyerialkan tambah/lepas referensi untuk blob yang sama (dibagi per byte
+// pertama hash), supaya blob tidak terhapus di antara "sudah ada" dan refcount bertambah
+var blobLocks [64]sync.Mutex
+
+func lockBlob(sum string) func() {
+	b, _ := strconv.ParseUint(sum[:2], 16, 8)
+	m := &blobLocks[b%uint64(len(blobLocks))]
+	m.Lock()
+	return m.Unlock
+}
+
+func blobExists(sum string) (bool, error) {
+	var n int
+	err := DB.QueryRow("SELECT COUNT(*) FROM blobs WHERE sha256 = ?", sum).Scan(&n)
+	return n > 0, err
+}
+
+// addBlobRef menambah satu referensi ke blob (membuat barisnya kalau belum ada)
+func addBlobRef(tx *sql.Tx, sum string, size int64) error {
+	_, err := tx.Exec(`INSERT INTO blobs (sha256, size, refcount, created_at) VALUES (?, ?, 1, ?)
+		ON CONFLICT(sha256) DO UPDATE SET refcount = refcount + 1`, sum, size, time.Now())
+	return err
+}
+
+// dropBlobRef mengurangi satu referensi; true kalau itu referensi terakhir (baris blob ikut dihapus)
+func dropBlobRef(tx *sql.Tx, sum string) (bool, error) {
+	var refs int
+	err := tx.QueryRow("UPDATE blobs SET refcount = refcount - 1 WHERE sha256 = ? RETURNING refcount", sum).Scan(&refs)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if refs > 0 {
+		return false, nil
+	}
+	_, err = tx.Exec("DELETE FROM blobs WHERE sha256 = ?", sum)
+	return true, err
+}
+
+// commitUpload menyimpan isi berhash sum ke blob store (write hanya dipanggil kalau blob
+// belum ada) lalu mencatatnya sebagai versi terbaru filename milik username (lihat addVersion).
+// Versi lama di luar retensi dihapus setelahnya. Mengembalikan nomor versi.
+func commitUpload(ctx context.Context, username, filename, sum string, size int64, meta FileMeta, write func(key string) error) (int64, error) {
+	version, created, err := putBlobVersion(ctx, username, filename, sum, size, meta, write)
+	if err != nil {
+		return 0, err
+	}
+	if created {
+		notifyScanner()
+		notifyTextIndexer()
+		if _, err := pruneVersions(ctx, username, filename, maxVersions, versionMaxAge); err != nil {
+			log.Printf("commitUpload: gagal hapus versi lama %s milik %s: %v", filename, username, err)
+		}
+	}
+	return version, nil
+}
+
+func putBlobVersion(ctx context.Context, username, filename, sum string, size int64, meta FileMeta, write func(key string) error) (int64, bool, error) {
+	unlock := lockBlob(sum)
+	defer unlock()
+
+	exists, err := blobExists(sum)
+	if err != nil {
+		return 0, false, err
+	}
+	if !exists {
+		if err := write(blobKey(sum)); err != nil {
+			return 0, false, err
+		}
+	}
+
+	version, created, err := recordVersion(username, filename, sum, size, meta)
+	if err != nil {
+		if !exists {
+			if err := store.Delete(ctx, blobKey(sum)); err != nil {
+				log.Printf("commitUpload: gagal hapus blob %s: %v", sum, err)
+			}
+		}
+		return 0, false, err
+	}
+	return version, created, nil
+}
+
+// releaseUploads menghapus permanen baris uploads yang memenuhi kondisi where dan melepas
+// referensi blob-nya. Mengembalikan jumlah baris yang dihapus.
+func releaseUploads(ctx context.Context, where string, args ...interface{}) (int, error) {
+	rows, err := DB.Query("SELECT id, COALESCE(blob_sha256, '') FROM uploads WHERE "+where, args...)
+	if err != nil {
+		return 0, err
+	}
+	type ref struct {
+		id  int64
+		sum string
+	}
+	var refs []ref
+	for rows.Next() {
+		var r ref
+		if err := rows.Scan(&r.id, &r.sum); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		refs = append(refs, r)
+	}
+	rows.Close()
+
+	for i, r := range refs {
+		if err := releaseUpload(ctx, r.id, r.sum); err != nil {
+			return i, err
+		}
+	}
+	if len(refs) > 0 {
+		deleteOrphanGrants()
+		revokeOrphanShares()
+	}
+	return len(refs), nil
+}
+
+func releaseUpload(ctx context.Context, id int64, sum string) error {
+	if sum == "" {
+		// Baris lama yang objeknya sudah hilang sebelum migrasi ke blob store
+		_, err := DB.Exec("DELETE FROM uploads WHERE id = ?", id)
+		return err
+	}
+
+	unlock := lockBlob(sum)
+	defer unlock()
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM uploads WHERE id = ?", id); err != nil {
+		return err
+	}
+	last, err := dropBlobRef(tx, sum)
+	if err != nil {
+		return err
+	}
+	if last {
+		if _, err := tx.Exec("DELETE FROM blob_text WHERE sha256 = ?", sum); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if last {
+		if err := store.Delete(ctx, blobKey(sum)); err != nil {
+			log.Printf("releaseUpload: gagal hapus blob %s: %v", sum, err)
+		}
+	}
+	return nil
+}
+
+// -------------------------
+// Migrasi file lama (key <username>/<filename>) ke blob store
+// -------------------------
+func migrateUploadsToBlobs() {
+	rows, err := DB.Query("SELECT id, COALESCE(username, ''), filename FROM uploads WHERE blob_sha256 IS NULL ORDER BY id")
+	if err != nil {
+		log.Printf("migrateUploadsToBlobs: query: %v", err)
+		return
+	}
+	type legacy struct {
+		id                 int64
+		username, filename string
+	}
+	var todo []legacy
+	for rows.Next() {
+		var l legacy
+		if err := rows.Scan(&l.id, &l.username, &l.filename); err == nil {
+			todo = append(todo, l)
+		}
+	}
+	rows.Close()
+
+	migrated := 0
+	for _, l := range todo {
+		if err := migrateUploadToBlob(context.Background(), l.id, l.username, l.filename); err != nil {
+			log.Printf("migrateUploadsToBlobs: %s milik %q dibiarkan: %v", l.filename, l.username, err)
+			continue
+		}
+		migrated++
+	}
+	if migrated > 0 {
+		log.Printf("migrateUploadsToBlobs: %d file dipindah ke blob store", migrated)
+	}
+}
+
+func migrateUploadToBlob(ctx context.Context, id int64, username, filename string) error {
+	key, err := objectKey(username, filename)
+	if err != nil {
+		return err
+	}
+
+	rc, err := store.Get(ctx, key, 0, -1)
+	if errors.Is(err, errObjectNotFound) {
+		// Baris ganda untuk file yang sama: ikut blob dari baris yang sudah dipindah
+		var sum string
+		var size int64
+		if err := DB.QueryRow("SELECT blob_sha256, size FROM uploads WHERE username = ? AND filename = ? AND blob_sha256 IS NOT NULL LIMIT 1",
+			username, filename).Scan(&sum, &size); err != nil {
+			return errObjectNotFound
+		}
+		unlock := lockBlob(sum)
+		defer unlock()
+		return attachBlob(id, sum, size)
+	}
+	if err != nil {
+		return err
+	}
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, rc)
+	rc.Close()
+	if err != nil {
+		return err
+	}
+	sum := hex.EncodeToString(hasher.Sum(nil))
+
+	unlock := lockBlob(sum)
+	defer unlock()
+	exists, err := blobExists(sum)
+	if err != nil {
+		return err
+	}
+	moved := false
+	if !exists {
+		if mv, ok := store.(objectMover); ok {
+			err = mv.Move(ctx, key, blobKey(sum))
+			moved = err == nil
+		} else {
+			err = copyObject(ctx, key, blobKey(sum), size)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := attachBlob(id, sum, size); err != nil {
+		return err
+	}
+	if !moved {
+		if err := store.Delete(ctx, key); err != nil {
+			log.Printf("migrateUploadToBlob: gagal hapus %s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// attachBlob mengarahkan baris uploads id ke blob sum dan menambah referensinya
+func attachBlob(id int64, sum string, size int64) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("UPDATE uploads SET blob_sha256 = ?, sha256 = ?, size = ?, storage_key = ? WHERE id = ?", sum, sum, size, blobKey(sum), id); err != nil {
+		return err
+	}
+	if err := addBlobRef(tx, sum, size); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func copyObject(ctx context.Context, from, to string, size int64) error {
+	rc, err := store.Get(ctx, from, 0, -1)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return store.Put(ctx, to, rc, size)
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+var errBadChecksum = errors.New("format sha256 harus 64 karakter hex")
+
+// normalizeSHA256 menerima checksum hex dari client (boleh kosong = tidak diverifikasi)
+func normalizeSHA256(s string) (string, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return "", nil
+	}
+	if len(s) != 64 {
+		return "", errBadChecksum
+	}
+	if _, err := hex.DecodeString(s); err != nil {
+		return "", errBadChecksum
+	}
+	return s, nil
+}
@@ -1,28 +1,55 @@
 package main
 
 import (
-	"log"
-	"os"
-	"path/filepath"
 	"time"
 )
 
+// startChunkCleaner menghapus sesi upload (beserta folder chunk-nya) yang tidak
+// disentuh lebih lama dari maxAge
 func startChunkCleaner(interval time.Duration, maxAge time.Duration) {
 	go func() {
 		for {
-			filepath.Walk(chunkTempDir, func(path string, info os.FileInfo, err error) error {
-				if err != nil || info == nil {
-					return nil
-				}
-				// Hanya hapus direktori per-upload; jika info.IsDir() dan bukan root
-				if info.IsDir() && path != chunkTempDir {
-					if time.Since(info.ModTime()) > maxAge {
-						log.Println("Cleaner: menghapus", path)
-						os.RemoveAll(path)
-					}
-				}
-				return nil
-			})
+			purgeStaleUploadSessions(maxAge)
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// startTrashCleaner menghapus permanen file yang sudah di tempat sampah lebih lama dari retention
+func startTrashCleaner(interval time.Duration, retention time.Duration) {
+	go func() {
+		for {
+			purgeTrash(retention)
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// startQuarantineCleaner menghapus file karantina yang lebih tua dari maxAge
+func startQuarantineCleaner(interval time.Duration, maxAge time.Duration) {
+	go func() {
+		for {
+			purgeQuarantine(maxAge)
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// startVersionCleaner menerapkan retensi versi (max_versions, version_max_age) ke semua file
+func startVersionCleaner(interval time.Duration) {
+	go func() {
+		for {
+			pruneAllVersions()
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// startTokenCleaner membersihkan refresh token & daftar jti dicabut yang sudah expired
+func startTokenCleaner(interval time.Duration) {
+	go func() {
+		for {
+			purgeExpiredTokens()
 			time.Sleep(interval)
 		}
 	}()
@@ -0,0 +1,456 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Secret bawaan lama; server menolak jalan kalau masih dipakai
+const insecureDefaultJWTSecret = "rahasia-super-aman"
+
+const minJWTSecretLength = 32
+
+// Duration supaya di file JSON bisa ditulis "30m", "6h", dst.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+type Config struct {
+	ListenAddr   string `json:"listen_addr"`
+	DBPath       string `json:"db_path"`
+	UploadPath   string `json:"upload_path"`
+	ChunkTempDir string `json:"chunk_temp_dir"`
+	// File yang gagal validasi isi disimpan di sini (disk lokal) sampai quarantine_max_age.
+	// Ukurannya dihitung ke kuota pengupload; lewat quarantine_max_per_user file ditolak tanpa disimpan.
+	QuarantineDir        string   `json:"quarantine_dir"`
+	QuarantineMaxAge     Duration `json:"quarantine_max_age"`
+	QuarantineMaxPerUser int64    `json:"quarantine_max_per_user"` // 0 = tanpa batas
+
+	// "local" (default, di upload_path) atau "s3" (API S3-compatible, mis. MinIO)
+	StorageBackend string `json:"storage_backend"`
+	S3Endpoint     string `json:"s3_endpoint"`
+	S3Bucket       string `json:"s3_bucket"`
+	S3Region       string `json:"s3_region"`
+	S3AccessKey    string `json:"s3_access_key"`
+	S3SecretKey    string `json:"s3_secret_key"`
+
+	JWTSecret         string   `json:"jwt_secret"`
+	AccessTokenTTL    Duration `json:"access_token_ttl"`
+	RefreshTokenTTL   Duration `json:"refresh_token_ttl"`
+	AllowRegistration bool     `json:"allow_registration"`
+	// Admin awal dibuat saat startup kalau belum ada user; kosong = user pertama /register jadi admin
+	AdminUsername string `json:"admin_username"`
+	AdminPassword string `json:"admin_password"`
+
+	ChunkCleanInterval Duration `json:"chunk_clean_interval"`
+	ChunkMaxAge        Duration `json:"chunk_max_age"`
+	TokenCleanInterval Duration `json:"token_clean_interval"`
+	// File di tempat sampah dihapus permanen setelah trash_retention
+	TrashRetention Duration `json:"trash_retention"`
+
+	// Retensi versi file: simpan maksimal max_versions versi per file dan hapus versi lama
+	// yang lebih tua dari version_max_age (0 = tanpa batas). Versi aktif tidak pernah dihapus.
+	MaxVersions   int64    `json:"max_versions"`
+	VersionMaxAge Duration `json:"version_max_age"`
+
+	// 0 = tanpa batas
+	MaxUploadSize int64 `json:"max_upload_size"`
+	MaxChunkSize  int64 `json:"max_chunk_size"`
+
+	// Pemindaian malware setelah upload selesai: "" (nonaktif), "clamd" atau "command" (lihat scanner.go)
+	Scanner      string   `json:"scanner"`
+	ClamdAddress string   `json:"clamd_address"` // tcp://host:port atau unix:///path/clamd.sock
+	ScanCommand  []string `json:"scan_command"`  // isi file dikirim lewat stdin
+	ScanTimeout  Duration `json:"scan_timeout"`
+	ScanInterval Duration `json:"scan_interval"` // jeda sebelum file yang gagal dipindai dicoba lagi
+
+	// Teks PDF diekstrak untuk pencarian (lihat search.go); file lebih besar dari batas ini
+	// hanya dicari lewat nama, tags dan deskripsi (0 = ekstraksi nonaktif)
+	TextIndexMaxSize int64 `json:"text_index_max_size"`
+
+	// Tipe file yang boleh diupload dan pembatasan per role (lihat policy.go)
+	FileTypes    []FileType            `json:"file_types"`
+	RolePolicies map[string]RolePolicy `json:"role_policies"`
+
+	// Format lama: kalau diisi, menggantikan file_types (setiap ekstensi menerima semua MIME di daftar;
+	// kalau allowed_mime_types kosong, MIME bawaan ekstensi itu yang dipakai)
+	AllowedExtensions []string `json:"allowed_extensions"`
+	AllowedMIMETypes  []string `json:"allowed_mime_types"`
+}
+
+func defaultConfig() *Config {
+	return &Config{
+		ListenAddr:   "0.0.0.0:8080",
+		DBPath:       "./filemeta.db",
+		UploadPath:   "./uploads",
+		ChunkTempDir: "uploads_tmp",
+
+		QuarantineDir:    "quarantine",
+		QuarantineMaxAge: Duration(30 * 24 * time.Hour),
+
+		QuarantineMaxPerUser: 256 << 20,
+
+		StorageBackend: "local",
+		S3Region:       "us-east-1",
+
+		AccessTokenTTL:    Duration(15 * time.Minute),
+		RefreshTokenTTL:   Duration(7 * 24 * time.Hour),
+		AllowRegistration: true,
+
+		ChunkCleanInterval: Duration(30 * time.Minute), // cek tiap 30 menit
+		ChunkMaxAge:        Duration(6 * time.Hour),    // hapus yang lebih tua 6 jam
+		TokenCleanInterval: Duration(1 * time.Hour),
+		TrashRetention:     Duration(30 * 24 * time.Hour),
+
+		MaxVersions: 10,
+
+		MaxUploadSize: 0,
+		MaxChunkSize:  64 << 20,
+
+		ClamdAddress: "tcp://127.0.0.1:3310",
+		ScanTimeout:  Duration(10 * time.Minute),
+		ScanInterval: Duration(1 * time.Minute),
+
+		TextIndexMaxSize: 32 << 20,
+
+		FileTypes: defaultFileTypes(),
+	}
+}
+
+// fileTypes mengembalikan daftar tipe efektif, termasuk konversi dari allowed_extensions/allowed_mime_types.
+// Signature bawaan untuk ekstensi yang sama (mis. .deb, .iso) tetap dipakai.
+func (c *Config) fileTypes() []FileType {
+	if len(c.AllowedExtensions) == 0 {
+		return c.FileTypes
+	}
+	builtin := map[string]FileType{}
+	for _, t := range defaultFileTypes() {
+		for _, ext := range t.Extensions {
+			builtin[ext] = t
+		}
+	}
+
+	var types []FileType
+	for _, ext := range c.AllowedExtensions {
+		ext = strings.ToLower(ext)
+		mimeTypes := c.AllowedMIMETypes
+		if len(mimeTypes) == 0 {
+			mimeTypes = builtin[ext].MIMETypes
+		}
+		types = append(types, FileType{
+			Name:       strings.TrimPrefix(ext, "."),
+			Extensions: []string{ext},
+			MIMETypes:  mimeTypes,
+			Signatures: builtin[ext].Signatures,
+			Validate:   builtin[ext].Validate,
+		})
+	}
+	return types
+}
+
+// configField menghubungkan satu setting ke nama flag dan env var-nya
+type configField struct {
+	flag  string
+	env   string
+	usage string
+	set   func(c *Config, v string) error
+}
+
+func stringField(p func(c *Config) *string) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		*p(c) = v
+		return nil
+	}
+}
+
+func durationField(p func(c *Config) *Duration) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*p(c) = Duration(d)
+		return nil
+	}
+}
+
+func int64Field(p func(c *Config) *int64) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return err
+		}
+		*p(c) = n
+		return nil
+	}
+}
+
+func boolField(p func(c *Config) *bool) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		*p(c) = b
+		return nil
+	}
+}
+
+// Daftar dipisah koma, contoh: ".jpg,.png"
+func listField(p func(c *Config) *[]string) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		var items []string
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		*p(c) = items
+		return nil
+	}
+}
+
+var configFields = []configField{
+	{"listen-addr", "MAR_LISTEN_ADDR", "alamat listen HTTP", stringField(func(c *Config) *string { return &c.ListenAddr })},
+	{"db-path", "MAR_DB_PATH", "lokasi file database SQLite", stringField(func(c *Config) *string { return &c.DBPath })},
+	{"upload-path", "MAR_UPLOAD_PATH", "folder penyimpanan file", stringField(func(c *Config) *string { return &c.UploadPath })},
+	{"chunk-temp-dir", "MAR_CHUNK_TEMP_DIR", "folder sementara untuk chunk", stringField(func(c *Config) *string { return &c.ChunkTempDir })},
+	{"quarantine-dir", "MAR_QUARANTINE_DIR", "folder karantina file yang gagal validasi", stringField(func(c *Config) *string { return &c.QuarantineDir })},
+	{"quarantine-max-age", "MAR_QUARANTINE_MAX_AGE", "lama file karantina disimpan sebelum dihapus", durationField(func(c *Config) *Duration { return &c.QuarantineMaxAge })},
+	{"quarantine-max-per-user", "MAR_QUARANTINE_MAX_PER_USER", "total ukuran file karantina per user dalam byte (0 = tanpa batas)", int64Field(func(c *Config) *int64 { return &c.QuarantineMaxPerUser })},
+	{"storage-backend", "MAR_STORAGE_BACKEND", "backend penyimpanan: local atau s3", stringField(func(c *Config) *string { return &c.StorageBackend })},
+	{"s3-endpoint", "MAR_S3_ENDPOINT", "URL endpoint S3, contoh http://127.0.0.1:9000", stringField(func(c *Config) *string { return &c.S3Endpoint })},
+	{"s3-bucket", "MAR_S3_BUCKET", "nama bucket S3", stringField(func(c *Config) *string { return &c.S3Bucket })},
+	{"s3-region", "MAR_S3_REGION", "region S3", stringField(func(c *Config) *string { return &c.S3Region })},
+	{"s3-access-key", "MAR_S3_ACCESS_KEY", "access key S3", stringField(func(c *Config) *string { return &c.S3AccessKey })},
+	{"s3-secret-key", "MAR_S3_SECRET_KEY", "secret key S3", stringField(func(c *Config) *string { return &c.S3SecretKey })},
+	{"jwt-secret", "MAR_JWT_SECRET", "secret HS256 untuk token (min 32 karakter)", stringField(func(c *Config) *string { return &c.JWTSecret })},
+	{"access-token-ttl", "MAR_ACCESS_TOKEN_TTL", "masa berlaku access token", durationField(func(c *Config) *Duration { return &c.AccessTokenTTL })},
+	{"refresh-token-ttl", "MAR_REFRESH_TOKEN_TTL", "masa berlaku refresh token", durationField(func(c *Config) *Duration { return &c.RefreshTokenTTL })},
+	{"allow-registration", "MAR_ALLOW_REGISTRATION", "izinkan registrasi publik lewat /register", boolField(func(c *Config) *bool { return &c.AllowRegistration })},
+	{"admin-username", "MAR_ADMIN_USERNAME", "username admin awal, dibuat saat startup kalau belum ada user", stringField(func(c *Config) *string { return &c.AdminUsername })},
+	{"admin-password", "MAR_ADMIN_PASSWORD", "password admin awal", stringField(func(c *Config) *string { return &c.AdminPassword })},
+	{"chunk-clean-interval", "MAR_CHUNK_CLEAN_INTERVAL", "interval pembersihan chunk", durationField(func(c *Config) *Duration { return &c.ChunkCleanInterval })},
+	{"chunk-max-age", "MAR_CHUNK_MAX_AGE", "umur maksimal upload chunk yang belum selesai", durationField(func(c *Config) *Duration { return &c.ChunkMaxAge })},
+	{"token-clean-interval", "MAR_TOKEN_CLEAN_INTERVAL", "interval pembersihan token expired", durationField(func(c *Config) *Duration { return &c.TokenCleanInterval })},
+	{"trash-retention", "MAR_TRASH_RETENTION", "lama file disimpan di tempat sampah sebelum dihapus permanen", durationField(func(c *Config) *Duration { return &c.TrashRetention })},
+	{"max-versions", "MAR_MAX_VERSIONS", "jumlah versi yang disimpan per file (0 = tanpa batas)", int64Field(func(c *Config) *int64 { return &c.MaxVersions })},
+	{"version-max-age", "MAR_VERSION_MAX_AGE", "umur maksimal versi lama sebelum dihapus (0 = tanpa batas)", durationField(func(c *Config) *Duration { return &c.VersionMaxAge })},
+	{"max-upload-size", "MAR_MAX_UPLOAD_SIZE", "ukuran maksimal upload biasa dalam byte (0 = tanpa batas)", int64Field(func(c *Config) *int64 { return &c.MaxUploadSize })},
+	{"max-chunk-size", "MAR_MAX_CHUNK_SIZE", "ukuran maksimal satu chunk dalam byte (0 = tanpa batas)", int64Field(func(c *Config) *int64 { return &c.MaxChunkSize })},
+	{"scanner", "MAR_SCANNER", "pemindai malware: clamd atau command (kosong = nonaktif)", stringField(func(c *Config) *string { return &c.Scanner })},
+	{"clamd-address", "MAR_CLAMD_ADDRESS", "alamat clamd, tcp://host:port atau unix:///path", stringField(func(c *Config) *string { return &c.ClamdAddress })},
+	{"scan-command", "MAR_SCAN_COMMAND", "program pemindai dan argumennya, dipisah koma (isi file lewat stdin)", listField(func(c *Config) *[]string { return &c.ScanCommand })},
+	{"scan-timeout", "MAR_SCAN_TIMEOUT", "batas waktu memindai satu file", durationField(func(c *Config) *Duration { return &c.ScanTimeout })},
+	{"scan-interval", "MAR_SCAN_INTERVAL", "interval mencoba ulang file yang belum terpindai", durationField(func(c *Config) *Duration { return &c.ScanInterval })},
+	{"text-index-max-size", "MAR_TEXT_INDEX_MAX_SIZE", "ukuran maksimal PDF yang teksnya diindeks untuk pencarian (0 = nonaktif)", int64Field(func(c *Config) *int64 { return &c.TextIndexMaxSize })},
+	{"allowed-extensions", "MAR_ALLOWED_EXTENSIONS", "ekstensi yang diizinkan, dipisah koma (format lama, menggantikan file_types)", listField(func(c *Config) *[]string { return &c.AllowedExtensions })},
+	{"allowed-mime-types", "MAR_ALLOWED_MIME_TYPES", "tipe MIME yang diizinkan, dipisah koma", listField(func(c *Config) *[]string { return &c.AllowedMIMETypes })},
+}
+
+// loadConfig: default → file JSON → environment variable → flag (urutan prioritas naik)
+func loadConfig(args []string) (*Config, error) {
+	cfg := defaultConfig()
+
+	fs := flag.NewFlagSet("mar-cloud-system", flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv("MAR_CONFIG"), "file konfigurasi JSON (env MAR_CONFIG)")
+	flagValues := map[string]*string{}
+	for _, f := range configFields {
+		flagValues[f.flag] = fs.String(f.flag, "", fmt.Sprintf("%s (env %s)", f.usage, f.env))
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *configPath != "" {
+		data, err := os.ReadFile(*configPath)
+		if err != nil {
+			return nil, fmt.Errorf("baca config %s: %w", *configPath, err)
+		}
+		if err := json.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("parse config %s: %w", *configPath, err)
+		}
+	}
+
+	for _, f := range configFields {
+		if v, ok := os.LookupEnv(f.env); ok {
+			if err := f.set(cfg, v); err != nil {
+				return nil, fmt.Errorf("env %s: %w", f.env, err)
+			}
+		}
+	}
+
+	var flagErr error
+	fs.Visit(func(fl *flag.Flag) {
+		for _, f := range configFields {
+			if f.flag == fl.Name && flagErr == nil {
+				if err := f.set(cfg, *flagValues[f.flag]); err != nil {
+					flagErr = fmt.Errorf("flag -%s: %w", f.flag, err)
+				}
+			}
+		}
+	})
+	if flagErr != nil {
+		return nil, flagErr
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate mengumpulkan semua kesalahan konfigurasi sekaligus
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.ListenAddr == "" {
+		errs = append(errs, errors.New("listen_addr kosong"))
+	}
+	if c.DBPath == "" {
+		errs = append(errs, errors.New("db_path kosong"))
+	}
+	if c.UploadPath == "" || c.ChunkTempDir == "" || c.QuarantineDir == "" {
+		errs = append(errs, errors.New("upload_path, chunk_temp_dir dan quarantine_dir wajib diisi"))
+	}
+
+	switch c.StorageBackend {
+	case "local":
+	case "s3":
+		if c.S3Endpoint == "" || c.S3Bucket == "" || c.S3Region == "" || c.S3AccessKey == "" || c.S3SecretKey == "" {
+			errs = append(errs, errors.New("storage s3 butuh s3_endpoint, s3_bucket, s3_region, s3_access_key dan s3_secret_key"))
+		}
+		if c.S3Endpoint != "" && !strings.HasPrefix(c.S3Endpoint, "http://") && !strings.HasPrefix(c.S3Endpoint, "https://") {
+			errs = append(errs, errors.New("s3_endpoint harus diawali http:// atau https://"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("storage_backend %q tidak dikenal (local atau s3)", c.StorageBackend))
+	}
+
+	switch {
+	case c.JWTSecret == "":
+		errs = append(errs, errors.New("jwt_secret wajib diisi (MAR_JWT_SECRET)"))
+	case c.JWTSecret == insecureDefaultJWTSecret:
+		errs = append(errs, errors.New("jwt_secret masih memakai nilai bawaan, ganti dengan secret acak"))
+	case len(c.JWTSecret) < minJWTSecretLength:
+		errs = append(errs, fmt.Errorf("jwt_secret minimal %d karakter", minJWTSecretLength))
+	}
+
+	durations := []struct {
+		name string
+		d    Duration
+	}{
+		{"access_token_ttl", c.AccessTokenTTL},
+		{"refresh_token_ttl", c.RefreshTokenTTL},
+		{"chunk_clean_interval", c.ChunkCleanInterval},
+		{"chunk_max_age", c.ChunkMaxAge},
+		{"token_clean_interval", c.TokenCleanInterval},
+		{"quarantine_max_age", c.QuarantineMaxAge},
+		{"trash_retention", c.TrashRetention},
+		{"scan_timeout", c.ScanTimeout},
+		{"scan_interval", c.ScanInterval},
+	}
+	for _, v := range durations {
+		if v.d <= 0 {
+			errs = append(errs, fmt.Errorf("%s harus lebih dari 0", v.name))
+		}
+	}
+	if (c.AdminUsername == "") != (c.AdminPassword == "") {
+		errs = append(errs, errors.New("admin_username dan admin_password harus diisi bersamaan"))
+	} else if c.AdminUsername != "" {
+		if err := validateCredentials(c.AdminUsername, c.AdminPassword); err != nil {
+			errs = append(errs, fmt.Errorf("admin awal: %w", err))
+		}
+	}
+	if c.RefreshTokenTTL < c.AccessTokenTTL {
+		errs = append(errs, errors.New("refresh_token_ttl tidak boleh lebih pendek dari access_token_ttl"))
+	}
+
+	if c.MaxVersions < 0 || c.VersionMaxAge < 0 {
+		errs = append(errs, errors.New("max_versions dan version_max_age tidak boleh negatif"))
+	}
+	if c.MaxUploadSize < 0 || c.MaxChunkSize < 0 {
+		errs = append(errs, errors.New("max_upload_size dan max_chunk_size tidak boleh negatif"))
+	}
+	if c.QuarantineMaxPerUser < 0 {
+		errs = append(errs, errors.New("quarantine_max_per_user tidak boleh negatif"))
+	}
+	if c.TextIndexMaxSize < 0 {
+		errs = append(errs, errors.New("text_index_max_size tidak boleh negatif"))
+	}
+
+	if _, err := newScanner(c); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := newFilePolicy(c.fileTypes(), c.RolePolicies); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// applyConfig memasang nilai config ke variabel global yang dipakai handler
+func applyConfig(c *Config) error {
+	uploadPath = c.UploadPath
+	chunkTempDir = c.ChunkTempDir
+	quarantineDir = c.QuarantineDir
+	quarantineMaxPerUser = c.QuarantineMaxPerUser
+	jwtKey = []byte(c.JWTSecret)
+	accessTokenTTL = time.Duration(c.AccessTokenTTL)
+	refreshTokenTTL = time.Duration(c.RefreshTokenTTL)
+	allowRegistration = c.AllowRegistration
+	maxUploadSize = c.MaxUploadSize
+	maxChunkSize = c.MaxChunkSize
+	uploadSessionMaxAge = time.Duration(c.ChunkMaxAge)
+	maxVersions = c.MaxVersions
+	trashRetention = time.Duration(c.TrashRetention)
+	versionMaxAge = time.Duration(c.VersionMaxAge)
+	textIndexMaxSize = c.TextIndexMaxSize
+
+	sc, err := newScanner(c)
+	if err != nil {
+		return err
+	}
+	scanner = sc
+	scanTimeout = time.Duration(c.ScanTimeout)
+
+	policy, err := newFilePolicy(c.fileTypes(), c.RolePolicies)
+	if err != nil {
+		return err
+	}
+	filePolicy = policy
+
+	for _, dir := range []string{uploadPath, chunkTempDir, quarantineDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("buat folder %s: %w", dir, err)
+		}
+	}
+
+	st, err := newStorage(c)
+	if err != nil {
+		return err
+	}
+	store = st
+	return nil
+}
@@ -2,15 +2,17 @@ package main
 
 import (
 	"database/sql"
+	"fmt"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
 var DB *sql.DB // Kapital → diekspor
 
-func InitDB() {
+func InitDB(path string) {
 	var err error
-	DB, err = sql.Open("sqlite3", "./filemeta.db")
+	// busy_timeout + txlock=immediate supaya request paralel menunggu lock, bukan langsung gagal "database is locked"
+	DB, err = sql.Open("sqlite3", "file:"+path+"?_busy_timeout=5000&_txlock=immediate")
 	if err != nil {
 		panic(err)
 	}
@@ -27,4 +29,302 @@ func InitDB() {
 	if err != nil {
 		panic(err)
 	}
+
+	// Akun user (password disimpan sebagai hash bcrypt)
+	createUsersTable := `
+	CREATE TABLE IF NOT EXISTS users (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		username TEXT NOT NULL UNIQUE,
+		password_hash TEXT NOT NULL,
+		role TEXT NOT NULL DEFAULT 'user',
+		disabled INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME
+	);
+	`
+	_, err = DB.Exec(createUsersTable)
+	if err != nil {
+		panic(err)
+	}
+
+	// Refresh token disimpan dalam bentuk hash; family_id mengelompokkan hasil rotasi dari satu login
+	createTokenTables := `
+	CREATE TABLE IF NOT EXISTS refresh_tokens (
+		token_hash TEXT PRIMARY KEY,
+		family_id TEXT NOT NULL,
+		username TEXT NOT NULL,
+		created_at DATETIME,
+		expires_at DATETIME,
+		revoked_at DATETIME,
+		replaced_by TEXT
+	);
+	CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family ON refresh_tokens(family_id);
+
+	CREATE TABLE IF NOT EXISTS revoked_tokens (
+		jti TEXT PRIMARY KEY,
+		expires_at DATETIME
+	);
+	`
+	_, err = DB.Exec(createTokenTables)
+	if err != nil {
+		panic(err)
+	}
+
+	// Sesi upload chunk; received = bitmap chunk yang sudah diterima (bit i = chunk i)
+	createSessionsTable := `
+	CREATE TABLE IF NOT EXISTS upload_sessions (
+		id TEXT PRIMARY KEY,
+		owner TEXT NOT NULL,
+		filename TEXT NOT NULL,
+		total_size INTEGER NOT NULL DEFAULT 0,
+		chunk_size INTEGER NOT NULL DEFAULT 0,
+		total_chunks INTEGER NOT NULL,
+		received BLOB NOT NULL,
+		status TEXT NOT NULL DEFAULT 'active',
+		created_at DATETIME,
+		updated_at DATETIME
+	);
+	CREATE INDEX IF NOT EXISTS idx_upload_sessions_owner ON upload_sessions(owner);
+	CREATE INDEX IF NOT EXISTS idx_upload_sessions_updated ON upload_sessions(updated_at);
+	`
+	_, err = DB.Exec(createSessionsTable)
+	if err != nil {
+		panic(err)
+	}
+
+	// File yang gagal validasi isi; stored_name = nama file di quarantine_dir
+	createQuarantineTable := `
+	CREATE TABLE IF NOT EXISTS quarantine (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		username TEXT NOT NULL,
+		filename TEXT NOT NULL,
+		file_type TEXT NOT NULL DEFAULT '',
+		reason TEXT NOT NULL DEFAULT '',
+		size INTEGER NOT NULL DEFAULT 0,
+		stored_name TEXT NOT NULL,
+		created_at DATETIME
+	);
+	CREATE INDEX IF NOT EXISTS idx_quarantine_created ON quarantine(created_at);
+	`
+	_, err = DB.Exec(createQuarantineTable)
+	if err != nil {
+		panic(err)
+	}
+
+	// Isi file disimpan sekali per sha256 (lihat blobs.go); refcount = jumlah baris uploads yang menunjuknya
+	createBlobsTable := `
+	CREATE TABLE IF NOT EXISTS blobs (
+		sha256 TEXT PRIMARY KEY,
+		size INTEGER NOT NULL,
+		refcount INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME NOT NULL
+	);
+	`
+	_, err = DB.Exec(createBlobsTable)
+	if err != nil {
+		panic(err)
+	}
+
+	// Link share publik (lihat shares.go); version NULL = selalu versi aktif
+	createSharesTable := `
+	CREATE TABLE IF NOT EXISTS shares (
+		id TEXT PRIMARY KEY,
+		owner TEXT NOT NULL,
+		filename TEXT NOT NULL,
+		version INTEGER,
+		password_hash TEXT,
+		expires_at DATETIME,
+		max_downloads INTEGER,
+		download_count INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME NOT NULL,
+		revoked_at DATETIME
+	);
+	CREATE INDEX IF NOT EXISTS idx_shares_owner ON shares(owner, filename);
+	CREATE TABLE IF NOT EXISTS share_access (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		share_id TEXT NOT NULL,
+		accessed_at DATETIME NOT NULL,
+		remote_addr TEXT,
+		user_agent TEXT,
+		result TEXT NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_share_access_share ON share_access(share_id);
+	`
+	_, err = DB.Exec(createSharesTable)
+	if err != nil {
+		panic(err)
+	}
+
+	// Folder virtual (lihat folders.go); parent_id 0 = root, path = path lengkap dari root
+	createFoldersTable := `
+	CREATE TABLE IF NOT EXISTS folders (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		owner TEXT NOT NULL,
+		parent_id INTEGER NOT NULL DEFAULT 0,
+		name TEXT NOT NULL,
+		path TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		UNIQUE (owner, path)
+	);
+	CREATE INDEX IF NOT EXISTS idx_folders_parent ON folders(owner, parent_id);
+	`
+	_, err = DB.Exec(createFoldersTable)
+	if err != nil {
+		panic(err)
+	}
+
+	// Hak akses file untuk user/grup lain (lihat acl.go) dan grup user (lihat groups.go)
+	createACLTables := `
+	CREATE TABLE IF NOT EXISTS user_groups (
+		name TEXT PRIMARY KEY,
+		created_at DATETIME NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS group_members (
+		group_name TEXT NOT NULL,
+		username TEXT NOT NULL,
+		PRIMARY KEY (group_name, username)
+	);
+	CREATE INDEX IF NOT EXISTS idx_group_members_user ON group_members(username);
+	CREATE TABLE IF NOT EXISTS acl (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		owner TEXT NOT NULL,
+		resource_type TEXT NOT NULL,
+		resource TEXT NOT NULL,
+		grantee_type TEXT NOT NULL,
+		grantee TEXT NOT NULL,
+		permission TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		UNIQUE (owner, resource_type, resource, grantee_type, grantee)
+	);
+	CREATE INDEX IF NOT EXISTS idx_acl_grantee ON acl(grantee_type, grantee);
+	`
+	_, err = DB.Exec(createACLTables)
+	if err != nil {
+		panic(err)
+	}
+
+	// Teks hasil ekstraksi isi file untuk pencarian (lihat search.go), satu baris per blob
+	createBlobTextTable := `
+	CREATE TABLE IF NOT EXISTS blob_text (
+		sha256 TEXT PRIMARY KEY,
+		text TEXT NOT NULL,
+		extracted_at DATETIME NOT NULL
+	);
+	`
+	_, err = DB.Exec(createBlobTextTable)
+	if err != nil {
+		panic(err)
+	}
+
+	// Pengaturan server yang bisa diubah admin saat berjalan (mis. kuota default)
+	createSettingsTable := `
+	CREATE TABLE IF NOT EXISTS settings (
+		key TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	);
+	`
+	_, err = DB.Exec(createSettingsTable)
+	if err != nil {
+		panic(err)
+	}
+
+	// Kolom tambahan untuk database lama (CREATE TABLE IF NOT EXISTS tidak menambah kolom)
+	if err := addColumnIfMissing("uploads", "sha256", "TEXT"); err != nil {
+		panic(err)
+	}
+	// Status pemindaian malware (lihat scanner.go); file lama dianggap clean supaya tetap bisa diunduh
+	if err := addColumnIfMissing("uploads", "status", "TEXT NOT NULL DEFAULT 'clean'"); err != nil {
+		panic(err)
+	}
+	if err := addColumnIfMissing("uploads", "scan_result", "TEXT"); err != nil {
+		panic(err)
+	}
+	if err := addColumnIfMissing("uploads", "scanned_at", "DATETIME"); err != nil {
+		panic(err)
+	}
+	// size NULL = baris lama yang ukurannya belum diisi (lihat migrateUploadsToBlobs)
+	if err := addColumnIfMissing("uploads", "size", "INTEGER"); err != nil {
+		panic(err)
+	}
+	// quota_bytes NULL = memakai kuota default
+	if err := addColumnIfMissing("users", "quota_bytes", "INTEGER"); err != nil {
+		panic(err)
+	}
+	if err := addColumnIfMissing("upload_sessions", "upload_offset", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		panic(err)
+	}
+	// blob_sha256 NULL = file lama yang masih tersimpan di <username>/<filename> (lihat migrateUploadsToBlobs)
+	if err := addColumnIfMissing("uploads", "blob_sha256", "TEXT"); err != nil {
+		panic(err)
+	}
+	if _, err := DB.Exec("CREATE INDEX IF NOT EXISTS idx_uploads_blob ON uploads(blob_sha256)"); err != nil {
+		panic(err)
+	}
+	if _, err := DB.Exec("CREATE INDEX IF NOT EXISTS idx_uploads_owner ON uploads(username, filename)"); err != nil {
+		panic(err)
+	}
+	// Tiap baris uploads adalah satu versi (lihat versions.go). Baris lama dengan nama yang sama
+	// dinomori sesuai urutan upload-nya.
+	if err := addColumnIfMissing("uploads", "version", "INTEGER"); err != nil {
+		panic(err)
+	}
+	// deleted_at terisi = file ada di tempat sampah (lihat trash.go)
+	if err := addColumnIfMissing("uploads", "deleted_at", "DATETIME"); err != nil {
+		panic(err)
+	}
+	// Metadata file (lihat metadata.go); storage_key baris lama diisi dari blob-nya
+	for _, col := range []string{"mime_type", "original_name", "storage_key", "tags", "description"} {
+		if err := addColumnIfMissing("uploads", col, "TEXT"); err != nil {
+			panic(err)
+		}
+	}
+	if err := addColumnIfMissing("upload_sessions", "original_name", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		panic(err)
+	}
+	// suspended_at terisi = filenya sedang di tempat sampah, nilainya sama dengan uploads.deleted_at (lihat trash.go)
+	for _, table := range []string{"shares", "acl"} {
+		if err := addColumnIfMissing(table, "suspended_at", "DATETIME"); err != nil {
+			panic(err)
+		}
+	}
+	_, err = DB.Exec(`UPDATE uploads SET storage_key = 'blobs/' || substr(blob_sha256, 1, 2) || '/' || substr(blob_sha256, 3, 2) || '/' || blob_sha256
+		WHERE storage_key IS NULL AND blob_sha256 IS NOT NULL`)
+	if err != nil {
+		panic(err)
+	}
+	_, err = DB.Exec(`UPDATE uploads SET version = (
+		SELECT COUNT(*) FROM uploads u WHERE u.username IS uploads.username AND u.filename = uploads.filename AND u.id <= uploads.id
+	) WHERE version IS NULL`)
+	if err != nil {
+		panic(err)
+	}
+
+	if err := initSearchIndex(); err != nil {
+		panic(err)
+	}
+}
+
+// addColumnIfMissing menjalankan ALTER TABLE ADD COLUMN hanya jika kolom belum ada
+func addColumnIfMissing(table, column, decl string) error {
+	rows, err := DB.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	_, err = DB.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, decl))
+	return err
 }
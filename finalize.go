@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+// checksumMismatchError: isi file yang diterima tidak cocok dengan checksum dari client
+type checksumMismatchError struct {
+	Expected string
+	Actual   string
+}
+
+func (e *checksumMismatchError) Error() string {
+	return fmt.Sprintf("checksum tidak cocok (client: %s, server: %s)", e.Expected, e.Actual)
+}
+
+// storeUpload menyimpan isi r sebagai file milik username dan mencatatnya di tabel uploads.
+// Isi di-hash dulu (r dibaca dua kali), lalu disimpan ke blob store hanya kalau blob-nya belum ada.
+// Kalau nama sudah terpakai, isi ini menjadi versi baru file tsb (lihat versions.go).
+// expectedSum kosong berarti checksum tidak diverifikasi. MIME type di meta dideteksi dari isi
+// kalau belum diisi. Mengembalikan nomor versi dan sha256 file.
+func storeUpload(ctx context.Context, username, filename string, r io.ReadSeeker, expectedSum string, meta FileMeta) (int64, string, error) {
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, r)
+	if err != nil {
+		return 0, "", err
+	}
+	fileSum := hex.EncodeToString(hasher.Sum(nil))
+	if expectedSum != "" && expectedSum != fileSum {
+		return 0, "", &checksumMismatchError{Expected: expectedSum, Actual: fileSum}
+	}
+	if meta.MIMEType == "" {
+		if meta.MIMEType, err = detectMIME(r, filename); err != nil {
+			return 0, "", err
+		}
+	}
+
+	version, err := commitUpload(ctx, username, filename, fileSum, size, meta, func(key string) error {
+		if _, err := r.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		return store.Put(ctx, key, r, size)
+	})
+	return version, fileSum, err
+}
+
+// storeUploadFile sama seperti storeUpload, tapi sumbernya file lokal yang sudah lengkap
+// (file data sesi upload). Kalau backend mendukung fileImporter, file langsung dipindah
+// ke blob store tanpa ditulis ulang.
+func storeUploadFile(ctx context.Context, username, filename, path, expectedSum string, meta FileMeta) (int64, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, f)
+	if err != nil {
+		return 0, "", err
+	}
+	fileSum := hex.EncodeToString(hasher.Sum(nil))
+	if expectedSum != "" && expectedSum != fileSum {
+		return 0, "", &checksumMismatchError{Expected: expectedSum, Actual: fileSum}
+	}
+	if meta.MIMEType == "" {
+		if meta.MIMEType, err = detectMIME(f, filename); err != nil {
+			return 0, "", err
+		}
+	}
+
+	version, err := commitUpload(ctx, username, filename, fileSum, size, meta, func(key string) error {
+		if imp, ok := store.(fileImporter); ok {
+			if err := imp.Import(ctx, key, path); err != nil {
+				return err
+			}
+			return verifyObject(ctx, key, fileSum)
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		return store.Put(ctx, key, f, size)
+	})
+	return version, fileSum, err
+}
+
+// verifyObject menghitung ulang sha256 object di storage. File yang dipindah apa adanya (Import)
+// tidak melewati hasher, jadi isinya dicek lagi sebelum blob dicatat; kalau berbeda object dihapus.
+func verifyObject(ctx context.Context, key, expectedSum string) error {
+	rc, err := store.Get(ctx, key, 0, -1)
+	if err != nil {
+		return err
+	}
+	hasher := sha256.New()
+	_, err = io.Copy(hasher, rc)
+	rc.Close()
+	if err != nil {
+		return err
+	}
+	if actual := hex.EncodeToString(hasher.Sum(nil)); actual != expectedSum {
+		if err := store.Delete(ctx, key); err != nil {
+			log.Printf("verifyObject: gagal hapus %s: %v", key, err)
+		}
+		return fmt.Errorf("isi %s berubah saat dipindah ke storage (sha256 %s)", key, actual)
+	}
+	return nil
+}
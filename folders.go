@@ -0,0 +1,684 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Folder virtual: hierarki disimpan di tabel folders (parent_id, 0 = root) dan nama file di
+// uploads adalah path lengkapnya ("laporan/2024/q1.pdf"). Semua yang memakai (username, filename)
+// — versi, tempat sampah, share, acl — otomatis ikut folder. Memindah folder berarti menulis ulang
+// awalan path di semua tabel itu; isi di storage tidak disentuh (blob store dialamati lewat sha256).
+
+var (
+	errFolderExists   = errors.New("folder sudah ada")
+	errFolderNotFound = errors.New("folder tidak ditemukan")
+	errFolderCycle    = errors.New("folder tidak bisa dipindah ke dalam dirinya sendiri")
+	errFileExists     = errors.New("sudah ada file aktif dengan nama yang sama di tujuan")
+	errTypeChanged    = errors.New("nama tujuan harus bertipe sama dengan file asal")
+)
+
+type Folder struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Path      string    `json:"path"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// FolderFile: versi aktif satu file di dalam folder
+type FolderFile struct {
+	Name       string    `json:"name"`
+	Path       string    `json:"path"`
+	Version    int64     `json:"version"`
+	Size       int64     `json:"size"`
+	Status     string    `json:"status"`
+	UploadedAt time.Time `json:"uploaded_at"`
+}
+
+type FolderListing struct {
+	Path    string       `json:"path"`
+	Folders []Folder     `json:"folders"`
+	Files   []FolderFile `json:"files"`
+}
+
+// pathColumns: semua kolom yang menyimpan path milik owner, ditulis ulang saat folder dipindah.
+// Grant folder yang dipindah sendiri (resource = path persis) ditangani terpisah di moveFolder.
+// Grant lama yang kebetulan sudah ada di path tujuan ditimpa (OR REPLACE).
+var pathColumns = []struct{ table, column, owner, update string }{
+	{"folders", "path", "owner", "UPDATE"},
+	{"uploads", "filename", "username", "UPDATE"},
+	{"upload_sessions", "filename", "owner", "UPDATE"},
+	{"shares", "filename", "owner", "UPDATE"},
+	{"acl", "resource", "owner", "UPDATE OR REPLACE"},
+}
+
+// underPath: kondisi SQL "kolom berada di bawah awalan" (argumen: awalan dua kali).
+// length/substr menghitung karakter, bukan byte, jadi aman untuk nama non-ASCII.
+func underPath(column string) string {
+	return fmt.Sprintf("substr(%s, 1, length(?)) = ?", column)
+}
+
+func scanFolder(row interface{ Scan(...interface{}) error }) (*Folder, error) {
+	var f Folder
+	if err := row.Scan(&f.ID, &f.Name, &f.Path, &f.CreatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errFolderNotFound
+		}
+		return nil, err
+	}
+	return &f, nil
+}
+
+// getFolder: folder milik owner di path; "" adalah root (ID 0, selalu ada)
+func getFolder(q interface {
+	QueryRow(string, ...interface{}) *sql.Row
+}, owner, path string) (*Folder, error) {
+	if path == "" {
+		return &Folder{}, nil
+	}
+	return scanFolder(q.QueryRow("SELECT id, name, path, created_at FROM folders WHERE owner = ? AND path = ?", owner, path))
+}
+
+// ensureFolderPath membuat folder di path beserta induknya yang belum ada, mengembalikan id-nya
+func ensureFolderPath(tx *sql.Tx, owner, path string) (int64, error) {
+	var id int64
+	built := ""
+	for _, name := range strings.Split(path, "/") {
+		if name == "" {
+			continue
+		}
+		built = joinPath(built, name)
+		_, err := tx.Exec("INSERT INTO folders (owner, parent_id, name, path, created_at) VALUES (?, ?, ?, ?, ?) ON CONFLICT(owner, path) DO NOTHING",
+			owner, id, name, built, time.Now())
+		if err != nil {
+			return 0, err
+		}
+		if err := tx.QueryRow("SELECT id FROM folders WHERE owner = ? AND path = ?", owner, built).Scan(&id); err != nil {
+			return 0, err
+		}
+	}
+	return id, nil
+}
+
+// createFolder membuat folder baru (induk yang belum ada ikut dibuat)
+func createFolder(owner, path string) (*Folder, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := getFolder(tx, owner, path); err == nil {
+		return nil, errFolderExists
+	} else if !errors.Is(err, errFolderNotFound) {
+		return nil, err
+	}
+	if _, err := ensureFolderPath(tx, owner, path); err != nil {
+		return nil, err
+	}
+	f, err := getFolder(tx, owner, path)
+	if err != nil {
+		return nil, err
+	}
+	return f, tx.Commit()
+}
+
+// listFolder: subfolder dan versi aktif file yang langsung berada di path
+func listFolder(owner, path string) (*FolderListing, error) {
+	parent, err := getFolder(DB, owner, path)
+	if err != nil {
+		return nil, err
+	}
+	listing := &FolderListing{Path: path, Folders: []Folder{}, Files: []FolderFile{}}
+
+	rows, err := DB.Query("SELECT id, name, path, created_at FROM folders WHERE owner = ? AND parent_id = ? ORDER BY name", owner, parent.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		f, err := scanFolder(rows)
+		if err != nil {
+			return nil, err
+		}
+		listing.Folders = append(listing.Folders, *f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	prefix := joinPath(path, "") // "" untuk root, "a/b/" untuk folder a/b
+	files, err := DB.Query(`SELECT filename, version, COALESCE(size, 0), status, uploaded_at FROM uploads
+		WHERE username = ? AND deleted_at IS NULL AND `+underPath("filename")+` AND instr(substr(filename, length(?) + 1), '/') = 0
+		AND version = (SELECT MAX(version) FROM uploads v WHERE v.username = uploads.username AND v.filename = uploads.filename AND v.deleted_at IS NULL)
+		ORDER BY filename`, owner, prefix, prefix, prefix)
+	if err != nil {
+		return nil, err
+	}
+	defer files.Close()
+	for files.Next() {
+		var f FolderFile
+		if err := files.Scan(&f.Path, &f.Version, &f.Size, &f.Status, &f.UploadedAt); err != nil {
+			return nil, err
+		}
+		_, f.Name = splitPath(f.Path)
+		listing.Files = append(listing.Files, f)
+	}
+	return listing, files.Err()
+}
+
+// uploadFolder memvalidasi folder tujuan upload milik owner ("" = root); folder harus sudah ada
+func uploadFolder(owner, folder string) (string, error) {
+	folder, err := cleanPath(folder)
+	if err != nil {
+		return "", err
+	}
+	if _, err := getFolder(DB, owner, folder); err != nil {
+		return "", err
+	}
+	return folder, nil
+}
+
+// moveFolder memindah folder path ke bawah newParent dengan nama newName (rename kalau induknya sama).
+// Mengembalikan path barunya.
+func moveFolder(owner, path, newParent, newName string) (string, error) {
+	if path == "" {
+		return "", errFolderNotFound
+	}
+	newPath := joinPath(newParent, newName)
+	if newPath == path {
+		return path, nil
+	}
+	if newParent == path || strings.HasPrefix(newParent, path+"/") {
+		return "", errFolderCycle
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	f, err := getFolder(tx, owner, path)
+	if err != nil {
+		return "", err
+	}
+	parent, err := getFolder(tx, owner, newParent)
+	if err != nil {
+		return "", err
+	}
+	_, err = tx.Exec("UPDATE folders SET parent_id = ?, name = ?, path = ? WHERE id = ?", parent.ID, newName, newPath, f.ID)
+	if err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed") {
+		return "", errFolderExists
+	}
+	if err != nil {
+		return "", err
+	}
+
+	oldPrefix, newPrefix := path+"/", newPath+"/"
+	for _, c := range pathColumns {
+		query := fmt.Sprintf("%s %s SET %s = ? || substr(%s, length(?) + 1) WHERE %s = ? AND %s",
+			c.update, c.table, c.column, c.column, c.owner, underPath(c.column))
+		if _, err := tx.Exec(query, newPrefix, oldPrefix, owner, oldPrefix, oldPrefix); err != nil {
+			return "", fmt.Errorf("%s.%s: %w", c.table, c.column, err)
+		}
+	}
+	if _, err := tx.Exec("UPDATE OR REPLACE acl SET resource = ? WHERE owner = ? AND resource_type = ? AND resource = ?", newPath, owner, ResourceFolder, path); err != nil {
+		return "", err
+	}
+	return newPath, tx.Commit()
+}
+
+// deleteFolder memindah semua file di dalam folder (rekursif) ke tempat sampah lalu menghapus
+// folder-folder itu beserta hak aksesnya. File yang dipulihkan nanti membuat ulang foldernya.
+// Mengembalikan jumlah file yang dipindah ke tempat sampah.
+func deleteFolder(owner, path string) (int, error) {
+	if path == "" {
+		return 0, errFolderNotFound
+	}
+	tx, err := DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := getFolder(tx, owner, path); err != nil {
+		return 0, err
+	}
+	prefix := path + "/"
+	var files int
+	err = tx.QueryRow("SELECT COUNT(DISTINCT filename) FROM uploads WHERE username = ? AND deleted_at IS NULL AND "+underPath("filename"),
+		owner, prefix, prefix).Scan(&files)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	_, err = tx.Exec("UPDATE uploads SET deleted_at = ? WHERE username = ? AND deleted_at IS NULL AND "+underPath("filename"),
+		now, owner, prefix, prefix)
+	if err != nil {
+		return 0, err
+	}
+	if err := suspendFileAccess(tx, now, owner, underPath, prefix, prefix); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("DELETE FROM folders WHERE owner = ? AND (path = ? OR "+underPath("path")+")", owner, path, prefix, prefix); err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec("DELETE FROM acl WHERE owner = ? AND resource_type = ? AND (resource = ? OR "+underPath("resource")+")",
+		owner, ResourceFolder, path, prefix, prefix)
+	if err != nil {
+		return 0, err
+	}
+	return files, tx.Commit()
+}
+
+// moveFile memindah/mengganti nama file aktif (semua versinya) milik owner ke path dest.
+// Hak akses dan link share file itu ikut pindah; versi di tempat sampah tetap di nama lama.
+func moveFile(owner, filename, dest string) error {
+	if dest == filename {
+		return nil
+	}
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	folder, _ := splitPath(dest)
+	if _, err := getFolder(tx, owner, folder); err != nil {
+		return err
+	}
+	var live int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM uploads WHERE username = ? AND filename = ? AND deleted_at IS NULL", owner, dest).Scan(&live); err != nil {
+		return err
+	}
+	if live > 0 {
+		return errFileExists
+	}
+
+	res, err := tx.Exec("UPDATE uploads SET filename = ? WHERE username = ? AND filename = ? AND deleted_at IS NULL", dest, owner, filename)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errFileNotFound
+	}
+	// Yang dibekukan milik versi di tempat sampah, jadi tetap di nama lama
+	if _, err := tx.Exec("UPDATE OR REPLACE acl SET resource = ? WHERE owner = ? AND resource_type = ? AND resource = ? AND suspended_at IS NULL", dest, owner, ResourceFile, filename); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE shares SET filename = ? WHERE owner = ? AND filename = ? AND suspended_at IS NULL", dest, owner, filename); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// copyFile menyalin satu versi file (0 = aktif) ke path dest milik dstOwner tanpa upload ulang:
+// versi baru di tujuan menunjuk ke blob yang sama. Tujuan yang sudah ada mendapat versi baru,
+// sama seperti upload dengan nama yang sama.
+func copyFile(ctx context.Context, srcOwner, filename string, version int64, dstOwner, dest string) (int64, error) {
+	src, err := getUpload(srcOwner, filename, version)
+	if err != nil {
+		return 0, err
+	}
+	if src.Blob == "" {
+		return 0, errFileNotFound
+	}
+	folder, _ := splitPath(dest)
+	if _, err := getFolder(DB, dstOwner, folder); err != nil {
+		return 0, err
+	}
+
+	newVersion, created, err := func() (int64, bool, error) {
+		unlock := lockBlob(src.Blob)
+		defer unlock()
+		if ok, err := blobExists(src.Blob); err != nil || !ok {
+			return 0, false, errors.Join(err, errFileNotFound)
+		}
+		return recordVersion(dstOwner, dest, src.Blob, src.Size, FileMeta{MIMEType: src.MIMEType, OriginalName: src.OriginalName})
+	}()
+	if err != nil {
+		return 0, err
+	}
+	if created {
+		notifyScanner()
+		if _, err := pruneVersions(ctx, dstOwner, dest, maxVersions, versionMaxAge); err != nil {
+			log.Printf("copyFile: gagal hapus versi lama %s milik %s: %v", dest, dstOwner, err)
+		}
+	}
+	return newVersion, nil
+}
+
+// destPath menentukan path tujuan move/copy: folder to (nil = folder asal) + name ("" = nama asal)
+func destPath(src string, to *string, name string) (string, error) {
+	folder, base := splitPath(src)
+	if to != nil {
+		p, err := cleanPath(*to)
+		if err != nil {
+			return "", err
+		}
+		folder = p
+	}
+	if name != "" {
+		n, err := cleanName(name)
+		if err != nil {
+			return "", err
+		}
+		base = n
+	}
+	return joinPath(folder, base), nil
+}
+
+// checkDestPolicy: nama tujuan pindah/salin harus lolos kebijakan tipe file untuk role pemanggil,
+// dan tipenya tidak boleh berubah karena isi file tidak divalidasi ulang
+func checkDestPolicy(p *Principal, src, dest string, size int64) error {
+	t, err := filePolicy.Check(p.Roles, dest, size)
+	if err != nil {
+		return err
+	}
+	if st, ok := filePolicy.Lookup(src); !ok || st.Name != t.Name {
+		return errTypeChanged
+	}
+	return nil
+}
+
+func writeFolderError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errExtensionNotAllowed), errors.Is(err, errTypeForbidden), errors.Is(err, errFileTooLarge):
+		writeSessionError(w, err)
+	case errors.Is(err, errTypeChanged):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, errUnsafePath):
+		http.Error(w, "Nama atau path tidak valid", http.StatusBadRequest)
+	case errors.Is(err, errFolderCycle):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, errFolderNotFound), errors.Is(err, errFileNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, errFolderExists), errors.Is(err, errFileExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, errFileExceedsQuota), errors.Is(err, errQuotaExceeded):
+		writeQuotaError(w, err)
+	default:
+		http.Error(w, "Gagal memproses folder", http.StatusInternalServerError)
+	}
+}
+
+// -------------------------
+// Folder (milik user yang login, atau dibagikan lewat acl)
+// -------------------------
+
+// GET ?path=[&owner=]: isi folder, POST {"path": "..."}: buat folder, DELETE ?path=: hapus rekursif
+func FoldersHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+	var path string
+	if r.Method == http.MethodPost {
+		var req struct {
+			Path string `json:"path"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+		path = req.Path
+	} else {
+		path = r.URL.Query().Get("path")
+	}
+	path, err := cleanPath(path)
+	if err != nil {
+		writeFolderError(w, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		owner := fileOwnerParam(r, p)
+		perm, err := folderPermission(p.Username, owner, path)
+		if err != nil {
+			http.Error(w, "Gagal cek hak akses", http.StatusInternalServerError)
+			log.Printf("FoldersHandler: DB error: %v", err)
+			return
+		}
+		if !permits(perm, PermRead) {
+			http.Error(w, "Folder tidak ditemukan", http.StatusNotFound)
+			return
+		}
+		listing, err := listFolder(owner, path)
+		if err != nil {
+			writeFolderError(w, err)
+			if !errors.Is(err, errFolderNotFound) {
+				log.Printf("FoldersHandler: list %q milik %s: %v", path, owner, err)
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(listing)
+
+	case http.MethodPost:
+		if path == "" {
+			http.Error(w, "path diperlukan", http.StatusBadRequest)
+			return
+		}
+		f, err := createFolder(p.Username, path)
+		if err != nil {
+			writeFolderError(w, err)
+			log.Printf("FoldersHandler: gagal buat %q (user=%s): %v", path, p.Username, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(f)
+		log.Printf("FoldersHandler: user=%s membuat folder %s", p.Username, path)
+
+	case http.MethodDelete:
+		n, err := deleteFolder(p.Username, path)
+		if err != nil {
+			writeFolderError(w, err)
+			log.Printf("FoldersHandler: gagal hapus %q (user=%s): %v", path, p.Username, err)
+			return
+		}
+		fmt.Fprintf(w, "Folder %s dihapus, %d file dipindah ke tempat sampah", path, n)
+		log.Printf("FoldersHandler: user=%s menghapus folder %s (%d file)", p.Username, path, n)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// POST /folders/move {"path", "to", "name"}: pindah ke folder to (tanpa to = tetap) dan/atau ganti nama
+func MoveFolderHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	p, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Path string  `json:"path"`
+		To   *string `json:"to"`
+		Name string  `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	path, err := cleanPath(req.Path)
+	if err == nil && path == "" {
+		err = errFolderNotFound
+	}
+	if err != nil {
+		writeFolderError(w, err)
+		return
+	}
+	dest, err := destPath(path, req.To, req.Name)
+	if err != nil {
+		writeFolderError(w, err)
+		return
+	}
+
+	parent, name := splitPath(dest)
+	newPath, err := moveFolder(p.Username, path, parent, name)
+	if err != nil {
+		writeFolderError(w, err)
+		log.Printf("MoveFolderHandler: %s -> %s (user=%s): %v", path, dest, p.Username, err)
+		return
+	}
+	fmt.Fprintf(w, "Folder %s dipindah ke %s", path, newPath)
+	log.Printf("MoveFolderHandler: user=%s %s -> %s", p.Username, path, newPath)
+}
+
+// -------------------------
+// Pindah / salin file
+// -------------------------
+
+// POST /files/move[?owner=] {"file", "to", "name"}: pindah dan/atau ganti nama, butuh hak write
+func MoveFileHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	p, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		File string  `json:"file"`
+		To   *string `json:"to"`
+		Name string  `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	filename, err := cleanFilePath(req.File)
+	if err != nil {
+		writeFolderError(w, err)
+		return
+	}
+	dest, err := destPath(filename, req.To, req.Name)
+	if err != nil {
+		writeFolderError(w, err)
+		return
+	}
+
+	// Memindah atau mengganti nama file milik user lain butuh hak write
+	owner := fileOwnerParam(r, p)
+	perm, err := filePermission(p.Username, owner, filename)
+	if err != nil {
+		http.Error(w, "Gagal cek hak akses", http.StatusInternalServerError)
+		log.Printf("MoveFileHandler: DB error: %v", err)
+		return
+	}
+	if !permits(perm, PermWrite) {
+		writeAccessDenied(w, perm)
+		return
+	}
+	src, err := getUpload(owner, filename, 0)
+	if err != nil {
+		writeFolderError(w, err)
+		return
+	}
+	if err := checkDestPolicy(p, filename, dest, src.Size); err != nil {
+		writeFolderError(w, err)
+		log.Printf("MoveFileHandler: %s -> %s ditolak (user=%s): %v", filename, dest, p.Username, err)
+		return
+	}
+
+	if err := moveFile(owner, filename, dest); err != nil {
+		writeFolderError(w, err)
+		log.Printf("MoveFileHandler: %s -> %s milik %s (user=%s): %v", filename, dest, owner, p.Username, err)
+		return
+	}
+	fmt.Fprintf(w, "File %s dipindah ke %s", filename, dest)
+	log.Printf("MoveFileHandler: user=%s %s -> %s milik %s", p.Username, filename, dest, owner)
+}
+
+// POST /files/copy[?owner=] {"file", "version", "to", "name"}: salin ke folder milik user yang login,
+// cukup hak read atas file sumber
+func CopyFileHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	p, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		File    string  `json:"file"`
+		Version int64   `json:"version"`
+		To      *string `json:"to"`
+		Name    string  `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Version < 0 {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	filename, err := cleanFilePath(req.File)
+	if err != nil {
+		writeFolderError(w, err)
+		return
+	}
+	// Salinan file milik user lain masuk ke root kalau tujuan tidak disebut
+	owner := fileOwnerParam(r, p)
+	if owner != p.Username && req.To == nil {
+		root := ""
+		req.To = &root
+	}
+	dest, err := destPath(filename, req.To, req.Name)
+	if err != nil {
+		writeFolderError(w, err)
+		return
+	}
+
+	perm, err := filePermission(p.Username, owner, filename)
+	if err != nil {
+		http.Error(w, "Gagal cek hak akses", http.StatusInternalServerError)
+		log.Printf("CopyFileHandler: DB error: %v", err)
+		return
+	}
+	if !permits(perm, PermRead) {
+		writeAccessDenied(w, perm)
+		return
+	}
+	if owner == p.Username && dest == filename {
+		http.Error(w, "Tujuan salinan sama dengan file asal", http.StatusBadRequest)
+		return
+	}
+
+	// Salinan dihitung penuh di kuota walaupun isinya berbagi blob dengan file asal
+	src, err := getUpload(owner, filename, req.Version)
+	if err != nil {
+		writeFolderError(w, err)
+		return
+	}
+	if err := checkDestPolicy(p, filename, dest, src.Size); err != nil {
+		writeFolderError(w, err)
+		log.Printf("CopyFileHandler: %s -> %s ditolak (user=%s): %v", filename, dest, p.Username, err)
+		return
+	}
+	if err := checkQuota(p.Username, src.Size, ""); err != nil {
+		writeFolderError(w, err)
+		return
+	}
+
+	version, err := copyFile(r.Context(), owner, filename, req.Version, p.Username, dest)
+	if err != nil {
+		writeFolderError(w, err)
+		log.Printf("CopyFileHandler: %s milik %s -> %s (user=%s): %v", filename, owner, dest, p.Username, err)
+		return
+	}
+	fmt.Fprintf(w, "File %s disalin ke %s (versi %d)", filename, dest, version)
+	log.Printf("CopyFileHandler: user=%s %s milik %s -> %s v%d", p.Username, filename, owner, dest, version)
+}
@@ -3,6 +3,7 @@ module mar-cloud-system
 go 1.24.4
 
 require (
-	github.com/golang-jwt/jwt/v5 v5.2.2 // indirect
-	github.com/mattn/go-sqlite3 v1.14.28 // indirect
+	github.com/golang-jwt/jwt/v5 v5.2.2
+	github.com/mattn/go-sqlite3 v1.14.28
+	golang.org/x/crypto v0.40.0
 )
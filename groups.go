@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Grup user (dikelola admin) dipakai sebagai penerima hak akses file, lihat acl.go
+
+var (
+	errGroupExists   = errors.New("grup sudah ada")
+	errGroupNotFound = errors.New("grup tidak ditemukan")
+	errInvalidGroup  = errors.New("nama grup harus 3-32 karakter: huruf, angka, titik, strip atau underscore")
+)
+
+type Group struct {
+	Name      string    `json:"name"`
+	Members   []string  `json:"members"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// -------------------------
+// Akses tabel user_groups & group_members
+// -------------------------
+func createGroup(name string) error {
+	if !usernamePattern.MatchString(name) {
+		return errInvalidGroup
+	}
+	_, err := DB.Exec("INSERT INTO user_groups (name, created_at) VALUES (?, ?)", name, time.Now())
+	if err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed") {
+		return errGroupExists
+	}
+	return err
+}
+
+func groupExists(name string) (bool, error) {
+	var n int
+	err := DB.QueryRow("SELECT COUNT(*) FROM user_groups WHERE name = ?", name).Scan(&n)
+	return n > 0, err
+}
+
+// deleteGroup menghapus grup beserta anggota dan semua hak akses yang diberikan ke grup itu
+func deleteGroup(name string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("DELETE FROM user_groups WHERE name = ?", name)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errGroupNotFound
+	}
+	if _, err := tx.Exec("DELETE FROM group_members WHERE group_name = ?", name); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM acl WHERE grantee_type = ? AND grantee = ?", GranteeGroup, name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func listGroups() ([]Group, error) {
+	rows, err := DB.Query(`SELECT g.name, g.created_at, COALESCE(m.username, '')
+		FROM user_groups g LEFT JOIN group_members m ON m.group_name = g.name
+		ORDER BY g.name, m.username`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []Group{}
+	for rows.Next() {
+		var name, member string
+		var created time.Time
+		if err := rows.Scan(&name, &created, &member); err != nil {
+			return nil, err
+		}
+		if len(groups) == 0 || groups[len(groups)-1].Name != name {
+			groups = append(groups, Group{Name: name, Members: []string{}, CreatedAt: created})
+		}
+		if member != "" {
+			g := &groups[len(groups)-1]
+			g.Members = append(g.Members, member)
+		}
+	}
+	return groups, rows.Err()
+}
+
+func addGroupMember(group, username string) error {
+	if ok, err := groupExists(group); err != nil {
+		return err
+	} else if !ok {
+		return errGroupNotFound
+	}
+	if _, err := getUser(username); err != nil {
+		return err
+	}
+	_, err := DB.Exec("INSERT OR IGNORE INTO group_members (group_name, username) VALUES (?, ?)", group, username)
+	return err
+}
+
+func removeGroupMember(group, username string) error {
+	res, err := DB.Exec("DELETE FROM group_members WHERE group_name = ? AND username = ?", group, username)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errUserNotFound
+	}
+	return nil
+}
+
+// -------------------------
+// Grup (khusus admin)
+// -------------------------
+
+// GET: daftar grup beserta anggotanya, POST {"name": "..."}: buat grup, DELETE ?name=: hapus grup
+func AdminGroupsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		groups, err := listGroups()
+		if err != nil {
+			http.Error(w, "Gagal ambil data grup", http.StatusInternalServerError)
+			log.Printf("AdminGroupsHandler: list error: %v", err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(groups)
+
+	case http.MethodPost:
+		var req struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+		if err := createGroup(req.Name); err != nil {
+			writeGroupError(w, err)
+			log.Printf("AdminGroupsHandler: gagal buat grup %q: %v", req.Name, err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, "Grup %s dibuat", req.Name)
+		log.Printf("AdminGroupsHandler: grup %s dibuat", req.Name)
+
+	case http.MethodDelete:
+		name := r.URL.Query().Get("name")
+		if err := deleteGroup(name); err != nil {
+			writeGroupError(w, err)
+			log.Printf("AdminGroupsHandler: gagal hapus grup %q: %v", name, err)
+			return
+		}
+		fmt.Fprintf(w, "Grup %s dihapus", name)
+		log.Printf("AdminGroupsHandler: grup %s dihapus", name)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// POST {"group": "...", "username": "..."}: tambah anggota, DELETE (body sama): keluarkan anggota
+func AdminGroupMembersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Group    string `json:"group"`
+		Username string `json:"username"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Group == "" || req.Username == "" {
+		http.Error(w, "group dan username diperlukan", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		if err := addGroupMember(req.Group, req.Username); err != nil {
+			writeGroupError(w, err)
+			log.Printf("AdminGroupMembersHandler: gagal tambah %s ke %s: %v", req.Username, req.Group, err)
+			return
+		}
+		fmt.Fprintf(w, "User %s masuk grup %s", req.Username, req.Group)
+		log.Printf("AdminGroupMembersHandler: user=%s masuk grup %s", req.Username, req.Group)
+		return
+	}
+
+	if err := removeGroupMember(req.Group, req.Username); err != nil {
+		writeGroupError(w, err)
+		log.Printf("AdminGroupMembersHandler: gagal keluarkan %s dari %s: %v", req.Username, req.Group, err)
+		return
+	}
+	fmt.Fprintf(w, "User %s keluar dari grup %s", req.Username, req.Group)
+	log.Printf("AdminGroupMembersHandler: user=%s keluar dari grup %s", req.Username, req.Group)
+}
+
+func writeGroupError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errGroupExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, errGroupNotFound), errors.Is(err, errUserNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, errInvalidGroup):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, "Gagal memproses grup", http.StatusInternalServerError)
+	}
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -9,142 +12,260 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
-	"strings"
-	"time"
-
-	"github.com/golang-jwt/jwt/v5"
 )
 
-const uploadPath = "./uploads"
-const chunkTempDir = "uploads_tmp"
+// Diisi dari config saat startup (lihat applyConfig)
+var (
+	uploadPath   = "./uploads"
+	chunkTempDir = "uploads_tmp"
+
+	maxUploadSize int64 // 0 = tanpa batas
+	maxChunkSize  int64
+)
 
 // NOTE:
 // - Menggunakan global variables yang sudah ada di project-mu:
 //   - DB     *sql.DB
-//   - jwtKey []byte (atau tipe yg kamu pakai)
-//   - Claims struct (tipe klaim JWT)
-// - requireAuth middleware diasumsikan tersedia dan bekerja seperti semula.
+// - Semua handler di sini dibungkus requireAuth; identitas user diambil
+//   lewat currentPrincipal(w, r), bukan parse ulang header Authorization.
+
+// -------------------------
+// Buat sesi upload chunk (POST /uploads)
+// -------------------------
+func CreateUploadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	p, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Filename  string `json:"filename"`
+		Size      int64  `json:"size"`
+		MIMEType  string `json:"mime_type"`  // opsional, dari File.type di browser
+		ChunkSize int64  `json:"chunk_size"` // opsional, ukuran chunk yang diinginkan client
+		Folder    string `json:"folder"`     // opsional, path folder tujuan ("" = root)
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		log.Printf("CreateUploadHandler: decode body error: %v", err)
+		return
+	}
+	if req.Size <= 0 {
+		http.Error(w, "size harus lebih dari 0", http.StatusBadRequest)
+		return
+	}
+
+	// Tipe dari browser hanya petunjuk awal; isi file tetap dicek ulang saat chunk pertama dan merge
+	if t, ok := filePolicy.Lookup(req.Filename); ok && !t.AcceptsDeclaredMIME(req.MIMEType) {
+		http.Error(w, fmt.Sprintf("Tipe file tidak diizinkan: %s", req.MIMEType), http.StatusBadRequest)
+		return
+	}
+
+	sess, err := newUploadSession(p, req.Folder, req.Filename, req.Size, negotiateChunkSize(req.ChunkSize))
+	if err != nil {
+		writeSessionError(w, err)
+		log.Printf("CreateUploadHandler: ditolak user=%s filename=%q size=%d: %v", p.Username, req.Filename, req.Size, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"upload_id":    sess.ID,
+		"filename":     sess.Filename,
+		"size":         sess.TotalSize,
+		"chunk_size":   sess.ChunkSize,
+		"total_chunks": sess.TotalChunks,
+		"expires_at":   sess.expiresAt(),
+	})
+	log.Printf("CreateUploadHandler: user=%s id=%s filename=%s size=%d chunks=%d", p.Username, sess.ID, sess.Filename, sess.TotalSize, sess.TotalChunks)
+}
 
 // -------------------------
 // Upload chunk handler
 // -------------------------
 func UploadChunkHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	if maxChunkSize > 0 {
+		// Sisakan sedikit ruang untuk field form lain selain chunk
+		r.Body = http.MaxBytesReader(w, r.Body, maxChunkSize+1<<20)
+	}
+
 	uploadID := r.FormValue("upload_id")
 	chunkIndex := r.FormValue("chunk_index")
-	totalChunks := r.FormValue("total_chunks")
-	filename := r.FormValue("filename")
 
-	if uploadID == "" || chunkIndex == "" || totalChunks == "" || filename == "" {
+	if uploadID == "" || chunkIndex == "" {
 		http.Error(w, "Parameter tidak lengkap", http.StatusBadRequest)
-		log.Printf("UploadChunkHandler: missing param upload_id=%q chunk_index=%q total_chunks=%q filename=%q", uploadID, chunkIndex, totalChunks, filename)
+		log.Printf("UploadChunkHandler: missing param upload_id=%q chunk_index=%q", uploadID, chunkIndex)
 		return
 	}
 
-	// Validasi ekstensi (tambahkan .deb)
-	ext := strings.ToLower(filepath.Ext(filename))
-	allowedExt := map[string]bool{
-		".jpg": true, ".png": true, ".pdf": true, ".mp4": true, ".iso": true, ".deb": true,
+	// upload_id dipakai sebagai nama folder, jadi tidak boleh mengandung path
+	chunkDir, err := safeJoin(chunkTempDir, uploadID)
+	if err != nil {
+		http.Error(w, "upload_id tidak valid", http.StatusBadRequest)
+		log.Printf("UploadChunkHandler: upload_id ditolak %q", uploadID)
+		return
 	}
-	if !allowedExt[ext] {
-		http.Error(w, "Ekstensi file tidak diizinkan", http.StatusBadRequest)
-		log.Printf("UploadChunkHandler: disallowed extension %s for filename %s", ext, filename)
+
+	// Sesi dibuat lebih dulu lewat POST /uploads; nama file, jumlah dan ukuran chunk diambil dari sana
+	sess, err := getOwnedSession(uploadID, p.Username)
+	if err != nil {
+		writeSessionError(w, err)
+		log.Printf("UploadChunkHandler: sesi %s (user=%s): %v", uploadID, p.Username, err)
+		return
+	}
+	if sess.Status != SessionActive {
+		writeSessionError(w, errSessionNotActive)
+		return
+	}
+	// Kuota bisa diturunkan admin setelah sesi dibuat; cek ulang sebelum menerima data
+	if err := checkQuota(p.Username, sess.TotalSize, sess.ID); err != nil {
+		writeSessionError(w, err)
+		log.Printf("UploadChunkHandler: kuota user=%s uploadID=%s: %v", p.Username, uploadID, err)
 		return
 	}
 
-	// Buat folder sementara (jika belum ada)
-	chunkDir := filepath.Join(chunkTempDir, uploadID)
-	if err := os.MkdirAll(chunkDir, 0755); err != nil {
-		http.Error(w, "Gagal buat folder sementara", http.StatusInternalServerError)
-		log.Printf("UploadChunkHandler: gagal mkdir %s: %v", chunkDir, err)
+	index, err := strconv.Atoi(chunkIndex)
+	if err != nil || index < 0 || index >= sess.TotalChunks {
+		http.Error(w, "chunk_index tidak valid", http.StatusBadRequest)
+		log.Printf("UploadChunkHandler: chunk_index ditolak %q", chunkIndex)
+		return
+	}
+	chunkIndex = strconv.Itoa(index) // bentuk kanonik, "007" → "7"
+
+	// Checksum opsional per chunk (browser tanpa crypto.subtle tidak bisa menghitungnya)
+	expectedSum, err := normalizeSHA256(r.FormValue("chunk_sha256"))
+	if err != nil {
+		http.Error(w, "chunk_sha256 tidak valid", http.StatusBadRequest)
+		return
+	}
+
+	// Kebijakan dicek ulang: config (dan role user) bisa berubah setelah sesi dibuat
+	ftype, err := filePolicy.Check(p.Roles, sess.Filename, sess.TotalSize)
+	if err != nil {
+		writeSessionError(w, err)
+		log.Printf("UploadChunkHandler: tipe %s ditolak (user=%s): %v", sess.Filename, p.Username, err)
 		return
 	}
 
 	// Ambil chunk dari form-data
-	file, _, err := r.FormFile("chunk")
+	file, header, err := r.FormFile("chunk")
 	if err != nil {
+		if isBodyTooLarge(err) {
+			http.Error(w, "Ukuran chunk melebihi batas", http.StatusRequestEntityTooLarge)
+			return
+		}
 		http.Error(w, "Chunk tidak ditemukan", http.StatusBadRequest)
 		log.Printf("UploadChunkHandler: FormFile error: %v", err)
 		return
 	}
 	defer file.Close()
 
-	// Cek MIME hanya di chunk pertama (index == "0")
-	if chunkIndex == "0" {
-		fileHeader := make([]byte, 512)
-		n, err := file.Read(fileHeader)
-		if err != nil && err != io.EOF {
-			http.Error(w, "Gagal baca chunk untuk validasi", http.StatusInternalServerError)
-			log.Printf("UploadChunkHandler: gagal read header chunk: %v", err)
-			return
-		}
-		filetype := http.DetectContentType(fileHeader[:n])
-
-		allowedTypes := map[string]bool{
-			"image/jpeg":                            true,
-			"image/png":                             true,
-			"application/pdf":                       true,
-			"video/mp4":                             true,
-			"application/x-iso9660-image":           true,
-			"application/vnd.debian.binary-package": true,
-			"application/x-debian-package":          true,
-		}
+	// Ukuran dicek sebelum menulis supaya chunk tidak menimpa wilayah chunk sebelahnya
+	want := sess.expectedChunkSize(index)
+	if header.Size != want {
+		http.Error(w, fmt.Sprintf("Ukuran chunk %s harus %d byte, diterima %d", chunkIndex, want, header.Size), http.StatusBadRequest)
+		log.Printf("UploadChunkHandler: ukuran salah uploadID=%s chunk=%s want=%d got=%d", uploadID, chunkIndex, want, header.Size)
+		return
+	}
 
-		if !allowedTypes[filetype] {
-			// Khusus application/octet-stream, izinkan hanya jika ekstensi .deb
-			if filetype == "application/octet-stream" && ext == ".deb" {
-				// Lolos, ini file .deb yang deteksi-nya generic binary
-			} else {
-				http.Error(w, fmt.Sprintf("Tipe file tidak diizinkan: %s", filetype), http.StatusBadRequest)
-				return
-			}
+	// Isi dicek lebih awal di chunk pertama kalau chunk itu sudah memuat semua byte yang
+	// dicocokkan (signature bisa jauh dari awal file); merge tetap mengecek ulang file utuhnya
+	if index == 0 && (header.Size >= int64(filePolicy.headLen) || sess.TotalChunks == 1) {
+		if err := filePolicy.CheckHead(ftype, file); err != nil {
+			writeSessionError(w, err)
+			log.Printf("UploadChunkHandler: isi %s tidak sesuai tipe %s: %v", sess.Filename, ftype.Name, err)
+			return
 		}
+	}
 
-		// Reset posisi file agar penulisan chunk tidak kehilangan data
-		if seeker, ok := file.(io.Seeker); ok {
-			_, _ = seeker.Seek(0, io.SeekStart)
-		}
+	// Status dibaca ulang di bawah lock: merge yang sudah mulai memegang lock penuh,
+	// jadi chunk tidak bisa lagi mengubah file data yang sedang di-hash
+	lock := sessionLock(uploadID)
+	lock.RLock()
+	defer lock.RUnlock()
+	if sess, err = getOwnedSession(uploadID, p.Username); err != nil {
+		writeSessionError(w, err)
+		return
+	}
+	if sess.Status != SessionActive {
+		writeSessionError(w, errSessionNotActive)
+		return
 	}
 
-	// Simpan chunk ke disk
-	chunkPath := filepath.Join(chunkDir, chunkIndex)
-	out, err := os.Create(chunkPath)
+	// Tulis langsung di offset-nya pada file data sesi sambil dihitung sha256-nya.
+	// Chunk lain boleh ditulis paralel karena wilayahnya tidak tumpang tindih.
+	// Bit chunk dimatikan dulu: kiriman ulang yang gagal di tengah jalan (tulis atau checksum)
+	// sudah menimpa isi lama, jadi chunk ini harus dianggap belum diterima sampai berhasil.
+	if err := setChunkReceived(uploadID, index, false); err != nil {
+		writeSessionError(w, err)
+		log.Printf("UploadChunkHandler: gagal reset chunk %d sesi %s: %v", index, uploadID, err)
+		return
+	}
+	dataPath := filepath.Join(chunkDir, sessionDataFile)
+	out, err := os.OpenFile(dataPath, os.O_WRONLY, 0644)
 	if err != nil {
 		http.Error(w, "Gagal menyimpan chunk", http.StatusInternalServerError)
-		log.Printf("UploadChunkHandler: gagal create chunk file %s: %v", chunkPath, err)
+		log.Printf("UploadChunkHandler: gagal buka file data %s: %v", dataPath, err)
 		return
 	}
-	defer out.Close()
 
-	if _, err := io.Copy(out, file); err != nil {
+	hasher := sha256.New()
+	dst := io.NewOffsetWriter(out, sess.chunkOffset(index))
+	written, err := io.Copy(io.MultiWriter(dst, hasher), io.LimitReader(file, want))
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && written != want {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
 		http.Error(w, "Gagal menulis chunk", http.StatusInternalServerError)
-		log.Printf("UploadChunkHandler: gagal tulis chunk %s: %v", chunkPath, err)
+		log.Printf("UploadChunkHandler: gagal tulis chunk %s uploadID=%s: %v", chunkIndex, uploadID, err)
 		return
 	}
 
-	// Simpan meta.json (dipakai untuk merge & resume)
-	metaPath := filepath.Join(chunkDir, "meta.json")
-	meta := map[string]string{
-		"filename":     filename,
-		"total_chunks": totalChunks,
+	actualSum := hex.EncodeToString(hasher.Sum(nil))
+	if expectedSum != "" && expectedSum != actualSum {
+		http.Error(w, fmt.Sprintf("Checksum chunk %s tidak cocok, kirim ulang", chunkIndex), http.StatusUnprocessableEntity)
+		log.Printf("UploadChunkHandler: checksum mismatch uploadID=%s chunk=%s expected=%s actual=%s", uploadID, chunkIndex, expectedSum, actualSum)
+		return
 	}
-	if metaJSON, err := json.MarshalIndent(meta, "", "  "); err == nil {
-		_ = os.WriteFile(metaPath, metaJSON, 0644)
-	} else {
-		log.Printf("UploadChunkHandler: gagal tulis meta.json untuk %s: %v", chunkDir, err)
+
+	if err := setChunkReceived(uploadID, index, true); err != nil {
+		writeSessionError(w, err)
+		log.Printf("UploadChunkHandler: gagal update sesi %s chunk %d: %v", uploadID, index, err)
+		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprint(w, "Chunk disimpan")
-	log.Printf("UploadChunkHandler: saved chunk %s (uploadID=%s)", chunkPath, uploadID)
+	log.Printf("UploadChunkHandler: saved chunk %s (uploadID=%s)", chunkIndex, uploadID)
 }
 
 // -------------------------
 // Merge chunks into final file
 // -------------------------
 func MergeChunksHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+	username := p.Username
+
+	// Nama file diambil dari sesi (ditetapkan saat POST /uploads), bukan dari request merge
 	var req struct {
 		UploadID string `json:"uploadId"`
-		Filename string `json:"filename"`
+		SHA256   string `json:"sha256"` // opsional: checksum seluruh file dari client
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Bad request", http.StatusBadRequest)
@@ -152,119 +273,179 @@ func MergeChunksHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.UploadID == "" || req.Filename == "" {
+	if req.UploadID == "" {
 		http.Error(w, "Parameter tidak lengkap", http.StatusBadRequest)
-		log.Printf("MergeChunksHandler: missing params uploadId=%q filename=%q", req.UploadID, req.Filename)
+		log.Printf("MergeChunksHandler: missing param uploadId")
 		return
 	}
 
-	chunkDir := filepath.Join(chunkTempDir, req.UploadID)
-	metaPath := filepath.Join(chunkDir, "meta.json")
+	expectedSum, err := normalizeSHA256(req.SHA256)
+	if err != nil {
+		http.Error(w, "sha256 tidak valid", http.StatusBadRequest)
+		return
+	}
 
-	metaBytes, err := os.ReadFile(metaPath)
+	chunkDir, err := safeJoin(chunkTempDir, req.UploadID)
 	if err != nil {
-		http.Error(w, "Gagal membaca meta.json", http.StatusInternalServerError)
-		log.Printf("MergeChunksHandler: failed read meta.json %s: %v", metaPath, err)
+		http.Error(w, "uploadId tidak valid", http.StatusBadRequest)
+		log.Printf("MergeChunksHandler: uploadId ditolak %q", req.UploadID)
 		return
 	}
 
-	var meta struct {
-		TotalChunks string `json:"total_chunks"`
-		Filename    string `json:"filename"`
+	// Tunggu chunk yang sedang ditulis selesai; selama merge tidak ada chunk baru yang masuk
+	lock := sessionLock(req.UploadID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	sess, err := getOwnedSession(req.UploadID, username)
+	if err != nil {
+		writeSessionError(w, err)
+		log.Printf("MergeChunksHandler: sesi %s (user=%s): %v", req.UploadID, username, err)
+		return
 	}
-	if err := json.Unmarshal(metaBytes, &meta); err != nil {
-		http.Error(w, "Meta.json rusak", http.StatusInternalServerError)
-		log.Printf("MergeChunksHandler: unmarshal meta.json error: %v", err)
+
+	// Tandai sesi sedang di-merge; merge kedua untuk sesi yang sama langsung ditolak
+	if err := setSessionStatus(sess.ID, SessionActive, SessionMerging); err != nil {
+		writeSessionError(w, err)
 		return
 	}
+	merged := false
+	defer func() {
+		if !merged {
+			if err := setSessionStatus(sess.ID, SessionMerging, SessionActive); err != nil {
+				log.Printf("MergeChunksHandler: gagal kembalikan status sesi %s: %v", sess.ID, err)
+			}
+		}
+	}()
 
-	totalChunks, err := strconv.Atoi(meta.TotalChunks)
+	// Validasi kebijakan tipe file (sama seperti UploadChunkHandler)
+	ftype, err := filePolicy.Check(p.Roles, sess.Filename, sess.TotalSize)
 	if err != nil {
-		http.Error(w, "Jumlah chunk tidak valid", http.StatusInternalServerError)
-		log.Printf("MergeChunksHandler: invalid total_chunks %s: %v", meta.TotalChunks, err)
+		writeSessionError(w, err)
+		log.Printf("MergeChunksHandler: tipe %s ditolak (user=%s): %v", sess.Filename, username, err)
 		return
 	}
 
-	// Validasi ekstensi final (sama seperti UploadChunkHandler)
-	ext := strings.ToLower(filepath.Ext(meta.Filename))
-	allowed := map[string]bool{
-		".jpg": true, ".png": true, ".pdf": true, ".mp4": true, ".iso": true, ".deb": true,
+	// Pastikan semua chunk 0..N-1 sudah diterima; ukurannya sudah dicek saat chunk ditulis
+	missing, err := checkChunks(chunkDir, sess)
+	if err != nil {
+		http.Error(w, "Gagal memeriksa chunk", http.StatusInternalServerError)
+		log.Printf("MergeChunksHandler: gagal cek chunk %s: %v", chunkDir, err)
+		return
 	}
-	if !allowed[ext] {
-		http.Error(w, "Ekstensi file tidak diizinkan", http.StatusBadRequest)
-		log.Printf("MergeChunksHandler: disallowed extension %s for %s", ext, meta.Filename)
+	if len(missing) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":        "Chunk belum lengkap",
+			"total_chunks": sess.TotalChunks,
+			"missing":      missing,
+		})
+		log.Printf("MergeChunksHandler: uploadID=%s belum lengkap, missing=%v", req.UploadID, missing)
 		return
 	}
 
-	// Siapkan nama target (rename otomatis jika ada)
-	baseName := strings.TrimSuffix(meta.Filename, ext)
-	outputFilePath := filepath.Join(uploadPath, meta.Filename)
-	i := 1
-	for {
-		if _, err := os.Stat(outputFilePath); os.IsNotExist(err) {
-			break
-		}
-		outputFilePath = filepath.Join(uploadPath, fmt.Sprintf("%s_%d%s", baseName, i, ext))
-		i++
+	if err := checkQuota(username, sess.TotalSize, sess.ID); err != nil {
+		writeSessionError(w, err)
+		log.Printf("MergeChunksHandler: kuota user=%s uploadID=%s: %v", username, req.UploadID, err)
+		return
 	}
-	finalFilename := filepath.Base(outputFilePath)
 
-	// Gabungkan semua chunk
-	dst, err := os.Create(outputFilePath)
+	// Semua chunk sudah berada di posisinya dalam file data, jadi merge cukup
+	// mengecek isinya, menghitung checksum lalu memindahkan file itu ke storage milik user
+	dataPath := filepath.Join(chunkDir, sessionDataFile)
+	if err := filePolicy.CheckContentFile(ftype, dataPath); err != nil {
+		if errors.Is(err, errTypeNotAllowed) {
+			// File utuh gagal validasi: dikarantina dan sesinya ditutup, tidak bisa di-merge ulang
+			quarantineSession(sess, chunkDir, err)
+			merged = true
+		}
+		writeSessionError(w, err)
+		log.Printf("MergeChunksHandler: isi %s tidak sesuai tipe %s: %v", sess.Filename, ftype.Name, err)
+		return
+	}
+	version, fileSum, err := storeUploadFile(r.Context(), username, sess.Filename, dataPath, expectedSum, FileMeta{OriginalName: sess.OriginalName})
+	var mismatch *checksumMismatchError
+	if errors.As(err, &mismatch) {
+		http.Error(w, fmt.Sprintf("Checksum file tidak cocok (server: %s)", mismatch.Actual), http.StatusUnprocessableEntity)
+		log.Printf("MergeChunksHandler: checksum mismatch uploadID=%s expected=%s actual=%s", req.UploadID, mismatch.Expected, mismatch.Actual)
+		return
+	}
 	if err != nil {
-		http.Error(w, "Gagal buat file akhir", http.StatusInternalServerError)
-		log.Printf("MergeChunksHandler: gagal create dst %s: %v", outputFilePath, err)
+		http.Error(w, "Gagal tulis file akhir", http.StatusInternalServerError)
+		log.Printf("MergeChunksHandler: gagal simpan %s: %v", sess.Filename, err)
 		return
 	}
-	defer dst.Close()
 
-	for i := 0; i < totalChunks; i++ {
-		partPath := filepath.Join(chunkDir, fmt.Sprintf("%d", i))
-		part, err := os.Open(partPath)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Gagal buka chunk %d", i), http.StatusInternalServerError)
-			log.Printf("MergeChunksHandler: failed open part %s: %v", partPath, err)
-			return
-		}
-		if _, err := io.Copy(dst, part); err != nil {
-			part.Close()
-			http.Error(w, fmt.Sprintf("Gagal tulis chunk %d", i), http.StatusInternalServerError)
-			log.Printf("MergeChunksHandler: failed copy part %s: %v", partPath, err)
-			return
-		}
-		part.Close()
+	// Hapus folder chunk sementara; catatan sesi disimpan sebagai "completed" sampai dibersihkan cleaner
+	merged = true
+	if err := setSessionStatus(sess.ID, SessionMerging, SessionCompleted); err != nil {
+		log.Printf("MergeChunksHandler: gagal tandai sesi %s selesai: %v", sess.ID, err)
 	}
-
-	// Hapus folder chunk sementara
 	if err := os.RemoveAll(chunkDir); err != nil {
 		log.Printf("MergeChunksHandler: warning: gagal hapus chunkDir %s: %v", chunkDir, err)
 	}
+	sessionLocks.Delete(req.UploadID)
 
-	// Ambil username dari token (jika ada)
-	authHeader := r.Header.Get("Authorization")
-	tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
-	username := ""
-	if tokenStr != "" {
-		claims := &Claims{}
-		if _, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-			return jwtKey, nil
-		}); err == nil {
-			username = claims.Username
-		} else {
-			log.Printf("MergeChunksHandler: token parse warning: %v", err)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":  "Merge selesai!",
+		"filename": sess.Filename,
+		"version":  version,
+		"sha256":   fileSum,
+	})
+	log.Printf("MergeChunksHandler: merged uploadID=%s -> %s v%d (user=%s)", req.UploadID, sess.Filename, version, username)
+}
+
+// checkChunks mengembalikan index chunk yang belum diterima menurut bitmap sesi,
+// sekaligus memastikan file data sesi masih ada dengan ukuran penuh
+func checkChunks(chunkDir string, sess *UploadSession) ([]int, error) {
+	missing := []int{}
+	for i := 0; i < sess.TotalChunks; i++ {
+		if !sess.hasChunk(i) {
+			missing = append(missing, i)
 		}
 	}
 
-	// Simpan metadata ke DB (jika DB tersedia)
-	if DB != nil {
-		if _, err := DB.Exec("INSERT INTO uploads (filename, username, uploaded_at) VALUES (?, ?, ?)", finalFilename, username, time.Now()); err != nil {
-			log.Printf("MergeChunksHandler: gagal simpan metadata ke DB: %v", err)
-			// tidak fatal untuk user; tetap return success merge
-		}
+	fi, err := os.Stat(filepath.Join(chunkDir, sessionDataFile))
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() != sess.TotalSize {
+		return nil, fmt.Errorf("ukuran file data %d, seharusnya %d", fi.Size(), sess.TotalSize)
 	}
+	return missing, nil
+}
 
-	fmt.Fprint(w, "Merge selesai!")
-	log.Printf("MergeChunksHandler: merged uploadID=%s -> %s (user=%s)", req.UploadID, finalFilename, username)
+// writeSessionError memetakan error sesi upload ke status HTTP
+func writeSessionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errUnsafePath):
+		http.Error(w, "Nama file tidak valid", http.StatusBadRequest)
+	case errors.Is(err, errExtensionNotAllowed):
+		http.Error(w, "Ekstensi file tidak diizinkan", http.StatusBadRequest)
+	case errors.Is(err, errTypeNotAllowed):
+		msg := "Isi file tidak sesuai tipe yang diizinkan"
+		var ce *contentError
+		if errors.As(err, &ce) {
+			msg += ": " + ce.Reason
+		}
+		http.Error(w, msg, http.StatusBadRequest)
+	case errors.Is(err, errTypeForbidden):
+		http.Error(w, "Tipe file tidak diizinkan untuk akun ini", http.StatusForbidden)
+	case errors.Is(err, errFileTooLarge):
+		http.Error(w, "Ukuran file melebihi batas", http.StatusRequestEntityTooLarge)
+	case errors.Is(err, errFileExceedsQuota), errors.Is(err, errQuotaExceeded):
+		writeQuotaError(w, err)
+	case errors.Is(err, errSessionNotFound):
+		http.Error(w, "Upload tidak ditemukan", http.StatusNotFound)
+	case errors.Is(err, errFolderNotFound):
+		http.Error(w, "Folder tujuan tidak ditemukan", http.StatusNotFound)
+	case errors.Is(err, errSessionMismatch), errors.Is(err, errSessionNotActive):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, "Gagal membaca sesi upload", http.StatusInternalServerError)
+	}
 }
 
 // -------------------------
@@ -275,6 +456,10 @@ func CancelUploadHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	p, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
 
 	var req struct {
 		UploadID string `json:"uploadId"`
@@ -285,7 +470,28 @@ func CancelUploadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	chunkDir := filepath.Join(chunkTempDir, req.UploadID)
+	chunkDir, err := safeJoin(chunkTempDir, req.UploadID)
+	if err != nil {
+		http.Error(w, "uploadId tidak valid", http.StatusBadRequest)
+		log.Printf("CancelUploadHandler: uploadId ditolak %q", req.UploadID)
+		return
+	}
+	lock := sessionLock(req.UploadID)
+	lock.Lock()
+	defer lock.Unlock()
+	if _, err := getOwnedSession(req.UploadID, p.Username); err != nil {
+		writeSessionError(w, err)
+		return
+	}
+	// Sesi yang sedang di-merge tidak boleh dibatalkan di tengah jalan
+	if err := setSessionStatus(req.UploadID, SessionActive, SessionCancelled); err != nil {
+		writeSessionError(w, err)
+		return
+	}
+	if err := deleteUploadSession(req.UploadID); err != nil {
+		log.Printf("CancelUploadHandler: gagal hapus sesi %s: %v", req.UploadID, err)
+	}
+	sessionLocks.Delete(req.UploadID)
 	if err := os.RemoveAll(chunkDir); err != nil {
 		http.Error(w, "Gagal menghapus chunk", http.StatusInternalServerError)
 		log.Printf("CancelUploadHandler: failed removeAll %s: %v", chunkDir, err)
@@ -301,36 +507,29 @@ func CancelUploadHandler(w http.ResponseWriter, r *http.Request) {
 // Resume upload: list chunk files already uploaded
 // -------------------------
 func ResumeUploadHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
 	uploadID := r.URL.Query().Get("upload_id")
 	if uploadID == "" {
 		http.Error(w, "upload_id kosong", http.StatusBadRequest)
 		return
 	}
-
-	chunkDir := filepath.Join(chunkTempDir, uploadID)
-	// Jika folder belum ada, kembalikan array kosong (upload baru)
-	if _, err := os.Stat(chunkDir); os.IsNotExist(err) {
-		json.NewEncoder(w).Encode([]string{})
-		log.Printf("ResumeUploadHandler: chunkDir not exist for uploadID=%s, returning empty list", uploadID)
+	if _, err := cleanName(uploadID); err != nil {
+		http.Error(w, "upload_id tidak valid", http.StatusBadRequest)
 		return
 	}
 
-	files, err := os.ReadDir(chunkDir)
+	// Sesi selalu dibuat lewat POST /uploads, jadi ID yang tidak dikenal → 404
+	sess, err := getOwnedSession(uploadID, p.Username)
 	if err != nil {
-		http.Error(w, "Gagal membaca chunk", http.StatusInternalServerError)
-		log.Printf("ResumeUploadHandler: ReadDir %s error: %v", chunkDir, err)
+		writeSessionError(w, err)
+		log.Printf("ResumeUploadHandler: sesi %s error: %v", uploadID, err)
 		return
 	}
 
-	var uploaded []string
-	for _, f := range files {
-		// Abaikan meta.json
-		if strings.HasSuffix(f.Name(), ".json") {
-			continue
-		}
-		uploaded = append(uploaded, f.Name())
-	}
-
+	uploaded := receivedChunkNames(sess)
 	json.NewEncoder(w).Encode(uploaded)
 	log.Printf("ResumeUploadHandler: uploadID=%s returned %d uploaded chunks", uploadID, len(uploaded))
 }
@@ -339,28 +538,38 @@ func ResumeUploadHandler(w http.ResponseWriter, r *http.Request) {
 // Chunk status (mirip Resume, list yang diterima)
 // -------------------------
 func ChunkStatusHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
 	uploadID := r.URL.Query().Get("upload_id")
 	if uploadID == "" {
 		http.Error(w, "upload_id kosong", http.StatusBadRequest)
 		return
 	}
 
-	chunkDir := filepath.Join(chunkTempDir, uploadID)
-	files, err := os.ReadDir(chunkDir)
+	sess, err := getOwnedSession(uploadID, p.Username)
 	if err != nil {
-		http.Error(w, "Gagal membaca folder chunk", http.StatusInternalServerError)
-		log.Printf("ChunkStatusHandler: ReadDir %s error: %v", chunkDir, err)
+		writeSessionError(w, err)
 		return
 	}
 
-	var received []string
-	for _, f := range files {
-		if f.Name() != "meta.json" {
-			received = append(received, f.Name())
-		}
+	json.NewEncoder(w).Encode(receivedChunkNames(sess))
+}
+
+// receivedChunkNames: index chunk yang sudah diterima dalam bentuk string,
+// format lama /resume dan /resume-status yang dipakai upload.js
+func receivedChunkNames(sess *UploadSession) []string {
+	names := []string{}
+	for _, i := range sess.receivedChunks() {
+		names = append(names, strconv.Itoa(i))
 	}
+	return names
+}
 
-	json.NewEncoder(w).Encode(received)
+func isBodyTooLarge(err error) bool {
+	var maxErr *http.MaxBytesError
+	return errors.As(err, &maxErr)
 }
 
 // -------------------------
@@ -391,68 +600,99 @@ func UploadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	authHeader := r.Header.Get("Authorization")
-	if !strings.HasPrefix(authHeader, "Bearer ") {
-		http.Error(w, "Token tidak valid", http.StatusUnauthorized)
+	p, ok := currentPrincipal(w, r)
+	if !ok {
 		return
 	}
-	tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
+	username := p.Username
 
-	claims := &Claims{}
-	if _, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtKey, nil
-	}); err != nil {
-		http.Error(w, "Token tidak sah", http.StatusUnauthorized)
-		log.Printf("UploadHandler: token parse failed: %v", err)
-		return
+	if maxUploadSize > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize+1<<20)
 	}
-	username := claims.Username
 
 	file, header, err := r.FormFile("file")
 	if err != nil {
+		if isBodyTooLarge(err) {
+			http.Error(w, "Ukuran file melebihi batas", http.StatusRequestEntityTooLarge)
+			return
+		}
 		http.Error(w, "File tidak ditemukan", http.StatusBadRequest)
 		log.Printf("UploadHandler: FormFile error: %v", err)
 		return
 	}
 	defer file.Close()
 
-	filename := header.Filename
-	safeName := filepath.Base(filename)
+	expectedSum, err := normalizeSHA256(r.FormValue("sha256"))
+	if err != nil {
+		http.Error(w, "sha256 tidak valid", http.StatusBadRequest)
+		return
+	}
 
-	// Rename otomatis jika sudah ada
-	dstPath := filepath.Join(uploadPath, safeName)
-	originalName := safeName
-	i := 1
-	for {
-		if _, err := os.Stat(dstPath); os.IsNotExist(err) {
-			break
-		}
-		safeName = fmt.Sprintf("%s_(%d)%s", strings.TrimSuffix(originalName, filepath.Ext(originalName)), i, filepath.Ext(originalName))
-		dstPath = filepath.Join(uploadPath, safeName)
-		i++
+	// Browser kadang mengirim path lengkap; ambil nama file-nya saja lalu validasi
+	safeName, err := sanitizeUploadName(header.Filename)
+	if err != nil {
+		http.Error(w, "Nama file tidak valid", http.StatusBadRequest)
+		log.Printf("UploadHandler: filename ditolak %q", header.Filename)
+		return
 	}
+	// Folder tujuan opsional (field "folder"), harus sudah ada
+	folder, err := uploadFolder(username, r.FormValue("folder"))
+	if err != nil {
+		writeSessionError(w, err)
+		log.Printf("UploadHandler: folder %q ditolak (user=%s): %v", r.FormValue("folder"), username, err)
+		return
+	}
+	safeName = joinPath(folder, safeName)
 
-	dst, err := os.Create(dstPath)
+	// Upload biasa melewati kebijakan tipe yang sama dengan upload chunk
+	ftype, err := filePolicy.Check(p.Roles, safeName, header.Size)
 	if err != nil {
-		http.Error(w, "Gagal menyimpan file", http.StatusInternalServerError)
-		log.Printf("UploadHandler: create dst %s error: %v", dstPath, err)
+		writeSessionError(w, err)
+		log.Printf("UploadHandler: %s ditolak (user=%s): %v", safeName, username, err)
 		return
 	}
-	defer dst.Close()
-	if _, err := io.Copy(dst, file); err != nil {
-		http.Error(w, "Gagal menyimpan file", http.StatusInternalServerError)
-		log.Printf("UploadHandler: copy to dst %s error: %v", dstPath, err)
+
+	// Kuota dicek sebelum isi divalidasi: file yang ditolak pun masuk karantina atas nama user ini.
+	// Upload paralel bisa sama-sama lolos di sini, jadi dicek ulang saat versinya dicatat.
+	if err := checkQuota(username, header.Size, ""); err != nil {
+		if !writeQuotaError(w, err) {
+			http.Error(w, "Gagal cek kuota", http.StatusInternalServerError)
+		}
+		log.Printf("UploadHandler: kuota user=%s size=%d: %v", username, header.Size, err)
 		return
 	}
 
-	if DB != nil {
-		if _, err := DB.Exec("INSERT INTO uploads (filename, username, uploaded_at) VALUES (?, ?, ?)", safeName, username, time.Now()); err != nil {
-			log.Printf("UploadHandler: gagal simpan metadata ke DB: %v", err)
+	if err := filePolicy.CheckContent(ftype, file, header.Size); err != nil {
+		if errors.Is(err, errTypeNotAllowed) {
+			if qErr := quarantineReader(username, safeName, err, io.NewSectionReader(file, 0, header.Size), header.Size); qErr != nil {
+				log.Printf("UploadHandler: gagal karantina %s: %v", safeName, qErr)
+			}
 		}
+		writeSessionError(w, err)
+		log.Printf("UploadHandler: %s ditolak (user=%s): %v", safeName, username, err)
+		return
+	}
+
+	// Nama yang sudah ada menjadi versi baru dari file yang sama
+	version, _, err := storeUpload(r.Context(), username, safeName, file, expectedSum, FileMeta{OriginalName: header.Filename, CheckQuota: true})
+	var mismatch *checksumMismatchError
+	if errors.As(err, &mismatch) {
+		http.Error(w, fmt.Sprintf("Checksum file tidak cocok (server: %s)", mismatch.Actual), http.StatusUnprocessableEntity)
+		log.Printf("UploadHandler: checksum mismatch %s expected=%s actual=%s", safeName, mismatch.Expected, mismatch.Actual)
+		return
+	}
+	if writeQuotaError(w, err) {
+		log.Printf("UploadHandler: kuota user=%s size=%d saat dicatat: %v", username, header.Size, err)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Gagal menyimpan file", http.StatusInternalServerError)
+		log.Printf("UploadHandler: gagal simpan %s: %v", safeName, err)
+		return
 	}
 
-	fmt.Fprintf(w, "Upload sukses: %s\n", safeName)
-	log.Printf("UploadHandler: user=%s uploaded %s", username, safeName)
+	fmt.Fprintf(w, "Upload sukses: %s (versi %d)\n", safeName, version)
+	log.Printf("UploadHandler: user=%s uploaded %s v%d", username, safeName, version)
 }
 
 // -------------------------
@@ -460,21 +700,104 @@ func UploadHandler(w http.ResponseWriter, r *http.Request) {
 // -------------------------
 func DownloadHandler(w http.ResponseWriter, r *http.Request) {
 	// Handler ini di-wrap oleh requireAuth di main.go sehingga token sudah tervalidasi
+	p, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
 	filename := r.URL.Query().Get("file")
 	if filename == "" {
 		http.Error(w, "Parameter file kosong", http.StatusBadRequest)
 		return
 	}
+	filename, err := cleanFilePath(filename)
+	if err != nil {
+		http.Error(w, "Nama file tidak valid", http.StatusBadRequest)
+		log.Printf("DownloadHandler: filename ditolak %q", r.URL.Query().Get("file"))
+		return
+	}
+
+	version, err := parseVersionParam(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	fullPath := filepath.Join(uploadPath, filename)
-	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
+	// Hanya pemilik atau user dengan hak akses (lihat acl.go) yang boleh mengunduh,
+	// dan hanya setelah lolos pemindaian
+	owner := fileOwnerParam(r, p)
+	perm, err := filePermission(p.Username, owner, filename)
+	if err != nil {
+		http.Error(w, "Gagal cek hak akses", http.StatusInternalServerError)
+		log.Printf("DownloadHandler: DB error: %v", err)
+		return
+	}
+	if !permits(perm, PermRead) {
+		writeAccessDenied(w, perm)
+		log.Printf("DownloadHandler: user=%s tidak punya akses ke %s milik %s", p.Username, filename, owner)
+		return
+	}
+	upload, err := getUpload(owner, filename, version)
+	if errors.Is(err, errFileNotFound) || (err == nil && upload.Blob == "") {
 		http.Error(w, "File tidak ditemukan", http.StatusNotFound)
-		log.Printf("DownloadHandler: file not found %s", fullPath)
+		log.Printf("DownloadHandler: %s milik %s tidak ditemukan", filename, owner)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Gagal cek kepemilikan file", http.StatusInternalServerError)
+		log.Printf("DownloadHandler: DB error: %v", err)
+		return
+	}
+	if !checkScanStatus(w, upload) {
+		log.Printf("DownloadHandler: user=%s minta %s berstatus %s", p.Username, filename, upload.Status)
 		return
 	}
 
-	http.ServeFile(w, r, fullPath)
-	log.Printf("DownloadHandler: served %s", fullPath)
+	if serveUpload(w, r, upload) {
+		log.Printf("DownloadHandler: user=%s served %s v%d milik %s", p.Username, filename, upload.Version, owner)
+	}
+}
+
+// checkScanStatus menolak file yang belum lolos pemindaian; false kalau response error sudah ditulis
+func checkScanStatus(w http.ResponseWriter, upload *UploadRecord) bool {
+	switch upload.Status {
+	case ScanPending:
+		w.Header().Set("Retry-After", "10")
+		http.Error(w, "File masih dipindai, coba lagi nanti", http.StatusConflict)
+		return false
+	case ScanInfected:
+		http.Error(w, "File terdeteksi malware dan diblokir", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// serveUpload mengirim isi satu versi file dari blob store; false kalau gagal (response error sudah ditulis)
+func serveUpload(w http.ResponseWriter, r *http.Request, upload *UploadRecord) bool {
+	key := blobKey(upload.Blob)
+	info, err := store.Stat(r.Context(), key)
+	if errors.Is(err, errObjectNotFound) {
+		http.Error(w, "File tidak ditemukan", http.StatusNotFound)
+		log.Printf("serveUpload: blob %s untuk %s tidak ada", key, upload.Filename)
+		return false
+	}
+	if err != nil {
+		http.Error(w, "Gagal membaca file", http.StatusInternalServerError)
+		log.Printf("serveUpload: stat %s error: %v", key, err)
+		return false
+	}
+	// Blob dipakai bersama; waktu modifikasi file ini = waktu upload-nya
+	info.ModTime = upload.UploadedAt
+
+	// Tipe hasil deteksi saat upload; tanpa itu ServeContent menebak dari ekstensi/isi
+	if upload.MIMEType != "" {
+		w.Header().Set("Content-Type", upload.MIMEType)
+	}
+	// ServeContent menangani Range/If-Modified-Since; data dibaca sesuai kebutuhan lewat Storage.Get
+	content := newObjectReadSeeker(r.Context(), store, info)
+	defer content.Close()
+	http.ServeContent(w, r, upload.Filename, info.ModTime, content)
+	return true
 }
 
 // -------------------------
@@ -486,80 +809,76 @@ func DeleteHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	authHeader := r.Header.Get("Authorization")
-	if !strings.HasPrefix(authHeader, "Bearer ") {
-		http.Error(w, "Token tidak valid", http.StatusUnauthorized)
-		return
-	}
-	tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
-
-	claims := &Claims{}
-	if _, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtKey, nil
-	}); err != nil {
-		http.Error(w, "Token tidak valid", http.StatusUnauthorized)
-		log.Printf("DeleteHandler: token parse failed: %v", err)
+	p, ok := currentPrincipal(w, r)
+	if !ok {
 		return
 	}
-	username := claims.Username
+	username := p.Username
 
 	filename := r.URL.Query().Get("file")
 	if filename == "" {
 		http.Error(w, "Nama file tidak ditemukan", http.StatusBadRequest)
 		return
 	}
+	filename, err := cleanFilePath(filename)
+	if err != nil {
+		http.Error(w, "Nama file tidak valid", http.StatusBadRequest)
+		log.Printf("DeleteHandler: filename ditolak %q", r.URL.Query().Get("file"))
+		return
+	}
 
-	// Hapus dari database
-	if DB != nil {
-		res, err := DB.Exec("DELETE FROM uploads WHERE filename = ? AND username = ?", filename, username)
-		if err != nil {
-			http.Error(w, "Gagal hapus dari database", http.StatusInternalServerError)
-			log.Printf("DeleteHandler: DB delete error: %v", err)
-			return
-		}
-		affected, _ := res.RowsAffected()
-		if affected == 0 {
-			http.Error(w, "File tidak ditemukan atau bukan milikmu", http.StatusForbidden)
-			log.Printf("DeleteHandler: no rows affected for %s by %s", filename, username)
-			return
-		}
+	// File milik user lain butuh hak write; masuk ke tempat sampah pemiliknya
+	owner := fileOwnerParam(r, p)
+	perm, err := filePermission(username, owner, filename)
+	if err != nil {
+		http.Error(w, "Gagal cek hak akses", http.StatusInternalServerError)
+		log.Printf("DeleteHandler: DB error: %v", err)
+		return
+	}
+	if !permits(perm, PermWrite) {
+		writeAccessDenied(w, perm)
+		log.Printf("DeleteHandler: user=%s tidak punya izin hapus %s milik %s", username, filename, owner)
+		return
 	}
 
-	// Hapus dari folder
-	if err := os.Remove(filepath.Join(uploadPath, filename)); err != nil && !os.IsNotExist(err) {
-		log.Printf("DeleteHandler: failed remove file %s: %v", filename, err)
-		// tetap return success jika file sudah tidak ada
+	// Semua versi file dipindah ke tempat sampah (lihat trash.go), bisa dipulihkan sampai dikosongkan
+	err = trashUpload(owner, filename)
+	if errors.Is(err, errFileNotFound) {
+		http.Error(w, "File tidak ditemukan atau bukan milikmu", http.StatusForbidden)
+		log.Printf("DeleteHandler: no rows affected for %s milik %s by %s", filename, owner, username)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Gagal hapus file", http.StatusInternalServerError)
+		log.Printf("DeleteHandler: hapus %s error: %v", filename, err)
+		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, "File %s berhasil dihapus", filename)
-	log.Printf("DeleteHandler: user=%s deleted %s", username, filename)
+	fmt.Fprintf(w, "File %s dipindah ke tempat sampah", filename)
+	log.Printf("DeleteHandler: user=%s deleted %s milik %s (ke tempat sampah)", username, filename, owner)
 }
 
 // -------------------------
 // List JSON handler (untuk list.js) - protected by requireAuth wrapper
 // -------------------------
 func ListJSONHandler(w http.ResponseWriter, r *http.Request) {
-	authHeader := r.Header.Get("Authorization")
-	if !strings.HasPrefix(authHeader, "Bearer ") {
-		http.Error(w, "Token tidak valid", http.StatusUnauthorized)
+	p, ok := currentPrincipal(w, r)
+	if !ok {
 		return
 	}
-	tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
-
-	claims := &Claims{}
-	if _, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtKey, nil
-	}); err != nil {
-		http.Error(w, "Token tidak valid", http.StatusUnauthorized)
-		log.Printf("ListJSONHandler: token parse failed: %v", err)
-		return
-	}
-	username := claims.Username
+	username := p.Username
 
 	pageStr := r.URL.Query().Get("page")
 	limitStr := r.URL.Query().Get("limit")
 	dateFilter := r.URL.Query().Get("date")
+	// ?path= membatasi ke file yang langsung berada di folder itu ("" = root);
+	// tanpa parameter path semua file ditampilkan rata dengan path lengkapnya
+	folder, err := cleanPath(r.URL.Query().Get("path"))
+	if err != nil {
+		http.Error(w, "Path tidak valid", http.StatusBadRequest)
+		return
+	}
 
 	page, _ := strconv.Atoi(pageStr)
 	limit, _ := strconv.Atoi(limitStr)
@@ -571,11 +890,13 @@ func ListJSONHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	offset := (page - 1) * limit
 
-	// Build query
+	// Build query (hanya versi aktif tiap file)
 	query := `
-		SELECT filename, uploaded_at
+		SELECT filename, uploaded_at, status, version, COALESCE(size, 0), COALESCE(mime_type, ''), COALESCE(blob_sha256, ''),
+			COALESCE(original_name, ''), COALESCE(storage_key, ''), COALESCE(tags, ''), COALESCE(description, '')
 		FROM uploads
-		WHERE username = ?
+		WHERE username = ? AND deleted_at IS NULL
+		AND version = (SELECT MAX(version) FROM uploads v WHERE v.username = uploads.username AND v.filename = uploads.filename AND v.deleted_at IS NULL)
 	`
 	args := []interface{}{username}
 
@@ -583,6 +904,11 @@ func ListJSONHandler(w http.ResponseWriter, r *http.Request) {
 		query += " AND DATE(uploaded_at) = DATE(?)"
 		args = append(args, dateFilter)
 	}
+	if r.URL.Query().Has("path") {
+		prefix := joinPath(folder, "")
+		query += " AND " + underPath("filename") + " AND instr(substr(filename, length(?) + 1), '/') = 0"
+		args = append(args, prefix, prefix, prefix)
+	}
 
 	query += " ORDER BY uploaded_at DESC LIMIT ? OFFSET ?"
 	args = append(args, limit, offset)
@@ -596,17 +922,29 @@ func ListJSONHandler(w http.ResponseWriter, r *http.Request) {
 	defer rows.Close()
 
 	type Upload struct {
-		Filename   string `json:"filename"`
-		UploadedAt string `json:"uploaded_at"`
+		Filename     string   `json:"filename"`
+		UploadedAt   string   `json:"uploaded_at"`
+		Status       string   `json:"status"` // pending/clean/infected
+		Version      int64    `json:"version"`
+		Size         int64    `json:"size"`
+		MIMEType     string   `json:"mime_type"`
+		SHA256       string   `json:"sha256"`
+		OriginalName string   `json:"original_name"`
+		StorageKey   string   `json:"storage_key"`
+		Tags         []string `json:"tags"`
+		Description  string   `json:"description"`
 	}
 
 	var uploads []Upload
 	for rows.Next() {
 		var u Upload
-		if err := rows.Scan(&u.Filename, &u.UploadedAt); err != nil {
+		var tags string
+		if err := rows.Scan(&u.Filename, &u.UploadedAt, &u.Status, &u.Version, &u.Size, &u.MIMEType, &u.SHA256,
+			&u.OriginalName, &u.StorageKey, &tags, &u.Description); err != nil {
 			log.Printf("ListJSONHandler: row scan error: %v", err)
 			continue
 		}
+		u.Tags = splitTags(tags)
 		uploads = append(uploads, u)
 	}
 
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Pemeriksaan struktur file utuh, dipilih lewat FileType.Validate. Signature di awal file
+// mudah dipalsukan; di sini seluruh struktur kontainernya dibaca dan dicocokkan dengan ukuran file.
+var contentValidators = map[string]func(r io.ReaderAt, size int64) error{
+	"deb": validateDeb,
+	"iso": validateISO,
+	"zip": validateZip,
+}
+
+// contentError: isi file tidak sesuai tipenya (errors.Is(err, errTypeNotAllowed) bernilai true)
+type contentError struct {
+	Type   string
+	Reason string
+}
+
+func (e *contentError) Error() string {
+	return fmt.Sprintf("isi file bukan %s yang valid: %s", e.Type, e.Reason)
+}
+
+func (e *contentError) Unwrap() error { return errTypeNotAllowed }
+
+// -------------------------
+// Paket .deb (arsip ar: debian-binary, control.tar.*, data.tar.*)
+// -------------------------
+const (
+	arMagic      = "!<arch>\n"
+	arHeaderSize = 60
+)
+
+func validateDeb(r io.ReaderAt, size int64) error {
+	fail := func(format string, args ...interface{}) error {
+		return &contentError{Type: "deb", Reason: fmt.Sprintf(format, args...)}
+	}
+
+	magic := make([]byte, len(arMagic))
+	if _, err := r.ReadAt(magic, 0); err != nil || string(magic) != arMagic {
+		return fail("bukan arsip ar")
+	}
+
+	var members []string
+	hdr := make([]byte, arHeaderSize)
+	off := int64(len(arMagic))
+	for off < size {
+		if _, err := r.ReadAt(hdr, off); err != nil {
+			return fail("header member di offset %d terpotong", off)
+		}
+		if string(hdr[58:60]) != "`\n" {
+			return fail("header member di offset %d rusak", off)
+		}
+		name := strings.TrimSuffix(strings.TrimRight(string(hdr[0:16]), " "), "/")
+		n, err := strconv.ParseInt(strings.TrimSpace(string(hdr[48:58])), 10, 64)
+		if err != nil || n < 0 || off+arHeaderSize+n > size {
+			return fail("ukuran member %q tidak valid", name)
+		}
+
+		if len(members) == 0 {
+			version := make([]byte, min(n, 4))
+			if name != "debian-binary" {
+				return fail("member pertama %q, seharusnya debian-binary", name)
+			}
+			if _, err := r.ReadAt(version, off+arHeaderSize); err != nil || !bytes.HasPrefix(version, []byte("2.")) {
+				return fail("versi format debian-binary tidak dikenal")
+			}
+		}
+		members = append(members, name)
+		off += arHeaderSize + n + n%2 // data member di-padding ke byte genap
+	}
+
+	if len(members) < 3 || !strings.HasPrefix(members[1], "control.tar") {
+		return fail("control.tar tidak ditemukan setelah debian-binary")
+	}
+	for _, m := range members[2:] {
+		if strings.HasPrefix(m, "data.tar") {
+			return nil
+		}
+	}
+	return fail("data.tar tidak ditemukan")
+}
+
+// -------------------------
+// Image ISO 9660
+// -------------------------
+const (
+	isoSectorSize      = 2048
+	isoFirstDescriptor = 16 // volume descriptor set dimulai di sektor 16
+	isoMaxDescriptors  = 64
+)
+
+func validateISO(r io.ReaderAt, size int64) error {
+	fail := func(format string, args ...interface{}) error {
+		return &contentError{Type: "iso", Reason: fmt.Sprintf(format, args...)}
+	}
+
+	primary := false
+	buf := make([]byte, isoSectorSize)
+	for i := int64(0); i < isoMaxDescriptors; i++ {
+		off := (isoFirstDescriptor + i) * isoSectorSize
+		if off+isoSectorSize > size {
+			return fail("volume descriptor set tidak lengkap")
+		}
+		if _, err := r.ReadAt(buf, off); err != nil {
+			return fail("gagal baca volume descriptor %d", i)
+		}
+		if string(buf[1:6]) != "CD001" || buf[6] != 1 {
+			return fail("volume descriptor %d rusak", i)
+		}
+
+		switch buf[0] {
+		case 1: // primary volume descriptor
+			blocks := int64(binary.LittleEndian.Uint32(buf[80:84]))
+			blockSize := int64(binary.LittleEndian.Uint16(buf[128:130]))
+			if blockSize == 0 || blocks*blockSize > size {
+				return fail("ukuran volume %d x %d byte melebihi ukuran file %d", blocks, blockSize, size)
+			}
+			primary = true
+		case 255: // terminator
+			if !primary {
+				return fail("primary volume descriptor tidak ditemukan")
+			}
+			return nil
+		}
+	}
+	return fail("terminator volume descriptor tidak ditemukan")
+}
+
+// -------------------------
+// Arsip .zip (central directory harus terbaca utuh)
+// -------------------------
+func validateZip(r io.ReaderAt, size int64) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return &contentError{Type: "zip", Reason: err.Error()}
+	}
+	for _, f := range zr.File {
+		if _, err := f.DataOffset(); err != nil {
+			return &contentError{Type: "zip", Reason: fmt.Sprintf("entry %q: %v", f.Name, err)}
+		}
+	}
+	return nil
+}
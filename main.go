@@ -2,25 +2,83 @@ package main
 
 import (
 	"fmt"
+	"log"
 	"net/http"
+	"os"
 	"time"
 )
 
 func main() {
-	InitDB()
-	startChunkCleaner(30*time.Minute, 6*time.Hour) // cek tiap 30 menit, hapus yang lebih tua 6 jam
+	cfg, err := loadConfig(os.Args[1:])
+	if err != nil {
+		log.Fatalf("Konfigurasi tidak valid:\n%v", err)
+	}
+	if err := applyConfig(cfg); err != nil {
+		log.Fatalf("Gagal menerapkan konfigurasi: %v", err)
+	}
+
+	InitDB(cfg.DBPath)
+	if cfg.StorageBackend == "local" {
+		migrateFlatUploads()
+	}
+	migrateUploadsToBlobs()
+	if cfg.AdminUsername != "" {
+		if err := bootstrapAdmin(cfg.AdminUsername, cfg.AdminPassword); err != nil {
+			log.Fatalf("Gagal membuat admin awal: %v", err)
+		}
+	}
+	if n, err := countUsers(); err == nil && n == 0 {
+		log.Println("Belum ada user: user pertama yang daftar lewat /register otomatis jadi admin")
+	}
+	startChunkCleaner(time.Duration(cfg.ChunkCleanInterval), time.Duration(cfg.ChunkMaxAge))
+	startTrashCleaner(time.Duration(cfg.ChunkCleanInterval), time.Duration(cfg.TrashRetention))
+	startQuarantineCleaner(time.Duration(cfg.ChunkCleanInterval), time.Duration(cfg.QuarantineMaxAge))
+	startVersionCleaner(time.Duration(cfg.ChunkCleanInterval))
+	startTokenCleaner(time.Duration(cfg.TokenCleanInterval))
+	startScanWorker(time.Duration(cfg.ScanInterval))
+	startTextIndexer(time.Duration(cfg.ScanInterval))
 
 	http.HandleFunc("/", FormHandler)
 	http.HandleFunc("/login", loginHandler)
+	http.HandleFunc("/register", RegisterHandler)
+	http.HandleFunc("/refresh", RefreshHandler)
+	http.HandleFunc("/logout", requireAuth(LogoutHandler))
+	http.HandleFunc("/admin/users", requireAdmin(AdminUsersHandler))
+	http.HandleFunc("/admin/users/disable", requireAdmin(AdminDisableUserHandler))
+	http.HandleFunc("/admin/users/reset-password", requireAdmin(AdminResetPasswordHandler))
+	http.HandleFunc("/admin/users/quota", requireAdmin(AdminUserQuotaHandler))
+	http.HandleFunc("/admin/default-quota", requireAdmin(AdminDefaultQuotaHandler))
+	http.HandleFunc("/admin/quarantine", requireAdmin(AdminQuarantineHandler))
+	http.HandleFunc("/admin/groups", requireAdmin(AdminGroupsHandler))
+	http.HandleFunc("/admin/groups/members", requireAdmin(AdminGroupMembersHandler))
+	http.HandleFunc("/me/usage", requireAuth(UsageHandler))
 	http.HandleFunc("/upload", requireAuth(UploadHandler))
 	http.HandleFunc("/download", requireAuth(DownloadHandler))
 	http.HandleFunc("/delete", requireAuth(DeleteHandler))
 	http.HandleFunc("/list-json", requireAuth(ListJSONHandler))
+	http.HandleFunc("/folders", requireAuth(FoldersHandler))
+	http.HandleFunc("/folders/move", requireAuth(MoveFolderHandler))
+	http.HandleFunc("/files/move", requireAuth(MoveFileHandler))
+	http.HandleFunc("/files/copy", requireAuth(CopyFileHandler))
+	http.HandleFunc("/files/meta", requireAuth(FileMetaHandler))
+	http.HandleFunc("/acl", requireAuth(ACLHandler))
+	http.HandleFunc("/shared-with-me", requireAuth(SharedWithMeHandler))
+	http.HandleFunc("/search", requireAuth(SearchHandler))
+	http.HandleFunc("/shares", requireAuth(SharesHandler))
+	http.HandleFunc("/shares/access", requireAuth(ShareAccessHandler))
+	http.HandleFunc(shareBasePath, ShareDownloadHandler) // link share publik, tanpa login
+	http.HandleFunc("/trash", requireAuth(TrashHandler))
+	http.HandleFunc("/trash/restore", requireAuth(RestoreTrashHandler))
+	http.HandleFunc("/versions", requireAuth(VersionsHandler))
+	http.HandleFunc("/versions/restore", requireAuth(RestoreVersionHandler))
+	http.HandleFunc("/versions/prune", requireAuth(PruneVersionsHandler))
+	http.HandleFunc("/uploads", requireAuth(CreateUploadHandler))
 	http.HandleFunc("/upload-chunk", requireAuth(UploadChunkHandler))
 	http.HandleFunc("/merge", requireAuth(MergeChunksHandler))
 	http.HandleFunc("/resume-status", requireAuth(ChunkStatusHandler))
 	http.HandleFunc("/resume", requireAuth(ResumeUploadHandler))
 	http.HandleFunc("/cancel-upload", requireAuth(CancelUploadHandler))
+	http.HandleFunc(tusBasePath, TusHandler) // tus 1.0, OPTIONS tanpa login
 
 	http.HandleFunc("/login.html", ServeLogin)
 	http.HandleFunc("/upload.html", ServeUpload)
@@ -28,7 +86,8 @@ func main() {
 
 	http.Handle("/js/", http.StripPrefix("/js/", http.FileServer(http.Dir("views/js"))))
 
-	fmt.Println("Server berjalan di http://localhost:8080")
-	http.ListenAndServe("0.0.0.0:8080", nil)
-
+	fmt.Printf("Server berjalan di http://%s\n", cfg.ListenAddr)
+	if err := http.ListenAndServe(cfg.ListenAddr, nil); err != nil {
+		log.Fatal(err)
+	}
 }
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setupTestEnv menyiapkan database, storage lokal dan config bawaan di folder sementara,
+// sama seperti main() tanpa menjalankan server dan worker
+func setupTestEnv(t *testing.T) *Config {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := defaultConfig()
+	cfg.DBPath = filepath.Join(dir, "filemeta.db")
+	cfg.UploadPath = filepath.Join(dir, "uploads")
+	cfg.ChunkTempDir = filepath.Join(dir, "uploads_tmp")
+	cfg.QuarantineDir = filepath.Join(dir, "quarantine")
+	cfg.JWTSecret = "rahasia-test-yang-cukup-panjang-32b"
+	if err := applyConfig(cfg); err != nil {
+		t.Fatalf("applyConfig: %v", err)
+	}
+	InitDB(cfg.DBPath)
+	t.Cleanup(func() { DB.Close() })
+	return cfg
+}
+
+// uploadTestFile menyimpan content sebagai file milik username (versi baru kalau nama sudah ada)
+func uploadTestFile(t *testing.T, username, filename, content string) int64 {
+	t.Helper()
+	version, _, err := storeUpload(context.Background(), username, filename, strings.NewReader(content), "", FileMeta{})
+	if err != nil {
+		t.Fatalf("storeUpload %s/%s: %v", username, filename, err)
+	}
+	return version
+}
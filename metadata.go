@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// Metadata file per versi: MIME hasil deteksi isi, nama asli dari client dan key storage dicatat
+// saat upload; ukuran dan sha256 sudah ada sejak blob store. Tags dan deskripsi diisi user
+// (PATCH /files/meta), berlaku untuk semua versi file dan diwarisi versi baru (lihat addVersion).
+
+const (
+	maxTags           = 20
+	maxTagLength      = 50
+	maxDescriptionLen = 2000
+)
+
+var errInvalidMeta = errors.New("metadata tidak valid")
+
+// FileMeta: metadata yang ditentukan saat isi file diterima
+type FileMeta struct {
+	MIMEType     string
+	OriginalName string // nama file persis seperti dikirim client (sebelum sanitasi)
+
+	// CheckQuota: kuota dicek ulang di transaksi yang mencatat versi baru. Dipakai upload
+	// biasa yang ukurannya tidak dipesan lebih dulu seperti sesi upload.
+	CheckQuota bool
+}
+
+// detectMIME menebak tipe isi dari byte awal file; kalau hasilnya generik, ekstensi nama file dipakai
+func detectMIME(r io.ReadSeeker, name string) (string, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(r, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	detected := http.DetectContentType(head[:n])
+	if strings.HasPrefix(detected, "application/octet-stream") || strings.HasPrefix(detected, "text/plain") {
+		if byExt := mime.TypeByExtension(strings.ToLower(filepath.Ext(name))); byExt != "" {
+			return byExt, nil
+		}
+	}
+	return detected, nil
+}
+
+// normalizeTags merapikan tags dari user: huruf kecil, tanpa spasi di ujung, tanpa duplikat.
+// Tags disimpan dipisah koma, jadi koma tidak boleh ada di dalam tag.
+func normalizeTags(tags []string) ([]string, error) {
+	out := []string{}
+	seen := map[string]bool{}
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" || seen[t] {
+			continue
+		}
+		if len(t) > maxTagLength || strings.ContainsRune(t, ',') || strings.IndexFunc(t, unicode.IsControl) >= 0 {
+			return nil, fmt.Errorf("%w: tag %q", errInvalidMeta, t)
+		}
+		seen[t] = true
+		out = append(out, t)
+	}
+	if len(out) > maxTags {
+		return nil, fmt.Errorf("%w: maksimal %d tag", errInvalidMeta, maxTags)
+	}
+	return out, nil
+}
+
+func joinTags(tags []string) string {
+	return strings.Join(tags, ",")
+}
+
+func splitTags(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, ",")
+}
+
+// updateFileMeta mengubah tags dan/atau deskripsi (nil = tidak diubah) semua versi aktif file
+func updateFileMeta(username, filename string, tags []string, description *string) error {
+	sets, args := []string{}, []interface{}{}
+	if tags != nil {
+		sets = append(sets, "tags = ?")
+		args = append(args, joinTags(tags))
+	}
+	if description != nil {
+		sets = append(sets, "description = ?")
+		args = append(args, *description)
+	}
+	if len(sets) == 0 {
+		_, err := getUpload(username, filename, 0)
+		return err
+	}
+	args = append(args, username, filename)
+	res, err := DB.Exec("UPDATE uploads SET "+strings.Join(sets, ", ")+" WHERE username = ? AND filename = ? AND deleted_at IS NULL", args...)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errFileNotFound
+	}
+	return nil
+}
+
+// fileMetaJSON: bentuk metadata versi aktif di response API
+func fileMetaJSON(u *UploadRecord) map[string]interface{} {
+	return map[string]interface{}{
+		"filename":      u.Filename,
+		"version":       u.Version,
+		"size":          u.Size,
+		"mime_type":     u.MIMEType,
+		"sha256":        u.Blob,
+		"original_name": u.OriginalName,
+		"storage_key":   u.StorageKey,
+		"tags":          splitTags(u.Tags),
+		"description":   u.Description,
+		"uploaded_at":   u.UploadedAt,
+	}
+}
+
+// -------------------------
+// Metadata file
+// -------------------------
+
+// GET /files/meta?file=[&owner=]: metadata versi aktif,
+// PATCH /files/meta?file=[&owner=] {"tags": [...], "description": "..."}: ubah field yang diisi (butuh hak write)
+func FileMetaHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPatch {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	p, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+	filename, err := cleanFilePath(r.URL.Query().Get("file"))
+	if err != nil {
+		http.Error(w, "Nama file tidak valid", http.StatusBadRequest)
+		return
+	}
+
+	need := PermRead
+	if r.Method == http.MethodPatch {
+		need = PermWrite
+	}
+	owner := fileOwnerParam(r, p)
+	perm, err := filePermission(p.Username, owner, filename)
+	if err != nil {
+		http.Error(w, "Gagal cek hak akses", http.StatusInternalServerError)
+		log.Printf("FileMetaHandler: DB error: %v", err)
+		return
+	}
+	if !permits(perm, need) {
+		writeAccessDenied(w, perm)
+		return
+	}
+
+	if r.Method == http.MethodPatch {
+		var req struct {
+			Tags        []string `json:"tags"`
+			Description *string  `json:"description"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+		var tags []string
+		if req.Tags != nil {
+			if tags, err = normalizeTags(req.Tags); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if req.Description != nil && len(*req.Description) > maxDescriptionLen {
+			http.Error(w, fmt.Sprintf("Deskripsi maksimal %d byte", maxDescriptionLen), http.StatusBadRequest)
+			return
+		}
+		if err := updateFileMeta(owner, filename, tags, req.Description); errors.Is(err, errFileNotFound) {
+			http.Error(w, "File tidak ditemukan", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Gagal menyimpan metadata", http.StatusInternalServerError)
+			log.Printf("FileMetaHandler: update %s milik %s: %v", filename, owner, err)
+			return
+		}
+		log.Printf("FileMetaHandler: user=%s mengubah metadata %s milik %s", p.Username, filename, owner)
+	}
+
+	upload, err := getUpload(owner, filename, 0)
+	if errors.Is(err, errFileNotFound) {
+		http.Error(w, "File tidak ditemukan", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Gagal ambil metadata", http.StatusInternalServerError)
+		log.Printf("FileMetaHandler: DB error: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(fileMetaJSON(upload))
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Sebelum ada blob store, file user disimpan di folder sendiri: uploads/<username>/<filename>.
+// Username sudah dibatasi ke karakter aman saat registrasi (lihat usernamePattern).
+func ownerDir(username string) string {
+	return filepath.Join(uploadPath, username)
+}
+
+// ownerFilePath menolak nama file yang bisa keluar dari folder user (lihat safeJoin)
+func ownerFilePath(username, filename string) (string, error) {
+	return safeJoin(ownerDir(username), filename)
+}
+
+// UploadRecord: satu versi file milik user di tabel uploads
+type UploadRecord struct {
+	ID         int64
+	Filename   string
+	Version    int64
+	Blob       string // sha256 blob isi file; kosong untuk baris lama yang belum dimigrasi
+	Size       int64
+	Status     string // status pemindaian (lihat ScanPending dkk)
+	UploadedAt time.Time
+
+	// Metadata (lihat metadata.go); kosong untuk baris lama
+	MIMEType     string
+	OriginalName string
+	StorageKey   string
+	Tags         string // dipisah koma
+	Description  string
+}
+
+// getUpload mengambil versi file milik user (version 0 = versi aktif);
+// errFileNotFound kalau user tidak punya file/versi tsb
+func getUpload(username, filename string, version int64) (*UploadRecord, error) {
+	query := `SELECT id, filename, version, COALESCE(blob_sha256, ''), COALESCE(size, 0), status, uploaded_at,
+		COALESCE(mime_type, ''), COALESCE(original_name, ''), COALESCE(storage_key, ''), COALESCE(tags, ''), COALESCE(description, '')
+		FROM uploads WHERE filename = ? AND username = ? AND deleted_at IS NULL`
+	args := []interface{}{filename, username}
+	if version > 0 {
+		query += " AND version = ?"
+		args = append(args, version)
+	}
+	var u UploadRecord
+	err := DB.QueryRow(query+" ORDER BY version DESC LIMIT 1", args...).Scan(&u.ID, &u.Filename, &u.Version, &u.Blob, &u.Size, &u.Status, &u.UploadedAt,
+		&u.MIMEType, &u.OriginalName, &u.StorageKey, &u.Tags, &u.Description)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errFileNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// migrateFlatUploads (khusus backend local) memindahkan file lama yang masih tersimpan rata di uploadPath
+// ke folder pemiliknya berdasarkan tabel uploads. File tanpa pemilik yang jelas
+// dibiarkan di tempat (tidak bisa diunduh siapa pun) dan dicatat di log.
+func migrateFlatUploads() {
+	entries, err := os.ReadDir(uploadPath)
+	if err != nil {
+		log.Printf("migrateFlatUploads: ReadDir %s: %v", uploadPath, err)
+		return
+	}
+
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		name := e.Name()
+
+		rows, err := DB.Query("SELECT DISTINCT username FROM uploads WHERE filename = ? AND username != ''", name)
+		if err != nil {
+			log.Printf("migrateFlatUploads: query %s: %v", name, err)
+			continue
+		}
+		var owners []string
+		for rows.Next() {
+			var u string
+			if err := rows.Scan(&u); err == nil {
+				owners = append(owners, u)
+			}
+		}
+		rows.Close()
+
+		if len(owners) != 1 {
+			log.Printf("migrateFlatUploads: %s punya %d pemilik di DB, dibiarkan", name, len(owners))
+			continue
+		}
+
+		dst, err := ownerFilePath(owners[0], name)
+		if err != nil {
+			log.Printf("migrateFlatUploads: nama %q tidak aman, dibiarkan", name)
+			continue
+		}
+		if _, err := os.Stat(dst); err == nil {
+			log.Printf("migrateFlatUploads: %s sudah ada, %s dibiarkan", dst, name)
+			continue
+		}
+		if err := os.MkdirAll(ownerDir(owners[0]), 0755); err != nil {
+			log.Printf("migrateFlatUploads: mkdir %s: %v", ownerDir(owners[0]), err)
+			continue
+		}
+		if err := os.Rename(filepath.Join(uploadPath, name), dst); err != nil {
+			log.Printf("migrateFlatUploads: pindah %s: %v", name, err)
+			continue
+		}
+		log.Printf("migrateFlatUploads: %s -> %s", name, dst)
+	}
+}
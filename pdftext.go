@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Ekstraksi teks sederhana dari PDF untuk indeks pencarian: content stream (tanpa filter atau
+// FlateDecode) dibaca operator teksnya (Tj, TJ, ' dan "). Font dengan encoding khusus (CID,
+// ToUnicode) tidak diterjemahkan, jadi hasilnya bisa tidak lengkap, tapi cukup untuk dicari.
+
+const (
+	maxPDFStreamSize = 16 << 20 // batas isi satu stream setelah di-inflate
+	maxPDFTextSize   = 1 << 20  // batas teks yang disimpan per file
+	pdfDictLookback  = 4 << 10  // jarak maksimal dari awal objek ke kata kunci stream
+)
+
+// extractPDFText mengembalikan teks yang terbaca dari data PDF ("" kalau tidak ada/terenkripsi)
+func extractPDFText(data []byte) string {
+	if !bytes.HasPrefix(data, []byte("%PDF-")) || bytes.Contains(data, []byte("/Encrypt")) {
+		return ""
+	}
+
+	var out strings.Builder
+	rest := data
+	for out.Len() < maxPDFTextSize {
+		i := bytes.Index(rest, []byte("stream"))
+		if i < 0 {
+			break
+		}
+		if i >= 3 && string(rest[i-3:i]) == "end" {
+			rest = rest[i+6:]
+			continue
+		}
+
+		dict := rest[max(0, i-pdfDictLookback):i]
+		if j := bytes.LastIndex(dict, []byte("obj")); j >= 0 {
+			dict = dict[j:]
+		}
+		start := i + 6
+		if start < len(rest) && rest[start] == '\r' {
+			start++
+		}
+		if start < len(rest) && rest[start] == '\n' {
+			start++
+		}
+		end := bytes.Index(rest[start:], []byte("endstream"))
+		if end < 0 {
+			break
+		}
+		raw := rest[start : start+end]
+		rest = rest[start+end+9:]
+
+		if bytes.Contains(dict, []byte("/Image")) {
+			continue
+		}
+		var content []byte
+		switch {
+		case bytes.Contains(dict, []byte("/FlateDecode")):
+			zr, err := zlib.NewReader(bytes.NewReader(raw))
+			if err != nil {
+				continue
+			}
+			// stream yang terpotong tetap dipakai sebagian yang berhasil di-inflate
+			content, _ = io.ReadAll(io.LimitReader(zr, maxPDFStreamSize))
+			zr.Close()
+		case bytes.Contains(dict, []byte("/Filter")):
+			continue // filter lain (DCT, LZW, ...) bukan teks yang bisa dibaca
+		default:
+			content = raw
+		}
+		if bytes.Contains(content, []byte("BT")) {
+			pdfContentText(content, &out)
+		}
+	}
+
+	text := strings.Map(func(r rune) rune {
+		if unicode.IsPrint(r) {
+			return r
+		}
+		return ' '
+	}, out.String())
+	text = strings.Join(strings.Fields(text), " ")
+	if len(text) > maxPDFTextSize {
+		text = strings.ToValidUTF8(text[:maxPDFTextSize], "")
+	}
+	return text
+}
+
+// pdfContentText membaca operator di satu content stream dan menulis teksnya ke out
+func pdfContentText(c []byte, out *strings.Builder) {
+	var parts []string // operand string (dan spasi dari kerning TJ) sebelum operator berikutnya
+	for i := 0; i < len(c); {
+		ch := c[i]
+		switch {
+		case ch == '(':
+			s, n := readPDFLiteral(c[i:])
+			parts = append(parts, decodePDFString(s))
+			i += n
+		case ch == '<' && i+1 < len(c) && c[i+1] == '<':
+			i += 2
+		case ch == '>' && i+1 < len(c) && c[i+1] == '>':
+			i += 2
+		case ch == '<':
+			s, n := readPDFHex(c[i:])
+			parts = append(parts, decodePDFString(s))
+			i += n
+		case ch == '%':
+			for i < len(c) && c[i] != '\n' && c[i] != '\r' {
+				i++
+			}
+		case ch == '[' || ch == ']' || ch == '{' || ch == '}' || isPDFSpace(ch):
+			i++
+		default:
+			j := i + 1
+			for j < len(c) && !isPDFSpace(c[j]) && !isPDFDelimiter(c[j]) {
+				j++
+			}
+			tok := string(c[i:j])
+			i = j
+
+			if n, err := strconv.ParseFloat(tok, 64); err == nil {
+				// Geser besar ke kiri di dalam TJ biasanya jarak antarkata
+				if n < -200 {
+					parts = append(parts, " ")
+				}
+				continue
+			}
+			switch tok {
+			case "Tj", "TJ":
+				out.WriteString(strings.Join(parts, ""))
+			case "'", "\"":
+				out.WriteString("\n" + strings.Join(parts, ""))
+			case "Td", "TD", "T*":
+				out.WriteString(" ")
+			case "ET":
+				out.WriteString("\n")
+			case "ID":
+				// Data inline image berakhir di operator EI
+				if k := bytes.Index(c[i:], []byte("EI")); k >= 0 {
+					i += k + 2
+				} else {
+					i = len(c)
+				}
+			}
+			parts = parts[:0]
+		}
+	}
+}
+
+// readPDFLiteral membaca string (...) termasuk kurung bersarang dan escape;
+// mengembalikan isi string dan jumlah byte yang dibaca
+func readPDFLiteral(c []byte) ([]byte, int) {
+	var s []byte
+	depth := 0
+	i := 0
+	for i < len(c) {
+		ch := c[i]
+		switch ch {
+		case '(':
+			depth++
+			if depth > 1 {
+				s = append(s, ch)
+			}
+		case ')':
+			depth--
+			if depth == 0 {
+				return s, i + 1
+			}
+			s = append(s, ch)
+		case '\\':
+			i++
+			if i >= len(c) {
+				return s, i
+			}
+			switch e := c[i]; e {
+			case 'n':
+				s = append(s, '\n')
+			case 'r':
+				s = append(s, '\r')
+			case 't':
+				s = append(s, '\t')
+			case 'b':
+				s = append(s, '\b')
+			case 'f':
+				s = append(s, '\f')
+			case '\r':
+				// Backslash di akhir baris: string berlanjut di baris berikutnya
+				if i+1 < len(c) && c[i+1] == '\n' {
+					i++
+				}
+			case '\n':
+			default:
+				if e >= '0' && e <= '7' {
+					v := 0
+					for k := 0; k < 3 && i < len(c) && c[i] >= '0' && c[i] <= '7'; k++ {
+						v = v*8 + int(c[i]-'0')
+						i++
+					}
+					s = append(s, byte(v))
+					continue
+				}
+				s = append(s, e)
+			}
+		default:
+			s = append(s, ch)
+		}
+		i++
+	}
+	return s, i
+}
+
+// readPDFHex membaca string <hex>; digit terakhir yang ganjil dianggap diikuti 0
+func readPDFHex(c []byte) ([]byte, int) {
+	var s []byte
+	hi, odd := byte(0), false
+	for i := 1; i < len(c); i++ {
+		ch := c[i]
+		var v byte
+		switch {
+		case ch == '>':
+			if odd {
+				s = append(s, hi<<4)
+			}
+			return s, i + 1
+		case ch >= '0' && ch <= '9':
+			v = ch - '0'
+		case ch >= 'a' && ch <= 'f':
+			v = ch - 'a' + 10
+		case ch >= 'A' && ch <= 'F':
+			v = ch - 'A' + 10
+		default:
+			continue
+		}
+		if odd {
+			s = append(s, hi<<4|v)
+		} else {
+			hi = v
+		}
+		odd = !odd
+	}
+	return s, len(c)
+}
+
+// decodePDFString: UTF-16BE kalau diawali BOM FE FF, selain itu dianggap Latin-1
+func decodePDFString(s []byte) string {
+	if len(s) >= 2 && s[0] == 0xFE && s[1] == 0xFF {
+		u := make([]uint16, 0, (len(s)-2)/2)
+		for i := 2; i+1 < len(s); i += 2 {
+			u = append(u, uint16(s[i])<<8|uint16(s[i+1]))
+		}
+		return string(utf16.Decode(u))
+	}
+	var b strings.Builder
+	for _, ch := range s {
+		if ch < utf8.RuneSelf {
+			b.WriteByte(ch)
+		} else {
+			b.WriteRune(rune(ch))
+		}
+	}
+	return b.String()
+}
+
+func isPDFSpace(ch byte) bool {
+	return ch == ' ' || ch == '\n' || ch == '\r' || ch == '\t' || ch == '\f' || ch == 0
+}
+
+func isPDFDelimiter(ch byte) bool {
+	return strings.IndexByte("()<>[]{}/%", ch) >= 0
+}
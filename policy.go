@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Kebijakan tipe file untuk semua jalur upload (/upload, /uploads + /upload-chunk + /merge, tus).
+// Satu FileType mengelompokkan ekstensi, tipe MIME hasil deteksi isi, signature magic byte
+// dan batas ukurannya; RolePolicy membatasi tipe mana yang boleh diupload tiap role.
+
+// FileType: satu jenis file yang boleh disimpan server
+type FileType struct {
+	Name       string      `json:"name"`
+	Extensions []string    `json:"extensions"`
+	MIMETypes  []string    `json:"mime_types"` // hasil http.DetectContentType yang diterima
+	Signatures []Signature `json:"signatures"` // untuk tipe yang tidak dikenali DetectContentType
+	MaxSize    int64       `json:"max_size"`   // 0 = hanya dibatasi max_upload_size
+	Validate   string      `json:"validate"`   // pemeriksaan struktur file utuh: deb, iso, zip (lihat inspect.go)
+}
+
+// Signature: isi file di posisi Offset harus sama dengan Hex (byte dalam heksadesimal)
+type Signature struct {
+	Offset int    `json:"offset"`
+	Hex    string `json:"hex"`
+
+	magic []byte
+}
+
+// RolePolicy: Allow kosong berarti semua tipe boleh; Deny selalu menang atas Allow
+type RolePolicy struct {
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+}
+
+var errTypeForbidden = errors.New("tipe file tidak diizinkan untuk akun ini")
+
+// sniffLen: jumlah byte minimal yang dibaca dari awal file untuk deteksi isi (sama dengan DetectContentType)
+const sniffLen = 512
+
+type FilePolicy struct {
+	types []*FileType
+	byExt map[string]*FileType
+	roles map[string]RolePolicy
+	// headLen: byte yang perlu dibaca supaya semua signature bisa dicek
+	headLen int
+}
+
+var filePolicy = &FilePolicy{byExt: map[string]*FileType{}}
+
+func defaultFileTypes() []FileType {
+	return []FileType{
+		{Name: "jpg", Extensions: []string{".jpg", ".jpeg"}, MIMETypes: []string{"image/jpeg"}},
+		{Name: "png", Extensions: []string{".png"}, MIMETypes: []string{"image/png"}},
+		{Name: "pdf", Extensions: []string{".pdf"}, MIMETypes: []string{"application/pdf"}},
+		{Name: "mp4", Extensions: []string{".mp4"}, MIMETypes: []string{"video/mp4"}},
+		{
+			Name:       "iso",
+			Extensions: []string{".iso"},
+			MIMETypes:  []string{"application/x-iso9660-image"},
+			Signatures: []Signature{{Offset: 0x8001, Hex: hex.EncodeToString([]byte("CD001"))}},
+			Validate:   "iso",
+		},
+		{
+			Name:       "deb",
+			Extensions: []string{".deb"},
+			MIMETypes:  []string{"application/vnd.debian.binary-package", "application/x-debian-package"},
+			Signatures: []Signature{{Offset: 0, Hex: hex.EncodeToString([]byte("!<arch>\ndebian-binary"))}},
+			Validate:   "deb",
+		},
+	}
+}
+
+// newFilePolicy memvalidasi dan menyusun indeks dari config
+func newFilePolicy(types []FileType, roles map[string]RolePolicy) (*FilePolicy, error) {
+	p := &FilePolicy{byExt: map[string]*FileType{}, roles: map[string]RolePolicy{}, headLen: sniffLen}
+	names := map[string]bool{}
+	var errs []error
+
+	for i := range types {
+		t := types[i]
+		t.Extensions = append([]string(nil), t.Extensions...)
+		t.MIMETypes = append([]string(nil), t.MIMETypes...)
+		t.Signatures = append([]Signature(nil), t.Signatures...)
+		if t.Name == "" {
+			errs = append(errs, fmt.Errorf("file_types[%d]: name kosong", i))
+			continue
+		}
+		if names[t.Name] {
+			errs = append(errs, fmt.Errorf("file_types: nama %q dipakai dua kali", t.Name))
+		}
+		names[t.Name] = true
+		if len(t.Extensions) == 0 {
+			errs = append(errs, fmt.Errorf("file_types %s: extensions kosong", t.Name))
+		}
+		if len(t.MIMETypes) == 0 && len(t.Signatures) == 0 {
+			errs = append(errs, fmt.Errorf("file_types %s: butuh mime_types atau signatures", t.Name))
+		}
+		if t.MaxSize < 0 {
+			errs = append(errs, fmt.Errorf("file_types %s: max_size tidak boleh negatif", t.Name))
+		}
+		if _, ok := contentValidators[t.Validate]; t.Validate != "" && !ok {
+			errs = append(errs, fmt.Errorf("file_types %s: validate %q tidak dikenal", t.Name, t.Validate))
+		}
+
+		for j, ext := range t.Extensions {
+			ext = strings.ToLower(ext)
+			if !strings.HasPrefix(ext, ".") {
+				errs = append(errs, fmt.Errorf("file_types %s: ekstensi %q harus diawali titik", t.Name, ext))
+			}
+			if other, ok := p.byExt[ext]; ok {
+				errs = append(errs, fmt.Errorf("file_types: ekstensi %s ada di %s dan %s", ext, other.Name, t.Name))
+			}
+			t.Extensions[j] = ext
+			p.byExt[ext] = &t
+		}
+		for j := range t.MIMETypes {
+			t.MIMETypes[j] = strings.ToLower(t.MIMETypes[j])
+		}
+		for j := range t.Signatures {
+			s := &t.Signatures[j]
+			magic, err := hex.DecodeString(s.Hex)
+			if err != nil || len(magic) == 0 || s.Offset < 0 {
+				errs = append(errs, fmt.Errorf("file_types %s: signature %d tidak valid", t.Name, j))
+				continue
+			}
+			s.magic = magic
+			p.headLen = max(p.headLen, s.Offset+len(magic))
+		}
+		p.types = append(p.types, &t)
+	}
+
+	for role, rp := range roles {
+		for _, name := range append(append([]string{}, rp.Allow...), rp.Deny...) {
+			if !names[name] {
+				errs = append(errs, fmt.Errorf("role_policies %s: tipe %q tidak ada di file_types", role, name))
+			}
+		}
+		p.roles[role] = rp
+	}
+	if len(p.types) == 0 {
+		errs = append(errs, errors.New("file_types kosong"))
+	}
+	return p, errors.Join(errs...)
+}
+
+// Lookup mencari tipe berdasarkan ekstensi nama file
+func (p *FilePolicy) Lookup(filename string) (*FileType, bool) {
+	t, ok := p.byExt[strings.ToLower(filepath.Ext(filename))]
+	return t, ok
+}
+
+// roleAllows: tipe boleh kalau minimal satu role user mengizinkannya.
+// Role yang tidak punya kebijakan sendiri boleh semua tipe.
+func (p *FilePolicy) roleAllows(roles []string, name string) bool {
+	for _, role := range roles {
+		rp, ok := p.roles[role]
+		if !ok {
+			return true
+		}
+		if (len(rp.Allow) == 0 || containsString(rp.Allow, name)) && !containsString(rp.Deny, name) {
+			return true
+		}
+	}
+	return len(roles) == 0
+}
+
+// Check dipakai sebelum data diterima: ekstensi, izin role dan batas ukuran per tipe
+func (p *FilePolicy) Check(roles []string, filename string, size int64) (*FileType, error) {
+	t, ok := p.Lookup(filename)
+	if !ok {
+		return nil, errExtensionNotAllowed
+	}
+	if !p.roleAllows(roles, t.Name) {
+		return nil, errTypeForbidden
+	}
+	if size < 0 || (t.MaxSize > 0 && size > t.MaxSize) || (maxUploadSize > 0 && size > maxUploadSize) {
+		return nil, errFileTooLarge
+	}
+	return t, nil
+}
+
+// AcceptsDeclaredMIME: tipe dari browser hanya petunjuk; octet-stream / kosong berarti browser tidak tahu
+func (t *FileType) AcceptsDeclaredMIME(declared string) bool {
+	declared = strings.ToLower(declared)
+	return declared == "" || declared == "application/octet-stream" || containsString(t.MIMETypes, declared)
+}
+
+// MatchContent mencocokkan awal isi file (lihat readHead) dengan tipe t
+func (t *FileType) MatchContent(head []byte) bool {
+	detected := http.DetectContentType(head)
+	if i := strings.Index(detected, ";"); i >= 0 {
+		detected = detected[:i]
+	}
+	if containsString(t.MIMETypes, detected) {
+		return true
+	}
+	for _, s := range t.Signatures {
+		if s.Offset+len(s.magic) <= len(head) && bytes.Equal(head[s.Offset:s.Offset+len(s.magic)], s.magic) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckHead hanya mencocokkan awal isi file; dipakai untuk menolak lebih awal
+// (chunk pertama), bukan pengganti CheckContent pada file utuh
+func (p *FilePolicy) CheckHead(t *FileType, r io.ReaderAt) error {
+	head, err := readHead(r, p.headLen)
+	if err != nil {
+		return err
+	}
+	if !t.MatchContent(head) {
+		return &contentError{Type: t.Name, Reason: "MIME/signature tidak cocok"}
+	}
+	return nil
+}
+
+// CheckContent memeriksa file utuh berukuran size: awal isinya lalu struktur lengkapnya (t.Validate).
+// Error karena isi file bisa dikenali dengan errors.Is(err, errTypeNotAllowed).
+func (p *FilePolicy) CheckContent(t *FileType, r io.ReaderAt, size int64) error {
+	if err := p.CheckHead(t, r); err != nil {
+		return err
+	}
+	if validate, ok := contentValidators[t.Validate]; ok {
+		return validate(r, size)
+	}
+	return nil
+}
+
+// readHead membaca maksimal n byte pertama; file yang lebih pendek tidak dianggap error
+func readHead(r io.ReaderAt, n int) ([]byte, error) {
+	buf := make([]byte, n)
+	got, err := r.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return buf[:got], nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckContentFile sama dengan CheckContent untuk file lokal (file data sesi upload)
+func (p *FilePolicy) CheckContentFile(t *FileType, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return p.CheckContent(t, f, fi.Size())
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// File yang gagal validasi isi (lihat FilePolicy.CheckContent) tidak langsung dihapus, tapi
+// dipindah ke quarantineDir (selalu disk lokal, apa pun backend storage-nya) supaya bisa diperiksa admin.
+// Nama file di karantina acak; nama asli dan alasannya dicatat di tabel quarantine.
+// Ukurannya ikut dihitung ke kuota pengupload (lihat userUsage) dan dibatasi quarantineMaxPerUser,
+// supaya upload yang ditolak tidak bisa dipakai memenuhi disk.
+var (
+	quarantineDir        = "quarantine"
+	quarantineMaxPerUser int64 // 0 = tanpa batas
+)
+
+var errQuarantineFull = errors.New("batas karantina user sudah penuh, file tidak disimpan")
+
+type QuarantineEntry struct {
+	ID        int64     `json:"id"`
+	Username  string    `json:"username"`
+	Filename  string    `json:"filename"`
+	FileType  string    `json:"file_type"`
+	Reason    string    `json:"reason"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+
+	stored string // nama file di quarantineDir
+}
+
+// checkQuarantineRoom memastikan file berukuran size masih muat di jatah karantina user
+func checkQuarantineRoom(username string, size int64) error {
+	if quarantineMaxPerUser == 0 {
+		return nil
+	}
+	var used int64
+	if err := DB.QueryRow("SELECT COALESCE(SUM(size), 0) FROM quarantine WHERE username = ?", username).Scan(&used); err != nil {
+		return err
+	}
+	if used+size > quarantineMaxPerUser {
+		return errQuarantineFull
+	}
+	return nil
+}
+
+// quarantineFile memindahkan file lokal src (mis. file data sesi upload) ke karantina
+func quarantineFile(username, filename string, reason error, src string) error {
+	fi, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if err := checkQuarantineRoom(username, fi.Size()); err != nil {
+		return err
+	}
+	stored, err := randomToken(16)
+	if err != nil {
+		return err
+	}
+	dst := filepath.Join(quarantineDir, stored)
+	if err := os.Rename(src, dst); err != nil {
+		// Beda filesystem: salin lalu hapus sumbernya
+		f, err := os.Open(src)
+		if err != nil {
+			return err
+		}
+		err = writeQuarantineFile(dst, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		os.Remove(src)
+	}
+	return recordQuarantine(username, filename, reason, stored)
+}
+
+// quarantineReader menyimpan isi r (mis. file dari multipart form, size byte) ke karantina
+func quarantineReader(username, filename string, reason error, r io.Reader, size int64) error {
+	if err := checkQuarantineRoom(username, size); err != nil {
+		return err
+	}
+	stored, err := randomToken(16)
+	if err != nil {
+		return err
+	}
+	if err := writeQuarantineFile(filepath.Join(quarantineDir, stored), r); err != nil {
+		return err
+	}
+	return recordQuarantine(username, filename, reason, stored)
+}
+
+func writeQuarantineFile(dst string, r io.Reader) error {
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, r)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dst)
+	}
+	return err
+}
+
+func recordQuarantine(username, filename string, reason error, stored string) error {
+	typeName := ""
+	var ce *contentError
+	if errors.As(reason, &ce) {
+		typeName = ce.Type
+	}
+	var size int64
+	if fi, err := os.Stat(filepath.Join(quarantineDir, stored)); err == nil {
+		size = fi.Size()
+	}
+
+	_, err := DB.Exec("INSERT INTO quarantine (username, filename, file_type, reason, size, stored_name, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		username, filename, typeName, reason.Error(), size, stored, time.Now())
+	if err != nil {
+		os.Remove(filepath.Join(quarantineDir, stored))
+		return err
+	}
+	log.Printf("Karantina: %s milik %s (%d byte): %v", filename, username, size, reason)
+	return nil
+}
+
+// quarantineSession mengarantina file data sesi upload yang sedang di-merge lalu menutup sesinya
+// (status merging → cancelled); ukurannya pindah dari reserved ke pemakaian karantina user
+func quarantineSession(sess *UploadSession, chunkDir string, reason error) {
+	if err := quarantineFile(sess.Owner, sess.Filename, reason, filepath.Join(chunkDir, sessionDataFile)); err != nil {
+		log.Printf("quarantineSession: gagal karantina sesi %s: %v", sess.ID, err)
+	}
+	if err := setSessionStatus(sess.ID, SessionMerging, SessionCancelled); err != nil {
+		log.Printf("quarantineSession: gagal tutup sesi %s: %v", sess.ID, err)
+	}
+	if err := os.RemoveAll(chunkDir); err != nil {
+		log.Printf("quarantineSession: warning: gagal hapus chunkDir %s: %v", chunkDir, err)
+	}
+}
+
+// -------------------------
+// Akses tabel quarantine
+// -------------------------
+const quarantineColumns = "id, username, filename, file_type, reason, size, stored_name, created_at"
+
+func scanQuarantineEntry(row interface{ Scan(...interface{}) error }) (*QuarantineEntry, error) {
+	var e QuarantineEntry
+	if err := row.Scan(&e.ID, &e.Username, &e.Filename, &e.FileType, &e.Reason, &e.Size, &e.stored, &e.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func listQuarantine(username string) ([]QuarantineEntry, error) {
+	query := "SELECT " + quarantineColumns + " FROM quarantine"
+	var args []interface{}
+	if username != "" {
+		query += " WHERE username = ?"
+		args = append(args, username)
+	}
+	rows, err := DB.Query(query+" ORDER BY created_at DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []QuarantineEntry{}
+	for rows.Next() {
+		e, err := scanQuarantineEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *e)
+	}
+	return entries, rows.Err()
+}
+
+func deleteQuarantineEntry(e *QuarantineEntry) error {
+	if err := os.Remove(filepath.Join(quarantineDir, e.stored)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	_, err := DB.Exec("DELETE FROM quarantine WHERE id = ?", e.ID)
+	return err
+}
+
+// purgeQuarantine menghapus file karantina yang lebih tua dari maxAge (dipanggil dari startQuarantineCleaner)
+func purgeQuarantine(maxAge time.Duration) {
+	rows, err := DB.Query("SELECT "+quarantineColumns+" FROM quarantine WHERE created_at < ?", time.Now().Add(-maxAge))
+	if err != nil {
+		log.Printf("purgeQuarantine: query: %v", err)
+		return
+	}
+	var old []*QuarantineEntry
+	for rows.Next() {
+		if e, err := scanQuarantineEntry(rows); err == nil {
+			old = append(old, e)
+		}
+	}
+	rows.Close()
+
+	for _, e := range old {
+		if err := deleteQuarantineEntry(e); err != nil {
+			log.Printf("purgeQuarantine: hapus id=%d: %v", e.ID, err)
+			continue
+		}
+		log.Printf("Cleaner: menghapus karantina id=%d (%s milik %s)", e.ID, e.Filename, e.Username)
+	}
+}
+
+// -------------------------
+// Karantina (khusus admin)
+// -------------------------
+
+// GET: daftar (filter ?username=), GET ?id=: unduh isi file, DELETE ?id=: hapus
+func AdminQuarantineHandler(w http.ResponseWriter, r *http.Request) {
+	idParam := r.URL.Query().Get("id")
+	if r.Method == http.MethodGet && idParam == "" {
+		entries, err := listQuarantine(r.URL.Query().Get("username"))
+		if err != nil {
+			http.Error(w, "Gagal ambil data karantina", http.StatusInternalServerError)
+			log.Printf("AdminQuarantineHandler: list error: %v", err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entries)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil {
+		http.Error(w, "id tidak valid", http.StatusBadRequest)
+		return
+	}
+	e, err := scanQuarantineEntry(DB.QueryRow("SELECT "+quarantineColumns+" FROM quarantine WHERE id = ?", id))
+	if err != nil {
+		http.Error(w, "Entri karantina tidak ditemukan", http.StatusNotFound)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		if err := deleteQuarantineEntry(e); err != nil {
+			http.Error(w, "Gagal menghapus file karantina", http.StatusInternalServerError)
+			log.Printf("AdminQuarantineHandler: hapus id=%d: %v", id, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		log.Printf("AdminQuarantineHandler: id=%d (%s milik %s) dihapus", id, e.Filename, e.Username)
+		return
+	}
+
+	// Selalu sebagai lampiran biner supaya browser admin tidak merender isinya
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", "attachment; filename="+strconv.Quote(e.Filename))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeFile(w, r, filepath.Join(quarantineDir, e.stored))
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// Kuota dalam byte; 0 = tanpa batas. users.quota_bytes NULL berarti memakai kuota default
+// yang disimpan di tabel settings (key defaultQuotaSetting).
+const defaultQuotaSetting = "default_quota_bytes"
+
+var (
+	errQuotaExceeded    = errors.New("kuota penyimpanan tidak cukup")
+	errFileExceedsQuota = errors.New("ukuran file melebihi kuota user")
+	errInvalidQuota     = errors.New("kuota tidak boleh negatif")
+)
+
+// Usage: pemakaian penyimpanan satu user. Reserved adalah ukuran sesi upload yang
+// belum selesai, supaya beberapa upload paralel tidak bisa bersama-sama melewati kuota.
+// Isi tempat sampah tetap dihitung di Used (Trash) sampai dihapus permanen, begitu juga
+// file karantina (Quarantine) sampai dihapus admin atau kedaluwarsa.
+type Usage struct {
+	Used       int64 `json:"used"`
+	Trash      int64 `json:"trash"`
+	Quarantine int64 `json:"quarantine"`
+	Reserved   int64 `json:"reserved"`
+	Files      int   `json:"files"`
+	Quota      int64 `json:"quota"` // 0 = tanpa batas
+}
+
+// available: sisa kuota (negatif kalau sudah terlampaui); -1 kalau tanpa batas
+func (u Usage) available() int64 {
+	if u.Quota == 0 {
+		return -1
+	}
+	return u.Quota - u.Used - u.Reserved
+}
+
+// -------------------------
+// Akses kuota di database
+// -------------------------
+
+// rowQuerier: DB atau transaksi yang sedang berjalan
+type rowQuerier interface {
+	QueryRow(string, ...interface{}) *sql.Row
+}
+
+func getDefaultQuota() (int64, error) {
+	return defaultQuotaIn(DB)
+}
+
+func defaultQuotaIn(q rowQuerier) (int64, error) {
+	var v string
+	err := q.QueryRow("SELECT value FROM settings WHERE key = ?", defaultQuotaSetting).Scan(&v)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(v, 10, 64)
+}
+
+func setDefaultQuota(quota int64) error {
+	if quota < 0 {
+		return errInvalidQuota
+	}
+	_, err := DB.Exec(`INSERT INTO settings (key, value) VALUES (?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value`, defaultQuotaSetting, strconv.FormatInt(quota, 10))
+	return err
+}
+
+// setUserQuota: quota nil mengembalikan user ke kuota default
+func setUserQuota(username string, quota *int64) error {
+	if quota != nil && *quota < 0 {
+		return errInvalidQuota
+	}
+	res, err := DB.Exec("UPDATE users SET quota_bytes = ? WHERE username = ?", quota, username)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errUserNotFound
+	}
+	return nil
+}
+
+// userQuota mengembalikan kuota efektif user (kuota sendiri, atau default)
+func userQuota(q rowQuerier, username string) (int64, error) {
+	var quota sql.NullInt64
+	err := q.QueryRow("SELECT quota_bytes FROM users WHERE username = ?", username).Scan(&quota)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+	if quota.Valid {
+		return quota.Int64, nil
+	}
+	return defaultQuotaIn(q)
+}
+
+// userUsage menghitung pemakaian user. Sesi excludeSession tidak dihitung sebagai
+// reserved (dipakai saat sesi itu sendiri yang sedang dicek).
+func userUsage(username, excludeSession string) (Usage, error) {
+	return usageIn(DB, username, excludeSession)
+}
+
+func usageIn(q rowQuerier, username, excludeSession string) (Usage, error) {
+	var u Usage
+	err := q.QueryRow(`SELECT COALESCE(SUM(size), 0),
+		COALESCE(SUM(CASE WHEN deleted_at IS NOT NULL THEN size END), 0),
+		COUNT(DISTINCT CASE WHEN deleted_at IS NULL THEN filename END)
+		FROM uploads WHERE username = ?`, username).Scan(&u.Used, &u.Trash, &u.Files)
+	if err != nil {
+		return u, err
+	}
+	err = q.QueryRow("SELECT COALESCE(SUM(size), 0) FROM quarantine WHERE username = ?", username).Scan(&u.Quarantine)
+	if err != nil {
+		return u, err
+	}
+	u.Used += u.Quarantine
+	err = q.QueryRow("SELECT COALESCE(SUM(total_size), 0) FROM upload_sessions WHERE owner = ? AND status IN (?, ?) AND id != ?",
+		username, SessionActive, SessionMerging, excludeSession).Scan(&u.Reserved)
+	if err != nil {
+		return u, err
+	}
+	u.Quota, err = userQuota(q, username)
+	return u, err
+}
+
+// checkQuota memastikan file berukuran size masih muat di kuota user.
+// errFileExceedsQuota kalau file lebih besar dari seluruh kuota (413),
+// errQuotaExceeded kalau hanya sisa kuotanya yang kurang (507).
+func checkQuota(username string, size int64, excludeSession string) error {
+	return checkQuotaIn(DB, username, size, excludeSession)
+}
+
+// checkQuotaIn sama dengan checkQuota, tapi membaca lewat q; di dalam transaksi tulis
+// (_txlock=immediate) hasilnya tidak bisa disalip upload lain sampai transaksi selesai
+func checkQuotaIn(q rowQuerier, username string, size int64, excludeSession string) error {
+	u, err := usageIn(q, username, excludeSession)
+	if err != nil {
+		return err
+	}
+	if u.Quota == 0 {
+		return nil
+	}
+	if size > u.Quota {
+		return errFileExceedsQuota
+	}
+	if size > u.available() {
+		return errQuotaExceeded
+	}
+	return nil
+}
+
+// writeQuotaError: dipakai handler yang tidak lewat writeSessionError; false kalau err bukan error kuota
+func writeQuotaError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, errFileExceedsQuota):
+		http.Error(w, "Ukuran file melebihi kuota penyimpanan", http.StatusRequestEntityTooLarge)
+	case errors.Is(err, errQuotaExceeded):
+		http.Error(w, "Kuota penyimpanan tidak cukup, hapus file lain dulu", http.StatusInsufficientStorage)
+	default:
+		return false
+	}
+	return true
+}
+
+// -------------------------
+// GET /me/usage
+// -------------------------
+func UsageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	p, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	u, err := userUsage(p.Username, "")
+	if err != nil {
+		http.Error(w, "Gagal menghitung pemakaian", http.StatusInternalServerError)
+		log.Printf("UsageHandler: user=%s: %v", p.Username, err)
+		return
+	}
+	writeUsage(w, u)
+}
+
+func writeUsage(w http.ResponseWriter, u Usage) {
+	out := map[string]interface{}{
+		"used":       u.Used,
+		"trash":      u.Trash,
+		"quarantine": u.Quarantine,
+		"reserved":   u.Reserved,
+		"files":      u.Files,
+		"quota":      nil, // null = tanpa batas
+		"available":  nil,
+	}
+	if u.Quota > 0 {
+		out["quota"] = u.Quota
+		out["available"] = max(u.available(), 0)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// -------------------------
+// Kuota (khusus admin)
+// -------------------------
+
+// GET ?username=...: pemakaian user; POST {"username": "...", "quota": 123 | null}
+// (null = kembali ke kuota default, 0 = tanpa batas)
+func AdminUserQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		username := r.URL.Query().Get("username")
+		if _, err := getUser(username); err != nil {
+			writeUserError(w, err)
+			return
+		}
+		u, err := userUsage(username, "")
+		if err != nil {
+			http.Error(w, "Gagal menghitung pemakaian", http.StatusInternalServerError)
+			log.Printf("AdminUserQuotaHandler: user=%s: %v", username, err)
+			return
+		}
+		writeUsage(w, u)
+
+	case http.MethodPost:
+		var req struct {
+			Username string `json:"username"`
+			Quota    *int64 `json:"quota"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Username == "" {
+			http.Error(w, "username diperlukan", http.StatusBadRequest)
+			return
+		}
+		if err := setUserQuota(req.Username, req.Quota); err != nil {
+			if errors.Is(err, errInvalidQuota) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			} else {
+				writeUserError(w, err)
+			}
+			log.Printf("AdminUserQuotaHandler: gagal set kuota %q: %v", req.Username, err)
+			return
+		}
+
+		quota := "default"
+		if req.Quota != nil {
+			quota = strconv.FormatInt(*req.Quota, 10)
+		}
+		fmt.Fprintf(w, "Kuota %s: %s", req.Username, quota)
+		log.Printf("AdminUserQuotaHandler: user=%s quota=%s", req.Username, quota)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// GET: kuota default, POST {"quota": 123} (0 = tanpa batas)
+func AdminDefaultQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		q, err := getDefaultQuota()
+		if err != nil {
+			http.Error(w, "Gagal membaca kuota default", http.StatusInternalServerError)
+			log.Printf("AdminDefaultQuotaHandler: %v", err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int64{"quota": q})
+
+	case http.MethodPost:
+		var req struct {
+			Quota *int64 `json:"quota"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Quota == nil {
+			http.Error(w, "quota diperlukan", http.StatusBadRequest)
+			return
+		}
+		if err := setDefaultQuota(*req.Quota); err != nil {
+			if errors.Is(err, errInvalidQuota) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			} else {
+				http.Error(w, "Gagal menyimpan kuota default", http.StatusInternalServerError)
+			}
+			log.Printf("AdminDefaultQuotaHandler: %v", err)
+			return
+		}
+		fmt.Fprintf(w, "Kuota default: %d", *req.Quota)
+		log.Printf("AdminDefaultQuotaHandler: quota=%d", *req.Quota)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
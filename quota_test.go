@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testPDF: isi PDF minimal berukuran tepat size byte, dibedakan lewat tag supaya blob-nya tidak sama
+func testPDF(tag string, size int) string {
+	head := "%PDF-1.4\n% " + tag + "\n"
+	return head + strings.Repeat("x", size-len(head))
+}
+
+func setQuota(t *testing.T, username string, quota int64) {
+	t.Helper()
+	if err := setUserQuota(username, &quota); err != nil {
+		t.Fatalf("setUserQuota: %v", err)
+	}
+}
+
+func TestCheckQuota(t *testing.T) {
+	setupTestEnv(t)
+	if _, err := createUser("alice", "password-alice", RoleUser); err != nil {
+		t.Fatalf("createUser: %v", err)
+	}
+	uploadTestFile(t, "alice", "a.pdf", testPDF("a", 300))
+	uploadTestFile(t, "alice", "sampah.pdf", testPDF("b", 200))
+	if err := trashUpload("alice", "sampah.pdf"); err != nil {
+		t.Fatalf("trashUpload: %v", err)
+	}
+	sess, err := newUploadSession(&Principal{Username: "alice", Roles: []string{RoleUser}}, "", "besar.pdf", 100, 0)
+	if err != nil {
+		t.Fatalf("newUploadSession: %v", err)
+	}
+
+	// Terpakai: 300 file aktif + 200 tempat sampah + 100 dipesan sesi = 600
+	tests := []struct {
+		desc           string
+		quota          int64
+		size           int64
+		excludeSession string
+		want           error
+	}{
+		{"tanpa batas", 0, 1 << 40, "", nil},
+		{"masih muat", 1000, 100, "", nil},
+		{"pas sisa kuota", 1000, 400, "", nil},
+		{"sisa kurang", 1000, 401, "", errQuotaExceeded},
+		{"tempat sampah ikut dihitung", 700, 101, "", errQuotaExceeded},
+		{"sesi sendiri tidak dihitung", 700, 200, sess.ID, nil},
+		{"lebih besar dari kuota", 1000, 1001, "", errFileExceedsQuota},
+		{"kuota sudah terlampaui", 500, 1, "", errQuotaExceeded},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			setQuota(t, "alice", tc.quota)
+			if err := checkQuota("alice", tc.size, tc.excludeSession); !errors.Is(err, tc.want) {
+				t.Errorf("checkQuota(size=%d) = %v, mau %v", tc.size, err, tc.want)
+			}
+		})
+	}
+
+	// Kuota default berlaku untuk user tanpa kuota sendiri
+	if err := setUserQuota("alice", nil); err != nil {
+		t.Fatalf("setUserQuota: %v", err)
+	}
+	if err := setDefaultQuota(650); err != nil {
+		t.Fatalf("setDefaultQuota: %v", err)
+	}
+	if err := checkQuota("alice", 51, ""); !errors.Is(err, errQuotaExceeded) {
+		t.Errorf("checkQuota dengan kuota default = %v, mau errQuotaExceeded", err)
+	}
+	if err := setDefaultQuota(-1); !errors.Is(err, errInvalidQuota) {
+		t.Errorf("setDefaultQuota(-1) = %v, mau errInvalidQuota", err)
+	}
+}
+
+func uploadRequest(t *testing.T, username, filename, content string) int {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write([]byte(content))
+	mw.Close()
+
+	r := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	r = r.WithContext(withPrincipal(r.Context(), &Principal{Username: username, Roles: []string{RoleUser}}))
+	w := httptest.NewRecorder()
+	UploadHandler(w, r)
+	return w.Code
+}
+
+func TestUploadHandlerQuota(t *testing.T) {
+	setupTestEnv(t)
+	if _, err := createUser("alice", "password-alice", RoleUser); err != nil {
+		t.Fatalf("createUser: %v", err)
+	}
+	setQuota(t, "alice", 1000)
+
+	if got := uploadRequest(t, "alice", "a.pdf", testPDF("a", 600)); got != http.StatusOK {
+		t.Fatalf("upload pertama: status %d", got)
+	}
+	if got := uploadRequest(t, "alice", "b.pdf", testPDF("b", 500)); got != http.StatusInsufficientStorage {
+		t.Errorf("upload melebihi sisa kuota: status %d, mau 507", got)
+	}
+	if got := uploadRequest(t, "alice", "c.pdf", testPDF("c", 1001)); got != http.StatusRequestEntityTooLarge {
+		t.Errorf("upload lebih besar dari kuota: status %d, mau 413", got)
+	}
+
+	// Upload paralel yang masing-masing muat tidak boleh bersama-sama melewati kuota
+	const n = 8
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	codes := make([]int, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			codes[i] = uploadRequest(t, "alice", fmt.Sprintf("paralel-%d.pdf", i), testPDF(fmt.Sprint(i), 150))
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	ok := 0
+	for _, code := range codes {
+		switch code {
+		case http.StatusOK:
+			ok++
+		case http.StatusInsufficientStorage:
+		default:
+			t.Errorf("upload paralel: status %d", code)
+		}
+	}
+	u, err := userUsage("alice", "")
+	if err != nil {
+		t.Fatalf("userUsage: %v", err)
+	}
+	if u.Used > u.Quota || ok != 2 {
+		t.Errorf("setelah upload paralel: terpakai %d dari kuota %d (%d upload berhasil, mau 2)", u.Used, u.Quota, ok)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+var errUnsafePath = errors.New("nama file atau ID tidak valid")
+
+const (
+	maxNameLength = 255
+	maxPathLength = 1024
+)
+
+// cleanName memvalidasi satu komponen path (nama file, upload ID, index chunk).
+// Tidak ada normalisasi di sini: input yang mencurigakan langsung ditolak.
+func cleanName(name string) (string, error) {
+	if name == "" || name == "." || name == ".." || len(name) > maxNameLength {
+		return "", errUnsafePath
+	}
+	if strings.ContainsAny(name, `/\`) {
+		return "", errUnsafePath
+	}
+	if filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", errUnsafePath
+	}
+	for _, r := range name {
+		if r == 0 || unicode.IsControl(r) {
+			return "", errUnsafePath
+		}
+	}
+	// Nama diawali titik disembunyikan & bisa bentrok dengan file internal (.part, .json)
+	if strings.HasPrefix(name, ".") || strings.TrimSpace(name) != name {
+		return "", errUnsafePath
+	}
+	return name, nil
+}
+
+// cleanPath memvalidasi path folder virtual ("laporan/2024"); tiap komponennya harus lolos cleanName.
+// Garis miring di awal/akhir diabaikan, "" berarti folder root.
+func cleanPath(p string) (string, error) {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return "", nil
+	}
+	if len(p) > maxPathLength {
+		return "", errUnsafePath
+	}
+	for _, part := range strings.Split(p, "/") {
+		if _, err := cleanName(part); err != nil {
+			return "", err
+		}
+	}
+	return p, nil
+}
+
+// cleanFilePath seperti cleanPath, tapi harus menunjuk ke sebuah file (tidak boleh root)
+func cleanFilePath(p string) (string, error) {
+	p, err := cleanPath(p)
+	if err == nil && p == "" {
+		err = errUnsafePath
+	}
+	return p, err
+}
+
+// joinPath menggabungkan path folder (boleh "" = root) dengan satu nama
+func joinPath(folder, name string) string {
+	if folder == "" {
+		return name
+	}
+	return folder + "/" + name
+}
+
+// splitPath memisahkan path menjadi folder induk dan nama terakhirnya
+func splitPath(p string) (folder, name string) {
+	if i := strings.LastIndex(p, "/"); i >= 0 {
+		return p[:i], p[i+1:]
+	}
+	return "", p
+}
+
+// sanitizeUploadName dipakai untuk nama file dari browser (header multipart),
+// yang kadang membawa path lengkap seperti "C:\Users\x\foto.jpg".
+// Bagian folder dibuang dulu, sisanya tetap harus lolos cleanName.
+func sanitizeUploadName(name string) (string, error) {
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	return cleanName(strings.TrimSpace(name))
+}
+
+// safeJoin menggabungkan root dengan satu komponen nama dan memastikan
+// hasilnya tetap berada di dalam root.
+func safeJoin(root, name string) (string, error) {
+	name, err := cleanName(name)
+	if err != nil {
+		return "", err
+	}
+
+	full := filepath.Join(root, name)
+	rel, err := filepath.Rel(root, full)
+	if err != nil || rel != name {
+		return "", errUnsafePath
+	}
+	return full, nil
+}
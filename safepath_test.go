@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Nama-nama berbahaya yang harus selalu ditolak cleanName (dan karena itu juga safeJoin)
+var hostileNames = []struct {
+	desc, name string
+}{
+	{"kosong", ""},
+	{"titik", "."},
+	{"dua titik", ".."},
+	{"traversal", "../etc/passwd"},
+	{"traversal di tengah", "a/../b"},
+	{"traversal backslash", `..\..\windows\win.ini`},
+	{"absolut unix", "/etc/passwd"},
+	{"absolut windows", `C:\Windows\system32`},
+	{"UNC", `\\server\share\x`},
+	{"backslash", `a\b`},
+	{"slash", "a/b"},
+	{"NUL", "foto\x00.jpg"},
+	{"newline", "foto\n.jpg"},
+	{"carriage return", "foto\r.jpg"},
+	{"tab", "foto\t.jpg"},
+	{"escape ANSI", "\x1b[31mfoto.jpg"},
+	{"DEL", "foto\x7f.jpg"},
+	{"kontrol unicode C1", "foto\u0085.jpg"},
+	{"dotfile", ".htaccess"},
+	{"titik tiga", "..."},
+	{"spasi di awal", " foto.jpg"},
+	{"spasi di akhir", "foto.jpg "},
+	{"terlalu panjang", strings.Repeat("a", maxNameLength+1)},
+}
+
+func TestCleanNameRejectsHostileNames(t *testing.T) {
+	for _, tc := range hostileNames {
+		t.Run(tc.desc, func(t *testing.T) {
+			if got, err := cleanName(tc.name); !errors.Is(err, errUnsafePath) {
+				t.Fatalf("cleanName(%q) = %q, %v; mau errUnsafePath", tc.name, got, err)
+			}
+		})
+	}
+}
+
+func TestCleanNameAcceptsNormalNames(t *testing.T) {
+	for _, name := range []string{
+		"foto.jpg",
+		"laporan keuangan 2024.pdf",
+		"a..b.pdf",
+		"résumé.pdf",
+		"文件.pdf",
+		"x",
+		strings.Repeat("a", maxNameLength),
+	} {
+		got, err := cleanName(name)
+		if err != nil || got != name {
+			t.Errorf("cleanName(%q) = %q, %v; mau diterima apa adanya", name, got, err)
+		}
+	}
+}
+
+func TestSafeJoin(t *testing.T) {
+	root := filepath.Join("tmp", "chunks")
+	for _, tc := range hostileNames {
+		t.Run(tc.desc, func(t *testing.T) {
+			if got, err := safeJoin(root, tc.name); err == nil {
+				t.Fatalf("safeJoin(%q) = %q; mau ditolak", tc.name, got)
+			}
+		})
+	}
+
+	got, err := safeJoin(root, "abc123")
+	if err != nil || got != filepath.Join(root, "abc123") {
+		t.Fatalf("safeJoin(abc123) = %q, %v", got, err)
+	}
+}
+
+func TestCleanPath(t *testing.T) {
+	tests := []struct {
+		in, want string
+		ok       bool
+	}{
+		{"", "", true},
+		{"/", "", true},
+		{"docs", "docs", true},
+		{"/docs/2024/", "docs/2024", true},
+		{"docs/2024/a.pdf", "docs/2024/a.pdf", true},
+		{"docs//a.pdf", "", false},
+		{"docs/../a.pdf", "", false},
+		{"docs/./a.pdf", "", false},
+		{"../a.pdf", "", false},
+		{`docs\a.pdf`, "", false},
+		{"docs/.hidden/a.pdf", "", false},
+		{"docs/a\x00.pdf", "", false},
+		{"docs/a\n.pdf", "", false},
+		{strings.Repeat("a/", maxPathLength/2+1) + "b", "", false},
+	}
+	for _, tc := range tests {
+		got, err := cleanPath(tc.in)
+		if tc.ok && (err != nil || got != tc.want) {
+			t.Errorf("cleanPath(%q) = %q, %v; mau %q", tc.in, got, err, tc.want)
+		}
+		if !tc.ok && !errors.Is(err, errUnsafePath) {
+			t.Errorf("cleanPath(%q) = %q, %v; mau errUnsafePath", tc.in, got, err)
+		}
+	}
+}
+
+func TestCleanFilePathRejectsRoot(t *testing.T) {
+	for _, in := range []string{"", "/", "//"} {
+		if got, err := cleanFilePath(in); !errors.Is(err, errUnsafePath) {
+			t.Errorf("cleanFilePath(%q) = %q, %v; mau errUnsafePath", in, got, err)
+		}
+	}
+}
+
+func TestSanitizeUploadName(t *testing.T) {
+	tests := []struct {
+		in, want string
+		ok       bool
+	}{
+		{"foto.jpg", "foto.jpg", true},
+		{`C:\Users\x\foto.jpg`, "foto.jpg", true},
+		{"/home/x/foto.jpg", "foto.jpg", true},
+		{"../../foto.jpg", "foto.jpg", true},
+		{"  foto.jpg  ", "foto.jpg", true},
+		{"dir/", "", false},
+		{`dir\..`, "", false},
+		{"../..", "", false},
+		{"/home/x/.bashrc", "", false},
+		{"foto\x00.jpg", "", false},
+		{"a/foto\r\n.jpg", "", false},
+		{"", "", false},
+		{strings.Repeat("a", maxNameLength+1), "", false},
+	}
+	for _, tc := range tests {
+		got, err := sanitizeUploadName(tc.in)
+		if tc.ok && (err != nil || got != tc.want) {
+			t.Errorf("sanitizeUploadName(%q) = %q, %v; mau %q", tc.in, got, err, tc.want)
+		}
+		if !tc.ok && !errors.Is(err, errUnsafePath) {
+			t.Errorf("sanitizeUploadName(%q) = %q, %v; mau errUnsafePath", tc.in, got, err)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Status pemindaian malware di kolom uploads.status. File baru berstatus pending
+// (tidak bisa diunduh) sampai worker pemindai selesai; tanpa scanner langsung clean.
+const (
+	ScanPending  = "pending"
+	ScanClean    = "clean"
+	ScanInfected = "infected"
+)
+
+type ScanResult struct {
+	Infected  bool
+	Signature string // nama malware yang terdeteksi
+}
+
+// Scanner memeriksa isi file; error berarti file belum bisa dinilai (dicoba lagi nanti)
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (ScanResult, error)
+}
+
+// Diisi dari config saat startup (lihat applyConfig); scanner nil = pemindaian nonaktif
+var (
+	scanner     Scanner
+	scanTimeout = 10 * time.Minute
+)
+
+func newScanner(c *Config) (Scanner, error) {
+	switch c.Scanner {
+	case "":
+		return nil, nil
+	case "clamd":
+		network, address, err := parseClamdAddress(c.ClamdAddress)
+		if err != nil {
+			return nil, err
+		}
+		return &ClamdScanner{Network: network, Address: address}, nil
+	case "command":
+		if len(c.ScanCommand) == 0 {
+			return nil, errors.New("scan_command kosong")
+		}
+		return &CommandScanner{Command: c.ScanCommand}, nil
+	default:
+		return nil, fmt.Errorf("scanner %q tidak dikenal (clamd atau command)", c.Scanner)
+	}
+}
+
+// initialScanStatus: status untuk file yang baru dicatat di tabel uploads
+func initialScanStatus() string {
+	if scanner == nil {
+		return ScanClean
+	}
+	return ScanPending
+}
+
+// -------------------------
+// ClamAV (protokol clamd, perintah INSTREAM)
+// -------------------------
+type ClamdScanner struct {
+	Network string // "tcp" atau "unix"
+	Address string
+}
+
+// Ukuran potongan INSTREAM; clamd menolak stream yang melebihi StreamMaxLength di clamd.conf
+const clamdChunkSize = 64 << 10
+
+// parseClamdAddress menerima tcp://host:port atau unix:///path/clamd.sock
+func parseClamdAddress(raw string) (string, string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", "", fmt.Errorf("clamd_address: %w", err)
+	}
+	switch {
+	case u.Scheme == "tcp" && u.Host != "":
+		return "tcp", u.Host, nil
+	case u.Scheme == "unix" && u.Path != "":
+		return "unix", u.Path, nil
+	}
+	return "", "", fmt.Errorf("clamd_address %q harus tcp://host:port atau unix:///path", raw)
+}
+
+func (s *ClamdScanner) Scan(ctx context.Context, r io.Reader) (ScanResult, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, s.Network, s.Address)
+	if err != nil {
+		return ScanResult{}, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if err := clamdSend(conn, r); err != nil {
+		// clamd bisa memutus stream lebih dulu (mis. batas ukuran); balasannya lebih jelas dari error tulis
+		if reply, rerr := clamdReply(conn); rerr == nil && reply != "" {
+			return parseClamdReply(reply)
+		}
+		return ScanResult{}, err
+	}
+	reply, err := clamdReply(conn)
+	if err != nil {
+		return ScanResult{}, err
+	}
+	return parseClamdReply(reply)
+}
+
+// clamdSend: "zINSTREAM\0", lalu potongan <panjang uint32 big-endian><data>, diakhiri panjang 0
+func clamdSend(conn net.Conn, r io.Reader) error {
+	if _, err := io.WriteString(conn, "zINSTREAM\x00"); err != nil {
+		return err
+	}
+	buf := make([]byte, 4+clamdChunkSize)
+	for {
+		n, err := io.ReadFull(r, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			if _, werr := conn.Write(buf[:4+n]); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err := conn.Write([]byte{0, 0, 0, 0})
+	return err
+}
+
+// clamdReply membaca satu balasan (perintah berawalan "z" dibalas dengan akhiran NUL)
+func clamdReply(conn net.Conn) (string, error) {
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && !(err == io.EOF && reply != "") {
+		return "", err
+	}
+	return strings.TrimSpace(strings.TrimRight(reply, "\x00")), nil
+}
+
+// parseClamdReply: "stream: OK", "stream: <signature> FOUND" atau "... ERROR"
+func parseClamdReply(reply string) (ScanResult, error) {
+	msg := strings.TrimSpace(strings.TrimPrefix(reply, "stream:"))
+	switch {
+	case msg == "OK":
+		return ScanResult{}, nil
+	case strings.HasSuffix(msg, " FOUND"):
+		return ScanResult{Infected: true, Signature: strings.TrimSuffix(msg, " FOUND")}, nil
+	default:
+		return ScanResult{}, fmt.Errorf("clamd: %s", reply)
+	}
+}
+
+// -------------------------
+// Program eksternal
+// -------------------------
+
+// CommandScanner menjalankan program dengan isi file di stdin. Exit code 0 = bersih,
+// 1 = terinfeksi (output dipakai sebagai signature), selain itu error — sama dengan
+// konvensi clamscan/clamdscan, contoh: ["clamdscan", "--no-summary", "-"].
+type CommandScanner struct {
+	Command []string
+}
+
+const maxScanOutput = 4 << 10
+
+func (s *CommandScanner) Scan(ctx context.Context, r io.Reader) (ScanResult, error) {
+	cmd := exec.CommandContext(ctx, s.Command[0], s.Command[1:]...)
+	cmd.Stdin = r
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	err := cmd.Run()
+	output := strings.TrimSpace(out.String())
+	if len(output) > maxScanOutput {
+		output = output[:maxScanOutput]
+	}
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return ScanResult{}, nil
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == 1:
+		return ScanResult{Infected: true, Signature: commandSignature(output)}, nil
+	default:
+		return ScanResult{}, fmt.Errorf("%s: %v: %s", s.Command[0], err, output)
+	}
+}
+
+// commandSignature mengambil nama malware dari baris "...: <signature> FOUND" kalau ada
+func commandSignature(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasSuffix(line, " FOUND") {
+			line = strings.TrimSuffix(line, " FOUND")
+			if i := strings.LastIndex(line, ": "); i >= 0 {
+				line = line[i+2:]
+			}
+			return line
+		}
+	}
+	return output
+}
+
+// -------------------------
+// Worker pemindai
+// -------------------------
+var scanWake = make(chan struct{}, 1)
+
+// notifyScanner membangunkan worker tanpa menunggu (dipanggil setelah file baru dicatat)
+func notifyScanner() {
+	select {
+	case scanWake <- struct{}{}:
+	default:
+	}
+}
+
+// startScanWorker memindai file pending satu per satu. File yang gagal dipindai
+// (mis. clamd mati) tetap pending dan dicoba lagi setiap interval.
+func startScanWorker(interval time.Duration) {
+	if scanner == nil {
+		return
+	}
+	go func() {
+		for {
+			scanPendingUploads()
+			select {
+			case <-scanWake:
+			case <-time.After(interval):
+			}
+		}
+	}()
+}
+
+const scanBatchSize = 20
+
+// scanPendingUploads memindai per blob: semua file pending yang isinya sama ikut satu hasil
+func scanPendingUploads() {
+	for {
+		rows, err := DB.Query("SELECT DISTINCT blob_sha256 FROM uploads WHERE status = ? AND blob_sha256 IS NOT NULL LIMIT ?", ScanPending, scanBatchSize)
+		if err != nil {
+			log.Printf("scanPendingUploads: query: %v", err)
+			return
+		}
+		var batch []string
+		for rows.Next() {
+			var sum string
+			if err := rows.Scan(&sum); err == nil {
+				batch = append(batch, sum)
+			}
+		}
+		rows.Close()
+
+		progress := false
+		for _, sum := range batch {
+			if err := scanBlob(sum); err != nil {
+				log.Printf("scanPendingUploads: blob %s: %v", sum, err)
+				continue
+			}
+			progress = true
+		}
+		// Tanpa satu pun yang berhasil, scanner kemungkinan bermasalah: tunggu putaran berikutnya
+		if !progress {
+			return
+		}
+	}
+}
+
+func scanBlob(sum string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), scanTimeout)
+	defer cancel()
+
+	rc, err := store.Get(ctx, blobKey(sum), 0, -1)
+	if err != nil {
+		return err
+	}
+	res, err := scanner.Scan(ctx, rc)
+	rc.Close()
+	if err != nil {
+		return err
+	}
+
+	status := ScanClean
+	if res.Infected {
+		status = ScanInfected
+	}
+	// Baris bisa sudah dihapus pemiliknya selama pemindaian; itu bukan error
+	result, err := DB.Exec("UPDATE uploads SET status = ?, scan_result = ?, scanned_at = ? WHERE blob_sha256 = ? AND status = ?",
+		status, res.Signature, time.Now(), sum, ScanPending)
+	if err != nil {
+		return err
+	}
+	n, _ := result.RowsAffected()
+	if res.Infected {
+		log.Printf("Scanner: blob %s (%d file) TERINFEKSI (%s), unduhan diblokir", sum, n, res.Signature)
+	} else {
+		log.Printf("Scanner: blob %s (%d file) bersih", sum, n)
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClamd menerima zINSTREAM di listener lokal dan membalas sesuai isi stream:
+// mengandung "EICAR" = FOUND, mengandung "RUSAK" = ERROR, selain itu OK.
+// Isi yang diterima dikirim ke channel received supaya potongan stream bisa dicek.
+func fakeClamd(t *testing.T) (string, <-chan []byte) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	received := make(chan []byte, 8)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				data, err := readInstream(bufio.NewReader(conn))
+				if err != nil {
+					io.WriteString(conn, "protokol salah. ERROR\x00")
+					return
+				}
+				received <- data
+				switch {
+				case bytes.Contains(data, []byte("EICAR")):
+					io.WriteString(conn, "stream: Eicar-Test-Signature FOUND\x00")
+				case bytes.Contains(data, []byte("RUSAK")):
+					io.WriteString(conn, "INSTREAM size limit exceeded. ERROR\x00")
+				default:
+					io.WriteString(conn, "stream: OK\x00")
+				}
+			}(conn)
+		}
+	}()
+	return "tcp://" + ln.Addr().String(), received
+}
+
+func readInstream(r *bufio.Reader) ([]byte, error) {
+	cmd, err := r.ReadString(0)
+	if err != nil {
+		return nil, err
+	}
+	if cmd != "zINSTREAM\x00" {
+		return nil, io.ErrUnexpectedEOF
+	}
+	var data []byte
+	for {
+		var n uint32
+		if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return data, nil
+		}
+		if n > clamdChunkSize {
+			return nil, io.ErrShortBuffer
+		}
+		chunk := make([]byte, n)
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return nil, err
+		}
+		data = append(data, chunk...)
+	}
+}
+
+func TestClamdScanner(t *testing.T) {
+	addr, received := fakeClamd(t)
+	network, address, err := parseClamdAddress(addr)
+	if err != nil {
+		t.Fatalf("parseClamdAddress(%q): %v", addr, err)
+	}
+	s := &ClamdScanner{Network: network, Address: address}
+
+	// Lebih dari dua potongan supaya pemecahan stream ikut teruji
+	big := bytes.Repeat([]byte("bersih "), 2*clamdChunkSize/7+100)
+	tests := []struct {
+		desc      string
+		data      []byte
+		infected  bool
+		signature string
+		wantErr   bool
+	}{
+		{"OK", []byte("laporan keuangan"), false, "", false},
+		{"OK besar", big, false, "", false},
+		{"kosong", nil, false, "", false},
+		{"FOUND", []byte("X5O!P%@AP EICAR-STANDARD-ANTIVIRUS-TEST-FILE"), true, "Eicar-Test-Signature", false},
+		{"ERROR", []byte("file RUSAK"), false, "", true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			res, err := s.Scan(ctx, bytes.NewReader(tc.data))
+			if tc.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "ERROR") {
+					t.Fatalf("Scan = %+v, %v; mau error clamd", res, err)
+				}
+			} else if err != nil {
+				t.Fatalf("Scan: %v", err)
+			}
+			if res.Infected != tc.infected || res.Signature != tc.signature {
+				t.Errorf("Scan = %+v; mau infected=%v signature=%q", res, tc.infected, tc.signature)
+			}
+			if got := <-received; !bytes.Equal(got, tc.data) {
+				t.Errorf("clamd menerima %d byte, mau %d", len(got), len(tc.data))
+			}
+		})
+	}
+}
+
+func TestClamdScannerUnreachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	s := &ClamdScanner{Network: "tcp", Address: addr}
+	if res, err := s.Scan(context.Background(), strings.NewReader("x")); err == nil {
+		t.Fatalf("Scan ke clamd mati = %+v; mau error", res)
+	}
+}
+
+func TestParseClamdAddress(t *testing.T) {
+	tests := []struct {
+		in, network, address string
+		ok                   bool
+	}{
+		{"tcp://127.0.0.1:3310", "tcp", "127.0.0.1:3310", true},
+		{"unix:///run/clamav/clamd.ctl", "unix", "/run/clamav/clamd.ctl", true},
+		{"127.0.0.1:3310", "", "", false},
+		{"tcp://", "", "", false},
+		{"unix://", "", "", false},
+		{"http://localhost:3310", "", "", false},
+	}
+	for _, tc := range tests {
+		network, address, err := parseClamdAddress(tc.in)
+		if tc.ok != (err == nil) || network != tc.network || address != tc.address {
+			t.Errorf("parseClamdAddress(%q) = %q, %q, %v", tc.in, network, address, err)
+		}
+	}
+}
+
+func TestCommandScannerExitCodes(t *testing.T) {
+	tests := []struct {
+		desc      string
+		script    string
+		infected  bool
+		signature string
+		wantErr   bool
+	}{
+		// Isi file harus sampai di stdin
+		{"exit 0 bersih", `test "$(cat)" = "isi file" || exit 2`, false, "", false},
+		{"exit 1 terinfeksi", `cat >/dev/null; echo "stdin: Eicar-Test-Signature FOUND"; exit 1`, true, "Eicar-Test-Signature", false},
+		{"exit 1 tanpa FOUND", `cat >/dev/null; echo "virus aneh"; exit 1`, true, "virus aneh", false},
+		{"exit 2 error", `cat >/dev/null; echo "database tidak ada" >&2; exit 2`, false, "", true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			s := &CommandScanner{Command: []string{"sh", "-c", tc.script}}
+			res, err := s.Scan(context.Background(), strings.NewReader("isi file"))
+			if tc.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "database tidak ada") {
+					t.Fatalf("Scan = %+v, %v; mau error dengan output program", res, err)
+				}
+			} else if err != nil {
+				t.Fatalf("Scan: %v", err)
+			}
+			if res.Infected != tc.infected || res.Signature != tc.signature {
+				t.Errorf("Scan = %+v; mau infected=%v signature=%q", res, tc.infected, tc.signature)
+			}
+		})
+	}
+}
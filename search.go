@@ -0,0 +1,501 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Pencarian file: nama (path lengkap), tags, deskripsi dan teks PDF versi aktif file yang bisa
+// diakses user (milik sendiri atau lewat acl). Kalau SQLite di-build dengan FTS5 (go build
+// -tags sqlite_fts5), pencarian memakai indeks files_fts yang dijaga trigger di tabel uploads
+// dan blob_text; kalau tidak, pencarian jatuh ke LIKE biasa tanpa urutan relevansi.
+
+const (
+	searchDefaultLimit = 10
+	searchMaxLimit     = 100
+	textIndexBatchSize = 20
+)
+
+// Diisi saat startup (lihat initSearchIndex dan applyConfig); textIndexMaxSize 0 = ekstraksi teks nonaktif
+var (
+	ftsEnabled       bool
+	textIndexMaxSize int64 = 32 << 20
+)
+
+var searchTriggers = []string{"uploads_fts_insert", "uploads_fts_update", "uploads_fts_delete", "blob_text_fts"}
+
+// Kolom files_fts: rowid = uploads.id, satu baris per versi (filter versi aktif dilakukan saat query)
+const createSearchIndex = `
+CREATE VIRTUAL TABLE IF NOT EXISTS files_fts USING fts5(
+	filename, tags, description, body,
+	tokenize = 'unicode61 remove_diacritics 2'
+);
+CREATE TRIGGER IF NOT EXISTS uploads_fts_insert AFTER INSERT ON uploads BEGIN
+	INSERT INTO files_fts (rowid, filename, tags, description, body)
+	VALUES (new.id, new.filename, COALESCE(new.tags, ''), COALESCE(new.description, ''),
+		COALESCE((SELECT text FROM blob_text WHERE sha256 = new.blob_sha256), ''));
+END;
+CREATE TRIGGER IF NOT EXISTS uploads_fts_update AFTER UPDATE OF filename, tags, description, blob_sha256 ON uploads BEGIN
+	DELETE FROM files_fts WHERE rowid = old.id;
+	INSERT INTO files_fts (rowid, filename, tags, description, body)
+	VALUES (new.id, new.filename, COALESCE(new.tags, ''), COALESCE(new.description, ''),
+		COALESCE((SELECT text FROM blob_text WHERE sha256 = new.blob_sha256), ''));
+END;
+CREATE TRIGGER IF NOT EXISTS uploads_fts_delete AFTER DELETE ON uploads BEGIN
+	DELETE FROM files_fts WHERE rowid = old.id;
+END;
+CREATE TRIGGER IF NOT EXISTS blob_text_fts AFTER INSERT ON blob_text BEGIN
+	UPDATE files_fts SET body = new.text WHERE rowid IN (SELECT id FROM uploads WHERE blob_sha256 = new.sha256);
+END;
+`
+
+// initSearchIndex menyiapkan indeks FTS5 kalau tersedia. Trigger dibuang kalau FTS5 tidak ada
+// (mis. database yang sama dibuka binary tanpa tag sqlite_fts5) supaya insert uploads tidak gagal;
+// saat trigger dibuat ulang, indeks dibangun ulang dari tabel uploads.
+func initSearchIndex() error {
+	var used int
+	if err := DB.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&used); err != nil {
+		return err
+	}
+	ftsEnabled = used == 1
+
+	if !ftsEnabled {
+		for _, name := range searchTriggers {
+			if _, err := DB.Exec("DROP TRIGGER IF EXISTS " + name); err != nil {
+				return err
+			}
+		}
+		log.Println("initSearchIndex: SQLite tanpa FTS5, /search memakai LIKE (build dengan -tags sqlite_fts5 untuk indeks teks penuh)")
+		return nil
+	}
+
+	var existing int
+	err := DB.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name = ?", searchTriggers[0]).Scan(&existing)
+	if err != nil {
+		return err
+	}
+	if _, err := DB.Exec(createSearchIndex); err != nil {
+		return err
+	}
+	if existing > 0 {
+		return nil
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM files_fts"); err != nil {
+		return err
+	}
+	res, err := tx.Exec(`INSERT INTO files_fts (rowid, filename, tags, description, body)
+		SELECT u.id, COALESCE(u.filename, ''), COALESCE(u.tags, ''), COALESCE(u.description, ''), COALESCE(t.text, '')
+		FROM uploads u LEFT JOIN blob_text t ON t.sha256 = u.blob_sha256`)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	n, _ := res.RowsAffected()
+	log.Printf("initSearchIndex: indeks pencarian dibangun ulang (%d baris)", n)
+	return nil
+}
+
+// -------------------------
+// Ekstraksi teks PDF di background
+// -------------------------
+
+var textIndexWake = make(chan struct{}, 1)
+
+// notifyTextIndexer membangunkan worker tanpa menunggu (dipanggil setelah versi baru dicatat)
+func notifyTextIndexer() {
+	select {
+	case textIndexWake <- struct{}{}:
+	default:
+	}
+}
+
+// startTextIndexer mengekstrak teks PDF yang belum punya baris blob_text. Blob yang gagal
+// dibaca dari storage dicoba lagi setiap interval.
+func startTextIndexer(interval time.Duration) {
+	if textIndexMaxSize == 0 {
+		return
+	}
+	go func() {
+		for {
+			indexPendingTexts()
+			select {
+			case <-textIndexWake:
+			case <-time.After(interval):
+			}
+		}
+	}()
+}
+
+func indexPendingTexts() {
+	for {
+		rows, err := DB.Query(`SELECT DISTINCT b.sha256, b.size FROM uploads u
+			JOIN blobs b ON b.sha256 = u.blob_sha256
+			LEFT JOIN blob_text t ON t.sha256 = u.blob_sha256
+			WHERE u.mime_type = 'application/pdf' AND t.sha256 IS NULL LIMIT ?`, textIndexBatchSize)
+		if err != nil {
+			log.Printf("indexPendingTexts: query: %v", err)
+			return
+		}
+		type pending struct {
+			sum  string
+			size int64
+		}
+		var batch []pending
+		for rows.Next() {
+			var p pending
+			if err := rows.Scan(&p.sum, &p.size); err == nil {
+				batch = append(batch, p)
+			}
+		}
+		rows.Close()
+
+		for _, p := range batch {
+			if err := indexBlobText(context.Background(), p.sum, p.size); err != nil {
+				// Sisanya ditunggu sampai interval berikutnya supaya tidak berputar terus
+				log.Printf("indexPendingTexts: blob %s: %v", p.sum, err)
+				return
+			}
+		}
+		if len(batch) < textIndexBatchSize {
+			return
+		}
+	}
+}
+
+// indexBlobText menyimpan teks satu blob. PDF yang lebih besar dari text_index_max_size atau
+// tanpa teks terbaca dicatat dengan teks kosong supaya tidak diproses lagi.
+func indexBlobText(ctx context.Context, sum string, size int64) error {
+	text := ""
+	if size <= textIndexMaxSize {
+		rc, err := store.Get(ctx, blobKey(sum), 0, -1)
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(io.LimitReader(rc, textIndexMaxSize))
+		rc.Close()
+		if err != nil {
+			return err
+		}
+		text = extractPDFText(data)
+	}
+
+	// Blob bisa saja dilepas selama ekstraksi; baris blob_text hanya dicatat kalau blob masih ada
+	unlock := lockBlob(sum)
+	defer unlock()
+	_, err := DB.Exec(`INSERT OR IGNORE INTO blob_text (sha256, text, extracted_at)
+		SELECT ?, ?, ? WHERE EXISTS (SELECT 1 FROM blobs WHERE sha256 = ?)`, sum, text, time.Now(), sum)
+	return err
+}
+
+// -------------------------
+// Query pencarian
+// -------------------------
+
+// SearchQuery: parameter GET /search yang sudah divalidasi
+type SearchQuery struct {
+	Terms   []string
+	Types   []string // MIME persis ("application/pdf") atau awalan ("image", "image/*")
+	MinSize int64    // -1 = tanpa batas
+	MaxSize int64
+	From    string // YYYY-MM-DD, "" = tanpa batas
+	To      string
+	Owner   string
+	Sort    string
+	Page    int
+	Limit   int
+}
+
+// SearchHit: satu file di hasil pencarian (versi aktif)
+type SearchHit struct {
+	Owner       string    `json:"owner"`
+	Filename    string    `json:"filename"`
+	Version     int64     `json:"version"`
+	Size        int64     `json:"size"`
+	MIMEType    string    `json:"mime_type"`
+	SHA256      string    `json:"sha256"`
+	Status      string    `json:"status"`
+	Tags        []string  `json:"tags"`
+	Description string    `json:"description"`
+	UploadedAt  time.Time `json:"uploaded_at"`
+	Snippet     string    `json:"snippet,omitempty"`
+}
+
+// SearchResult: satu halaman hasil + jumlah total dan facet dari semua hasil yang cocok
+type SearchResult struct {
+	Total   int                       `json:"total"`
+	Page    int                       `json:"page"`
+	Limit   int                       `json:"limit"`
+	Sort    string                    `json:"sort"`
+	Engine  string                    `json:"engine"` // "fts5" atau "like"
+	Results []SearchHit               `json:"results"`
+	Facets  map[string]map[string]int `json:"facets"`
+}
+
+// searchSorts: urutan yang bisa dipilih lewat ?sort=; relevance hanya berlaku kalau ada q di mode FTS5
+var searchSorts = map[string]string{
+	"relevance": "score",
+	"date":      "u.uploaded_at DESC",
+	"date_asc":  "u.uploaded_at ASC",
+	"name":      "u.filename ASC",
+	"name_desc": "u.filename DESC",
+	"size":      "COALESCE(u.size, 0) ASC",
+	"size_desc": "COALESCE(u.size, 0) DESC",
+}
+
+// Bobot bm25 per kolom files_fts: nama file paling penting, teks isi paling rendah
+const searchRank = "bm25(files_fts, 10.0, 5.0, 2.0, 1.0)"
+
+// ftsQuery mengubah kata pencarian jadi query FTS5: tiap kata dikutip (karakter khusus FTS5
+// tidak berlaku) dan dicocokkan sebagai awalan, semua kata harus ada
+func ftsQuery(terms []string) string {
+	quoted := make([]string, len(terms))
+	for i, t := range terms {
+		quoted[i] = `"` + strings.ReplaceAll(t, `"`, `""`) + `"*`
+	}
+	return strings.Join(quoted, " ")
+}
+
+// likePattern membungkus kata untuk LIKE ... ESCAPE '\' (cocok di mana saja)
+func likePattern(term string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return "%" + r.Replace(term) + "%"
+}
+
+// searchWhere menyusun FROM + WHERE bersama untuk hasil, total dan facet
+func searchWhere(username string, q SearchQuery) (string, []interface{}) {
+	from := " FROM uploads u"
+	where := []string{
+		"u.deleted_at IS NULL",
+		"u.version = (SELECT MAX(version) FROM uploads v WHERE v.username = u.username AND v.filename = u.filename AND v.deleted_at IS NULL)",
+		"(u.username = ? OR EXISTS (SELECT 1 FROM acl WHERE acl.owner = u.username AND " + fileGrantMatch + " AND " + granteeMatch + "))",
+	}
+	args := []interface{}{username, username, username}
+
+	if len(q.Terms) > 0 {
+		if ftsEnabled {
+			from += " JOIN files_fts ON files_fts.rowid = u.id"
+			where = append(where, "files_fts MATCH ?")
+			args = append(args, ftsQuery(q.Terms))
+		} else {
+			from += " LEFT JOIN blob_text t ON t.sha256 = u.blob_sha256"
+			for _, term := range q.Terms {
+				where = append(where, `(u.filename LIKE ? ESCAPE '\' OR COALESCE(u.tags, '') LIKE ? ESCAPE '\'
+					OR COALESCE(u.description, '') LIKE ? ESCAPE '\' OR COALESCE(t.text, '') LIKE ? ESCAPE '\')`)
+				pattern := likePattern(term)
+				args = append(args, pattern, pattern, pattern, pattern)
+			}
+		}
+	}
+
+	if len(q.Types) > 0 {
+		var match []string
+		for _, t := range q.Types {
+			if prefix, ok := strings.CutSuffix(t, "/*"); ok || !strings.Contains(t, "/") {
+				// Awalan tipe: "image" atau "image/*" cocok dengan image/png, image/jpeg, ...
+				match = append(match, "substr(COALESCE(u.mime_type, ''), 1, length(?)) = ?")
+				args = append(args, prefix+"/", prefix+"/")
+				continue
+			}
+			// MIME persis, termasuk yang punya parameter ("text/plain; charset=utf-8")
+			match = append(match, "(u.mime_type = ? OR substr(COALESCE(u.mime_type, ''), 1, length(?)) = ?)")
+			args = append(args, t, t+";", t+";")
+		}
+		where = append(where, "("+strings.Join(match, " OR ")+")")
+	}
+	if q.MinSize >= 0 {
+		where = append(where, "COALESCE(u.size, 0) >= ?")
+		args = append(args, q.MinSize)
+	}
+	if q.MaxSize >= 0 {
+		where = append(where, "COALESCE(u.size, 0) <= ?")
+		args = append(args, q.MaxSize)
+	}
+	if q.From != "" {
+		where = append(where, "DATE(u.uploaded_at) >= DATE(?)")
+		args = append(args, q.From)
+	}
+	if q.To != "" {
+		where = append(where, "DATE(u.uploaded_at) <= DATE(?)")
+		args = append(args, q.To)
+	}
+	if q.Owner != "" {
+		where = append(where, "u.username = ?")
+		args = append(args, q.Owner)
+	}
+	return from + " WHERE " + strings.Join(where, " AND "), args
+}
+
+func searchFiles(username string, q SearchQuery) (*SearchResult, error) {
+	from, args := searchWhere(username, q)
+	res := &SearchResult{
+		Page:    q.Page,
+		Limit:   q.Limit,
+		Sort:    q.Sort,
+		Engine:  "like",
+		Results: []SearchHit{},
+		Facets:  map[string]map[string]int{"types": {}, "owners": {}},
+	}
+	ranked := ftsEnabled && len(q.Terms) > 0
+	if ftsEnabled {
+		res.Engine = "fts5"
+	}
+
+	if err := DB.QueryRow("SELECT COUNT(*)"+from, args...).Scan(&res.Total); err != nil {
+		return nil, err
+	}
+	for name, column := range map[string]string{"types": "COALESCE(u.mime_type, '')", "owners": "u.username"} {
+		rows, err := DB.Query("SELECT "+column+", COUNT(*)"+from+" GROUP BY 1", args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var key string
+			var n int
+			if err := rows.Scan(&key, &n); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			res.Facets[name][key] = n
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	columns := `SELECT u.username, u.filename, u.version, COALESCE(u.size, 0), COALESCE(u.mime_type, ''),
+		COALESCE(u.blob_sha256, ''), u.status, COALESCE(u.tags, ''), COALESCE(u.description, ''), u.uploaded_at, `
+	order := searchSorts[q.Sort]
+	if ranked {
+		columns += "snippet(files_fts, -1, '[', ']', '…', 12), " + searchRank + " AS score"
+	} else {
+		columns += "'', 0 AS score"
+		if q.Sort == "relevance" {
+			order = searchSorts["date"]
+		}
+	}
+	query := columns + from + " ORDER BY " + order + ", u.id DESC LIMIT ? OFFSET ?"
+	rows, err := DB.Query(query, append(args, q.Limit, (q.Page-1)*q.Limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var h SearchHit
+		var tags string
+		var score float64
+		if err := rows.Scan(&h.Owner, &h.Filename, &h.Version, &h.Size, &h.MIMEType, &h.SHA256, &h.Status,
+			&tags, &h.Description, &h.UploadedAt, &h.Snippet, &score); err != nil {
+			return nil, err
+		}
+		h.Tags = splitTags(tags)
+		res.Results = append(res.Results, h)
+	}
+	return res, rows.Err()
+}
+
+// parseSearchQuery membaca dan memvalidasi parameter /search
+func parseSearchQuery(r *http.Request) (SearchQuery, error) {
+	v := r.URL.Query()
+	q := SearchQuery{
+		Terms:   strings.Fields(v.Get("q")),
+		MinSize: -1,
+		MaxSize: -1,
+		Owner:   v.Get("owner"),
+		Sort:    v.Get("sort"),
+		Page:    1,
+		Limit:   searchDefaultLimit,
+	}
+
+	for _, t := range strings.Split(v.Get("type"), ",") {
+		if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+			q.Types = append(q.Types, t)
+		}
+	}
+	for name, dst := range map[string]*int64{"min_size": &q.MinSize, "max_size": &q.MaxSize} {
+		if raw := v.Get(name); raw != "" {
+			n, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil || n < 0 {
+				return q, fmt.Errorf("%s %q tidak valid", name, raw)
+			}
+			*dst = n
+		}
+	}
+	for name, dst := range map[string]*string{"from": &q.From, "to": &q.To} {
+		if raw := v.Get(name); raw != "" {
+			if _, err := time.Parse("2006-01-02", raw); err != nil {
+				return q, fmt.Errorf("%s %q tidak valid (format YYYY-MM-DD)", name, raw)
+			}
+			*dst = raw
+		}
+	}
+	for name, dst := range map[string]*int{"page": &q.Page, "limit": &q.Limit} {
+		if raw := v.Get(name); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 1 {
+				return q, fmt.Errorf("%s %q tidak valid", name, raw)
+			}
+			*dst = n
+		}
+	}
+	if q.Limit > searchMaxLimit {
+		q.Limit = searchMaxLimit
+	}
+
+	if q.Sort == "" {
+		q.Sort = "date"
+		if len(q.Terms) > 0 {
+			q.Sort = "relevance"
+		}
+	}
+	if _, ok := searchSorts[q.Sort]; !ok {
+		return q, fmt.Errorf("sort %q tidak dikenal", q.Sort)
+	}
+	return q, nil
+}
+
+// -------------------------
+// Pencarian file
+// -------------------------
+
+// GET /search?q=&type=&min_size=&max_size=&from=&to=&owner=&sort=&page=&limit=
+func SearchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	p, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+	q, err := parseSearchQuery(r)
+	if err != nil {
+		http.Error(w, "Parameter tidak valid: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res, err := searchFiles(p.Username, q)
+	if err != nil {
+		http.Error(w, "Gagal mencari file", http.StatusInternalServerError)
+		log.Printf("SearchHandler: DB error: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+	log.Printf("SearchHandler: user=%s q=%q total=%d (page=%d limit=%d)", p.Username, strings.Join(q.Terms, " "), res.Total, q.Page, q.Limit)
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Status sesi upload chunk
+const (
+	SessionActive    = "active"
+	SessionMerging   = "merging"
+	SessionCompleted = "completed"
+	SessionCancelled = "cancelled"
+)
+
+var (
+	errFileTooLarge        = errors.New("ukuran file melebihi batas")
+	errExtensionNotAllowed = errors.New("ekstensi file tidak diizinkan")
+	errTypeNotAllowed      = errors.New("tipe file tidak diizinkan")
+	errSessionNotFound     = errors.New("sesi upload tidak ditemukan")
+	errSessionMismatch     = errors.New("parameter upload tidak cocok dengan sesi yang sudah ada")
+	errSessionNotActive    = errors.New("sesi upload sedang atau sudah di-merge")
+)
+
+var uploadSessionMaxAge = 6 * time.Hour // dari config chunk_max_age
+
+// Ukuran chunk yang ditawarkan ke client kalau client tidak meminta ukuran tertentu;
+// permintaan client tetap dibatasi minChunkSize..maxChunkSize
+const (
+	defaultChunkSize = 8 << 20
+	minChunkSize     = 64 << 10
+)
+
+// UploadSession adalah catatan resmi satu upload chunk. Received adalah bitmap:
+// bit ke-i menyala kalau chunk i sudah tertulis utuh di chunkTempDir/<id>/data.
+type UploadSession struct {
+	ID           string
+	Owner        string
+	Filename     string
+	OriginalName string // nama file dari client sebelum sanitasi
+	TotalSize    int64  // 0 = tidak dideklarasikan client
+	ChunkSize    int64  // 0 = tidak dideklarasikan client
+	TotalChunks  int
+	Received     []byte
+	Offset       int64 // byte yang sudah diterima berurutan (dipakai endpoint tus)
+	Status       string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// sessionLocks: satu lock per sesi upload. /upload-chunk memegang RLock (chunk berbeda boleh
+// ditulis paralel); merge, PATCH tus dan pembatalan memegang Lock, jadi file data tidak bisa
+// berubah selama dicek, di-hash lalu dipindah ke storage.
+var sessionLocks sync.Map // id → *sync.RWMutex
+
+func sessionLock(id string) *sync.RWMutex {
+	m, _ := sessionLocks.LoadOrStore(id, &sync.RWMutex{})
+	return m.(*sync.RWMutex)
+}
+
+func (s *UploadSession) hasChunk(i int) bool {
+	return i >= 0 && i/8 < len(s.Received) && s.Received[i/8]&(1<<(i%8)) != 0
+}
+
+// receivedChunks mengembalikan index chunk yang sudah diterima, urut naik
+func (s *UploadSession) receivedChunks() []int {
+	out := []int{}
+	for i := 0; i < s.TotalChunks; i++ {
+		if s.hasChunk(i) {
+			out = append(out, i)
+		}
+	}
+	return out
+}
+
+// -------------------------
+// Akses tabel upload_sessions
+// -------------------------
+func scanUploadSession(row interface{ Scan(...interface{}) error }) (*UploadSession, error) {
+	var s UploadSession
+	err := row.Scan(&s.ID, &s.Owner, &s.Filename, &s.OriginalName, &s.TotalSize, &s.ChunkSize, &s.TotalChunks, &s.Received, &s.Offset, &s.Status, &s.CreatedAt, &s.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+const uploadSessionColumns = "id, owner, filename, original_name, total_size, chunk_size, total_chunks, received, upload_offset, status, created_at, updated_at"
+
+func getUploadSession(id string) (*UploadSession, error) {
+	return scanUploadSession(DB.QueryRow("SELECT "+uploadSessionColumns+" FROM upload_sessions WHERE id = ?", id))
+}
+
+// getOwnedSession: sesi milik user lain diperlakukan seperti tidak ada
+func getOwnedSession(id, owner string) (*UploadSession, error) {
+	s, err := getUploadSession(id)
+	if err != nil {
+		return nil, err
+	}
+	if s.Owner != owner {
+		return nil, errSessionNotFound
+	}
+	return s, nil
+}
+
+// openUploadSession membuat sesi baru, atau mengembalikan sesi yang sudah ada kalau
+// pemilik dan parameternya sama. Sesi milik user lain dianggap tidak ada (errSessionNotFound).
+func openUploadSession(want *UploadSession) (*UploadSession, error) {
+	now := time.Now()
+	_, err := DB.Exec(`INSERT INTO upload_sessions (id, owner, filename, original_name, total_size, chunk_size, total_chunks, received, status, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT(id) DO NOTHING`,
+		want.ID, want.Owner, want.Filename, want.OriginalName, want.TotalSize, want.ChunkSize, want.TotalChunks,
+		make([]byte, (want.TotalChunks+7)/8), SessionActive, now, now)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := getOwnedSession(want.ID, want.Owner)
+	if err != nil {
+		return nil, err
+	}
+	if s.Filename != want.Filename || s.TotalChunks != want.TotalChunks ||
+		s.ChunkSize != want.ChunkSize || s.TotalSize != want.TotalSize {
+		return nil, errSessionMismatch
+	}
+	return s, nil
+}
+
+// newUploadSession memvalidasi nama, folder tujuan, kebijakan tipe file (lihat FilePolicy.Check) dan kuota
+// sebelum satu byte pun dikirim, lalu membuat sesi dengan ID acak beserta folder chunk-nya.
+// Nama file di sesi sudah berupa path lengkap di dalam folder tujuan.
+// chunkSize <= 0 atau >= size berarti seluruh file dikirim sebagai satu chunk.
+func newUploadSession(p *Principal, folder, rawName string, size, chunkSize int64) (*UploadSession, error) {
+	owner := p.Username
+	filename, err := sanitizeUploadName(rawName)
+	if err != nil {
+		return nil, err
+	}
+	folder, err = uploadFolder(owner, folder)
+	if err != nil {
+		return nil, err
+	}
+	filename = joinPath(folder, filename)
+	if _, err := filePolicy.Check(p.Roles, filename, size); err != nil {
+		return nil, err
+	}
+	// Ukuran sesi langsung dipesan dari kuota, jadi dicek sebelum sesi dibuat
+	if err := checkQuota(owner, size, ""); err != nil {
+		return nil, err
+	}
+
+	totalChunks := 1
+	if chunkSize <= 0 || chunkSize >= size {
+		chunkSize = size
+	} else {
+		totalChunks = int((size + chunkSize - 1) / chunkSize)
+	}
+
+	id, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := safeJoin(chunkTempDir, id)
+	if err != nil {
+		return nil, err
+	}
+	s, err := openUploadSession(&UploadSession{
+		ID:           id,
+		Owner:        owner,
+		Filename:     filename,
+		OriginalName: rawName,
+		TotalSize:    size,
+		ChunkSize:    chunkSize,
+		TotalChunks:  totalChunks,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := createSessionDataFile(dir, size); err != nil {
+		deleteUploadSession(id)
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return s, nil
+}
+
+// sessionDataFile: isi upload ditulis langsung ke satu file berukuran penuh di folder sesi,
+// tiap chunk di offset index*chunk_size, sehingga chunk boleh datang paralel dan acak
+const sessionDataFile = "data"
+
+// createSessionDataFile membuat file data yang sudah dialokasikan sebesar size
+// (sparse di filesystem yang mendukung, jadi tidak langsung memakan disk)
+func createSessionDataFile(dir string, size int64) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(filepath.Join(dir, sessionDataFile))
+	if err != nil {
+		return err
+	}
+	if err := f.Truncate(size); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// negotiateChunkSize memilih ukuran chunk dari permintaan client (0 = terserah server)
+func negotiateChunkSize(requested int64) int64 {
+	size := requested
+	if size <= 0 {
+		size = defaultChunkSize
+	}
+	if size < minChunkSize {
+		size = minChunkSize
+	}
+	if maxChunkSize > 0 && size > maxChunkSize {
+		size = maxChunkSize
+	}
+	return size
+}
+
+// chunkOffset: posisi byte chunk i di file data
+func (s *UploadSession) chunkOffset(i int) int64 {
+	return int64(i) * s.ChunkSize
+}
+
+// expectedChunkSize: semua chunk berukuran ChunkSize kecuali yang terakhir (sisa file)
+func (s *UploadSession) expectedChunkSize(i int) int64 {
+	if i == s.TotalChunks-1 {
+		return s.TotalSize - int64(s.TotalChunks-1)*s.ChunkSize
+	}
+	return s.ChunkSize
+}
+
+// setChunkReceived menyalakan/mematikan bit chunk index di bitmap sesi
+func setChunkReceived(id string, index int, received bool) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var bitmap []byte
+	var status string
+	err = tx.QueryRow("SELECT received, status FROM upload_sessions WHERE id = ?", id).Scan(&bitmap, &status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errSessionNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if index < 0 || index/8 >= len(bitmap) {
+		return errSessionMismatch
+	}
+	// Chunk yang datang saat merge berjalan tidak boleh ikut tercatat
+	if received && status != SessionActive {
+		return errSessionNotActive
+	}
+
+	if received {
+		bitmap[index/8] |= 1 << (index % 8)
+	} else {
+		bitmap[index/8] &^= 1 << (index % 8)
+	}
+	if _, err := tx.Exec("UPDATE upload_sessions SET received = ?, updated_at = ? WHERE id = ?", bitmap, time.Now(), id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// setSessionStatus hanya berhasil kalau status saat ini masih from,
+// sehingga dua merge paralel untuk sesi yang sama tidak bisa jalan bersamaan.
+func setSessionStatus(id, from, to string) error {
+	res, err := DB.Exec("UPDATE upload_sessions SET status = ?, updated_at = ? WHERE id = ? AND status = ?", to, time.Now(), id, from)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errSessionNotActive
+	}
+	return nil
+}
+
+// setUploadOffset mencatat jumlah byte yang sudah diterima, sekaligus memperpanjang umur sesi
+func setUploadOffset(id string, offset int64) error {
+	_, err := DB.Exec("UPDATE upload_sessions SET upload_offset = ?, updated_at = ? WHERE id = ?", offset, time.Now(), id)
+	return err
+}
+
+// expired: sesi yang belum selesai dan tidak disentuh lebih lama dari uploadSessionMaxAge
+func (s *UploadSession) expired() bool {
+	return s.Status != SessionCompleted && time.Since(s.UpdatedAt) > uploadSessionMaxAge
+}
+
+func (s *UploadSession) expiresAt() time.Time {
+	return s.UpdatedAt.Add(uploadSessionMaxAge)
+}
+
+func deleteUploadSession(id string) error {
+	_, err := DB.Exec("DELETE FROM upload_sessions WHERE id = ?", id)
+	return err
+}
+
+// -------------------------
+// Pembersihan sesi lama (dipanggil dari startChunkCleaner)
+// -------------------------
+func purgeStaleUploadSessions(maxAge time.Duration) {
+	// Sesi "merging" yang tertinggal (mis. server mati di tengah merge) ikut dibersihkan
+	rows, err := DB.Query("SELECT id FROM upload_sessions WHERE updated_at < ?", time.Now().Add(-maxAge))
+	if err != nil {
+		log.Printf("purgeStaleUploadSessions: query: %v", err)
+		return
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		if dir, err := safeJoin(chunkTempDir, id); err == nil {
+			os.RemoveAll(dir)
+		}
+		if err := deleteUploadSession(id); err != nil {
+			log.Printf("purgeStaleUploadSessions: hapus sesi %s: %v", id, err)
+			continue
+		}
+		log.Println("Cleaner: menghapus sesi upload", id)
+	}
+
+	// Folder chunk tanpa sesi (mis. sisa versi lama yang memakai meta.json)
+	entries, err := os.ReadDir(chunkTempDir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if !e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || time.Since(info.ModTime()) <= maxAge {
+			continue
+		}
+		if _, err := getUploadSession(e.Name()); errors.Is(err, errSessionNotFound) {
+			log.Println("Cleaner: menghapus", filepath.Join(chunkTempDir, e.Name()))
+			os.RemoveAll(filepath.Join(chunkTempDir, e.Name()))
+		}
+	}
+}
@@ -0,0 +1,463 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Link share membuka satu file milik user ke siapa saja yang memegang link /s/<token>, tanpa login.
+// Token = <id>.<HMAC(jwt_secret, id)>, jadi link palsu ditolak sebelum menyentuh database
+// (mengganti jwt_secret ikut membatalkan semua link). Setiap akses dicatat di share_access.
+const shareBasePath = "/s/"
+
+var (
+	errShareNotFound = errors.New("share tidak ditemukan")
+	errShareInvalid  = errors.New("parameter share tidak valid")
+)
+
+// Hasil akses link share yang dicatat di share_access
+const (
+	ShareServed      = "served"
+	ShareNeedsPass   = "password_required"
+	ShareBadPassword = "bad_password"
+	ShareRevoked     = "revoked"
+	ShareExpired     = "expired"
+	ShareLimit       = "limit_reached"
+	ShareFileMissing = "not_found"
+	ShareBlocked     = "blocked" // file belum/tidak lolos pemindaian
+)
+
+type Share struct {
+	ID            string     `json:"id"`
+	Filename      string     `json:"filename"`
+	Version       *int64     `json:"version"` // null = selalu versi aktif
+	URL           string     `json:"url"`
+	HasPassword   bool       `json:"has_password"`
+	ExpiresAt     *time.Time `json:"expires_at"`
+	MaxDownloads  *int64     `json:"max_downloads"`
+	DownloadCount int64      `json:"download_count"`
+	CreatedAt     time.Time  `json:"created_at"`
+	RevokedAt     *time.Time `json:"revoked_at"`
+	SuspendedAt   *time.Time `json:"suspended_at"` // terisi selama filenya di tempat sampah
+
+	owner        string
+	passwordHash string
+}
+
+type ShareAccess struct {
+	AccessedAt time.Time `json:"accessed_at"`
+	RemoteAddr string    `json:"remote_addr"`
+	UserAgent  string    `json:"user_agent"`
+	Result     string    `json:"result"`
+}
+
+// -------------------------
+// Token link
+// -------------------------
+func shareSignature(id string) string {
+	m := hmac.New(sha256.New, jwtKey)
+	m.Write([]byte("share:" + id))
+	return base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+}
+
+func shareToken(id string) string {
+	return id + "." + shareSignature(id)
+}
+
+// parseShareToken mengembalikan id share kalau tanda tangan token cocok
+func parseShareToken(token string) (string, bool) {
+	id, sig, ok := strings.Cut(token, ".")
+	if !ok || id == "" {
+		return "", false
+	}
+	return id, hmac.Equal([]byte(sig), []byte(shareSignature(id)))
+}
+
+// -------------------------
+// Akses tabel shares
+// -------------------------
+const shareColumns = "id, owner, filename, version, COALESCE(password_hash, ''), expires_at, max_downloads, download_count, created_at, revoked_at, suspended_at"
+
+func scanShare(row interface{ Scan(...interface{}) error }) (*Share, error) {
+	var s Share
+	err := row.Scan(&s.ID, &s.owner, &s.Filename, &s.Version, &s.passwordHash, &s.ExpiresAt, &s.MaxDownloads, &s.DownloadCount, &s.CreatedAt, &s.RevokedAt, &s.SuspendedAt)
+	if err != nil {
+		return nil, err
+	}
+	s.HasPassword = s.passwordHash != ""
+	s.URL = shareBasePath + shareToken(s.ID)
+	return &s, nil
+}
+
+func getShare(id string) (*Share, error) {
+	s, err := scanShare(DB.QueryRow("SELECT "+shareColumns+" FROM shares WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errShareNotFound
+	}
+	return s, err
+}
+
+func listShares(owner, filename string) ([]Share, error) {
+	query := "SELECT " + shareColumns + " FROM shares WHERE owner = ?"
+	args := []interface{}{owner}
+	if filename != "" {
+		query += " AND filename = ?"
+		args = append(args, filename)
+	}
+	rows, err := DB.Query(query+" ORDER BY created_at DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shares := []Share{}
+	for rows.Next() {
+		s, err := scanShare(rows)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, *s)
+	}
+	return shares, rows.Err()
+}
+
+type createShareRequest struct {
+	Filename     string `json:"filename"`
+	Version      *int64 `json:"version"`    // kosong = selalu versi aktif
+	ExpiresIn    string `json:"expires_in"` // durasi, contoh "72h"; kosong = tanpa batas waktu
+	Password     string `json:"password"`
+	MaxDownloads *int64 `json:"max_downloads"`
+}
+
+// createShare membuat link untuk file milik owner
+func createShare(owner string, req createShareRequest) (*Share, error) {
+	if req.Version != nil && *req.Version < 1 {
+		return nil, fmt.Errorf("%w: version minimal 1", errShareInvalid)
+	}
+	if req.MaxDownloads != nil && *req.MaxDownloads < 1 {
+		return nil, fmt.Errorf("%w: max_downloads minimal 1", errShareInvalid)
+	}
+	var expiresAt *time.Time
+	if req.ExpiresIn != "" {
+		d, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("%w: expires_in %q", errShareInvalid, req.ExpiresIn)
+		}
+		t := time.Now().Add(d)
+		expiresAt = &t
+	}
+
+	var version int64
+	if req.Version != nil {
+		version = *req.Version
+	}
+	if _, err := getUpload(owner, req.Filename, version); err != nil {
+		return nil, err
+	}
+
+	var passwordHash *string
+	if req.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, err
+		}
+		h := string(hash)
+		passwordHash = &h
+	}
+
+	id, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	_, err = DB.Exec("INSERT INTO shares (id, owner, filename, version, password_hash, expires_at, max_downloads, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		id, owner, req.Filename, req.Version, passwordHash, expiresAt, req.MaxDownloads, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return getShare(id)
+}
+
+func revokeShare(owner, id string) error {
+	res, err := DB.Exec("UPDATE shares SET revoked_at = ? WHERE id = ? AND owner = ? AND revoked_at IS NULL", time.Now(), id, owner)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errShareNotFound
+	}
+	return nil
+}
+
+// revokeOrphanShares mencabut link yang filenya (atau versi yang dipatok) sudah dihapus permanen,
+// termasuk link beku yang item tempat sampahnya sudah dikosongkan, supaya link lama tidak ikut
+// menyajikan file lain yang kemudian diupload dengan nama yang sama
+func revokeOrphanShares() {
+	_, err := DB.Exec(`UPDATE shares SET revoked_at = ? WHERE revoked_at IS NULL
+		AND (NOT EXISTS (SELECT 1 FROM uploads u WHERE u.username = shares.owner AND u.filename = shares.filename
+				AND (shares.version IS NULL OR u.version = shares.version))
+			OR (suspended_at IS NOT NULL AND NOT EXISTS (SELECT 1 FROM uploads u WHERE u.username = shares.owner
+				AND u.filename = shares.filename AND u.deleted_at = shares.suspended_at)))`, time.Now())
+	if err != nil {
+		log.Printf("revokeOrphanShares: %v", err)
+	}
+}
+
+// countsAsDownload: request isi penuh, Range yang mulai dari byte 0, Range suffix (bytes=-N) dan
+// multi-range dihitung sebagai unduhan; hanya satu Range lanjutan (resume, seek) yang tidak.
+// Untuk link dengan max_downloads semua GET dihitung (lihat ShareDownloadHandler).
+func countsAsDownload(r *http.Request) bool {
+	spec, ok := strings.CutPrefix(r.Header.Get("Range"), "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return true
+	}
+	start, _, _ := strings.Cut(strings.TrimSpace(spec), "-")
+	n, err := strconv.ParseInt(start, 10, 64)
+	return err != nil || n == 0
+}
+
+// claimShareDownload menghitung satu unduhan; false kalau batas unduhan sudah tercapai
+// (dicek dan ditambah dalam satu UPDATE supaya unduhan paralel tidak melewati batas)
+func claimShareDownload(id string) (bool, error) {
+	res, err := DB.Exec(`UPDATE shares SET download_count = download_count + 1
+		WHERE id = ? AND revoked_at IS NULL AND suspended_at IS NULL AND (max_downloads IS NULL OR download_count < max_downloads)`, id)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n == 1, nil
+}
+
+func recordShareAccess(id string, r *http.Request, result string) {
+	_, err := DB.Exec("INSERT INTO share_access (share_id, accessed_at, remote_addr, user_agent, result) VALUES (?, ?, ?, ?, ?)",
+		id, time.Now(), r.RemoteAddr, r.UserAgent(), result)
+	if err != nil {
+		log.Printf("recordShareAccess: share=%s: %v", id, err)
+	}
+	log.Printf("Share: id=%s dari %s: %s", id, r.RemoteAddr, result)
+}
+
+func listShareAccess(id string) ([]ShareAccess, error) {
+	rows, err := DB.Query("SELECT accessed_at, COALESCE(remote_addr, ''), COALESCE(user_agent, ''), result FROM share_access WHERE share_id = ? ORDER BY id DESC", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []ShareAccess{}
+	for rows.Next() {
+		var a ShareAccess
+		if err := rows.Scan(&a.AccessedAt, &a.RemoteAddr, &a.UserAgent, &a.Result); err != nil {
+			return nil, err
+		}
+		entries = append(entries, a)
+	}
+	return entries, rows.Err()
+}
+
+// -------------------------
+// Kelola link share (milik user yang login)
+// -------------------------
+
+// GET: daftar (filter ?file=), POST: buat link baru, DELETE ?id=: cabut link
+func SharesHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		shares, err := listShares(p.Username, r.URL.Query().Get("file"))
+		if err != nil {
+			http.Error(w, "Gagal ambil daftar share", http.StatusInternalServerError)
+			log.Printf("SharesHandler: list error: %v", err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(shares)
+
+	case http.MethodPost:
+		var req createShareRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Filename == "" {
+			http.Error(w, "filename diperlukan", http.StatusBadRequest)
+			return
+		}
+		sh, err := createShare(p.Username, req)
+		switch {
+		case errors.Is(err, errShareInvalid):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case errors.Is(err, errFileNotFound):
+			http.Error(w, "File tidak ditemukan", http.StatusNotFound)
+			return
+		case err != nil:
+			http.Error(w, "Gagal membuat share", http.StatusInternalServerError)
+			log.Printf("SharesHandler: create error: %v", err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(sh)
+		log.Printf("SharesHandler: user=%s membuat share %s untuk %s", p.Username, sh.ID, sh.Filename)
+
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		if err := revokeShare(p.Username, id); errors.Is(err, errShareNotFound) {
+			http.Error(w, "Share tidak ditemukan atau sudah dicabut", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Gagal mencabut share", http.StatusInternalServerError)
+			log.Printf("SharesHandler: revoke %s error: %v", id, err)
+			return
+		}
+		fmt.Fprintf(w, "Share %s dicabut", id)
+		log.Printf("SharesHandler: user=%s mencabut share %s", p.Username, id)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// GET /shares/access?id=: catatan akses link share milik user
+func ShareAccessHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	p, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+	sh, err := getShare(r.URL.Query().Get("id"))
+	if err != nil || sh.owner != p.Username {
+		http.Error(w, "Share tidak ditemukan", http.StatusNotFound)
+		return
+	}
+	entries, err := listShareAccess(sh.ID)
+	if err != nil {
+		http.Error(w, "Gagal ambil catatan akses", http.StatusInternalServerError)
+		log.Printf("ShareAccessHandler: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// -------------------------
+// Unduh lewat link share (tanpa login)
+// -------------------------
+
+// GET/HEAD /s/<token>; link berpassword diisi lewat form POST "password" atau header X-Share-Password
+func ShareDownloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, ok := parseShareToken(strings.TrimPrefix(r.URL.Path, shareBasePath))
+	if !ok {
+		http.Error(w, "Link tidak ditemukan", http.StatusNotFound)
+		log.Printf("ShareDownloadHandler: token tidak sah dari %s", r.RemoteAddr)
+		return
+	}
+	sh, err := getShare(id)
+	if err != nil {
+		http.Error(w, "Link tidak ditemukan", http.StatusNotFound)
+		if !errors.Is(err, errShareNotFound) {
+			log.Printf("ShareDownloadHandler: DB error: %v", err)
+		}
+		return
+	}
+
+	// Link berbatas: setiap GET (termasuk Range lanjutan) memakai jatah, supaya batas tidak bisa
+	// diakali dengan menyambung potongan Range
+	counted := r.Method != http.MethodHead && (sh.MaxDownloads != nil || countsAsDownload(r))
+	switch {
+	case sh.RevokedAt != nil:
+		recordShareAccess(sh.ID, r, ShareRevoked)
+		http.Error(w, "Link sudah dicabut", http.StatusGone)
+		return
+	case sh.ExpiresAt != nil && time.Now().After(*sh.ExpiresAt):
+		recordShareAccess(sh.ID, r, ShareExpired)
+		http.Error(w, "Link sudah kedaluwarsa", http.StatusGone)
+		return
+	case sh.SuspendedAt != nil:
+		recordShareAccess(sh.ID, r, ShareFileMissing)
+		http.Error(w, "File tidak ditemukan", http.StatusNotFound)
+		return
+	case sh.MaxDownloads != nil && counted && sh.DownloadCount >= *sh.MaxDownloads:
+		recordShareAccess(sh.ID, r, ShareLimit)
+		http.Error(w, "Batas unduhan link sudah tercapai", http.StatusGone)
+		return
+	}
+
+	if sh.HasPassword {
+		password := r.Header.Get("X-Share-Password")
+		if password == "" {
+			password = r.PostFormValue("password")
+		}
+		if password == "" {
+			recordShareAccess(sh.ID, r, ShareNeedsPass)
+			http.Error(w, "Link ini butuh password", http.StatusUnauthorized)
+			return
+		}
+		if bcrypt.CompareHashAndPassword([]byte(sh.passwordHash), []byte(password)) != nil {
+			recordShareAccess(sh.ID, r, ShareBadPassword)
+			http.Error(w, "Password salah", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	var version int64
+	if sh.Version != nil {
+		version = *sh.Version
+	}
+	upload, err := getUpload(sh.owner, sh.Filename, version)
+	if errors.Is(err, errFileNotFound) || (err == nil && upload.Blob == "") {
+		recordShareAccess(sh.ID, r, ShareFileMissing)
+		http.Error(w, "File tidak ditemukan", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Gagal membaca file", http.StatusInternalServerError)
+		log.Printf("ShareDownloadHandler: DB error: %v", err)
+		return
+	}
+	if !checkScanStatus(w, upload) {
+		recordShareAccess(sh.ID, r, ShareBlocked)
+		return
+	}
+
+	// HEAD (dan Range lanjutan di link tanpa batas) tidak dihitung sebagai unduhan
+	if counted {
+		claimed, err := claimShareDownload(sh.ID)
+		if err != nil {
+			http.Error(w, "Gagal membaca file", http.StatusInternalServerError)
+			log.Printf("ShareDownloadHandler: claim %s: %v", sh.ID, err)
+			return
+		}
+		if !claimed {
+			recordShareAccess(sh.ID, r, ShareLimit)
+			http.Error(w, "Batas unduhan link sudah tercapai", http.StatusGone)
+			return
+		}
+	}
+
+	_, name := splitPath(upload.Filename)
+	w.Header().Set("Content-Disposition", "attachment; filename="+strconv.Quote(name))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if serveUpload(w, r, upload) {
+		recordShareAccess(sh.ID, r, ShareServed)
+	}
+}
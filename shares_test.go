@@ -0,0 +1,152 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func int64Ptr(n int64) *int64 { return &n }
+
+// shareRequest menjalankan satu request ke ShareDownloadHandler dan mengembalikan status HTTP-nya
+func shareRequest(t *testing.T, sh *Share, method, rangeHeader, password string) int {
+	t.Helper()
+	r := httptest.NewRequest(method, sh.URL, nil)
+	if rangeHeader != "" {
+		r.Header.Set("Range", rangeHeader)
+	}
+	if password != "" {
+		r.Header.Set("X-Share-Password", password)
+	}
+	w := httptest.NewRecorder()
+	ShareDownloadHandler(w, r)
+	return w.Code
+}
+
+type shareStep struct {
+	method, rangeHeader, password string
+	want                          int
+}
+
+func TestCountsAsDownload(t *testing.T) {
+	tests := []struct {
+		rangeHeader string
+		want        bool
+	}{
+		{"", true},
+		{"bytes=0-", true},
+		{"bytes=0-99", true},
+		{"bytes=-10", true},       // suffix: bisa berisi seluruh file
+		{"bytes=5-9,0-4", true},   // multi-range
+		{"bytes=1-1,1-", true},    // multi-range
+		{"items=0-1", true},       // unit tidak dikenal, isi penuh yang dikirim
+		{"bytes=abc-", true},      // rusak
+		{"bytes=100-", false},     // lanjutan
+		{"bytes= 100-199", false}, // lanjutan
+	}
+	for _, tc := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/s/x", nil)
+		if tc.rangeHeader != "" {
+			r.Header.Set("Range", tc.rangeHeader)
+		}
+		if got := countsAsDownload(r); got != tc.want {
+			t.Errorf("countsAsDownload(%q) = %v, mau %v", tc.rangeHeader, got, tc.want)
+		}
+	}
+}
+
+func TestShareDownload(t *testing.T) {
+	tests := []struct {
+		desc  string
+		req   createShareRequest
+		steps []shareStep
+	}{
+		{"tanpa batas", createShareRequest{}, []shareStep{
+			{http.MethodGet, "", "", http.StatusOK},
+			{http.MethodGet, "bytes=3-", "", http.StatusPartialContent},
+			{http.MethodGet, "", "", http.StatusOK},
+		}},
+		{"batas 1 unduhan", createShareRequest{MaxDownloads: int64Ptr(1)}, []shareStep{
+			{http.MethodHead, "", "", http.StatusOK},
+			{http.MethodGet, "", "", http.StatusOK},
+			{http.MethodGet, "", "", http.StatusGone},
+			{http.MethodHead, "", "", http.StatusOK},
+		}},
+		// Range lanjutan, suffix dan multi-range tidak boleh dipakai untuk melewati batas
+		{"batas tidak bisa diakali dengan Range", createShareRequest{MaxDownloads: int64Ptr(2)}, []shareStep{
+			{http.MethodGet, "", "", http.StatusOK},
+			{http.MethodGet, "bytes=1-", "", http.StatusPartialContent},
+			{http.MethodGet, "bytes=0-0", "", http.StatusGone},
+			{http.MethodGet, "bytes=1-", "", http.StatusGone},
+			{http.MethodGet, "bytes=-10", "", http.StatusGone},
+			{http.MethodGet, "bytes=0-4,5-9", "", http.StatusGone},
+		}},
+		{"Range lanjutan sebelum unduhan penuh ikut dihitung", createShareRequest{MaxDownloads: int64Ptr(1)}, []shareStep{
+			{http.MethodGet, "bytes=5-", "", http.StatusPartialContent},
+			{http.MethodGet, "", "", http.StatusGone},
+		}},
+		{"password", createShareRequest{Password: "kunci-rahasia", MaxDownloads: int64Ptr(1)}, []shareStep{
+			{http.MethodGet, "", "", http.StatusUnauthorized},
+			{http.MethodGet, "", "salah", http.StatusUnauthorized},
+			// Percobaan password gagal tidak memakai jatah unduhan
+			{http.MethodGet, "", "kunci-rahasia", http.StatusOK},
+			{http.MethodGet, "", "kunci-rahasia", http.StatusGone},
+		}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			setupTestEnv(t)
+			uploadTestFile(t, "alice", "laporan.pdf", "0123456789")
+			tc.req.Filename = "laporan.pdf"
+			sh, err := createShare("alice", tc.req)
+			if err != nil {
+				t.Fatalf("createShare: %v", err)
+			}
+			for i, step := range tc.steps {
+				if got := shareRequest(t, sh, step.method, step.rangeHeader, step.password); got != step.want {
+					t.Fatalf("langkah %d (%s Range=%q): status %d, mau %d", i, step.method, step.rangeHeader, got, step.want)
+				}
+			}
+		})
+	}
+}
+
+func TestShareDownloadExpiredAndRevoked(t *testing.T) {
+	setupTestEnv(t)
+	uploadTestFile(t, "alice", "laporan.pdf", "0123456789")
+
+	expired, err := createShare("alice", createShareRequest{Filename: "laporan.pdf", ExpiresIn: "1h"})
+	if err != nil {
+		t.Fatalf("createShare: %v", err)
+	}
+	if got := shareRequest(t, expired, http.MethodGet, "", ""); got != http.StatusOK {
+		t.Fatalf("sebelum kedaluwarsa: status %d", got)
+	}
+	if _, err := DB.Exec("UPDATE shares SET expires_at = ? WHERE id = ?", time.Now().Add(-time.Minute), expired.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := shareRequest(t, expired, http.MethodGet, "", ""); got != http.StatusGone {
+		t.Errorf("link kedaluwarsa: status %d, mau 410", got)
+	}
+
+	revoked, err := createShare("alice", createShareRequest{Filename: "laporan.pdf"})
+	if err != nil {
+		t.Fatalf("createShare: %v", err)
+	}
+	if err := revokeShare("bob", revoked.ID); err != errShareNotFound {
+		t.Errorf("revokeShare oleh bukan pemilik = %v, mau errShareNotFound", err)
+	}
+	if err := revokeShare("alice", revoked.ID); err != nil {
+		t.Fatalf("revokeShare: %v", err)
+	}
+	if got := shareRequest(t, revoked, http.MethodGet, "", ""); got != http.StatusGone {
+		t.Errorf("link dicabut: status %d, mau 410", got)
+	}
+
+	forged := *revoked
+	forged.URL = shareBasePath + revoked.ID + ".tanda-tangan-palsu"
+	if got := shareRequest(t, &forged, http.MethodGet, "", ""); got != http.StatusNotFound {
+		t.Errorf("token palsu: status %d, mau 404", got)
+	}
+}
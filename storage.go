@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+var errObjectNotFound = errors.New("object tidak ditemukan")
+
+type ObjectInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// Storage adalah tempat file final disimpan. Key memakai "/" sebagai pemisah,
+// contoh "alice/foto.jpg"; tiap backend menerjemahkannya sendiri.
+type Storage interface {
+	// Put menyimpan isi r sebagai key. size = -1 jika ukuran belum diketahui.
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	// Get membaca object mulai offset sebanyak length byte (length -1 = sampai akhir).
+	Get(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	Delete(ctx context.Context, key string) error
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+}
+
+var store Storage // diisi dari config (storage_backend)
+
+// fileImporter (opsional) dipenuhi backend yang bisa mengambil alih file lokal
+// tanpa menyalin isinya, contoh LocalStorage lewat rename.
+type fileImporter interface {
+	Import(ctx context.Context, key, path string) error
+}
+
+// objectMover (opsional) dipenuhi backend yang bisa memindah object ke key lain tanpa
+// menyalin isinya; dipakai migrasi ke blob store (lihat migrateUploadsToBlobs).
+type objectMover interface {
+	Move(ctx context.Context, from, to string) error
+}
+
+// objectKey: key file milik user sebelum ada blob store (lihat blobKey), nama file divalidasi dulu
+func objectKey(username, filename string) (string, error) {
+	if _, err := cleanName(username); err != nil {
+		return "", err
+	}
+	if _, err := cleanName(filename); err != nil {
+		return "", err
+	}
+	return username + "/" + filename, nil
+}
+
+func newStorage(c *Config) (Storage, error) {
+	switch c.StorageBackend {
+	case "", "local":
+		return &LocalStorage{Root: c.UploadPath}, nil
+	case "s3":
+		return &S3Storage{
+			Endpoint:  strings.TrimRight(c.S3Endpoint, "/"),
+			Bucket:    c.S3Bucket,
+			Region:    c.S3Region,
+			AccessKey: c.S3AccessKey,
+			SecretKey: c.S3SecretKey,
+		}, nil
+	default:
+		return nil, fmt.Errorf("storage_backend %q tidak dikenal", c.StorageBackend)
+	}
+}
+
+// -------------------------
+// LocalStorage: file biasa di bawah Root
+// -------------------------
+type LocalStorage struct {
+	Root string
+}
+
+// path mengubah key menjadi path di disk; tiap segmen harus lolos cleanName
+func (s *LocalStorage) path(key string) (string, error) {
+	parts := strings.Split(key, "/")
+	for _, p := range parts {
+		if _, err := cleanName(p); err != nil {
+			return "", err
+		}
+	}
+	return filepath.Join(append([]string{s.Root}, parts...)...), nil
+}
+
+func (s *LocalStorage) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+
+	// Tulis ke file sementara di folder yang sama lalu rename, supaya file tujuan
+	// tidak pernah terlihat setengah jadi kalau penulisan gagal di tengah jalan
+	f, err := os.CreateTemp(filepath.Dir(p), "."+filepath.Base(p)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp, p)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// Import memindahkan file lokal ke key dengan rename (atomik, tanpa menyalin data).
+// Kalau beda filesystem, isi file disalin lewat Put lalu file asal dihapus.
+func (s *LocalStorage) Import(ctx context.Context, key, path string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(path, p); err == nil {
+		return os.Chmod(p, 0644)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := s.Put(ctx, key, f, -1); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+func (s *LocalStorage) Move(ctx context.Context, from, to string) error {
+	p, err := s.path(from)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(p); os.IsNotExist(err) {
+		return errObjectNotFound
+	}
+	return s.Import(ctx, to, p)
+}
+
+func (s *LocalStorage) Get(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, errObjectNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	if length < 0 {
+		return f, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(f, length), f}, nil
+}
+
+func (s *LocalStorage) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	fi, err := os.Stat(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ObjectInfo{}, errObjectNotFound
+	}
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{Key: key, Size: fi.Size(), ModTime: fi.ModTime()}, nil
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStorage) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var out []ObjectInfo
+	err := filepath.WalkDir(s.Root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || strings.HasPrefix(d.Name(), ".") {
+			return nil // termasuk file sementara milik Put
+		}
+		rel, err := filepath.Rel(s.Root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		out = append(out, ObjectInfo{Key: key, Size: fi.Size(), ModTime: fi.ModTime()})
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out, nil
+}
+
+// -------------------------
+// objectReadSeeker: adaptor Storage.Get → io.ReadSeeker untuk http.ServeContent,
+// supaya Range request tetap jalan di backend apa pun.
+// -------------------------
+type objectReadSeeker struct {
+	ctx    context.Context
+	st     Storage
+	key    string
+	size   int64
+	offset int64
+	rc     io.ReadCloser
+}
+
+func newObjectReadSeeker(ctx context.Context, st Storage, info ObjectInfo) *objectReadSeeker {
+	return &objectReadSeeker{ctx: ctx, st: st, key: info.Key, size: info.Size}
+}
+
+func (o *objectReadSeeker) Read(p []byte) (int, error) {
+	if o.offset >= o.size {
+		return 0, io.EOF
+	}
+	if o.rc == nil {
+		rc, err := o.st.Get(o.ctx, o.key, o.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		o.rc = rc
+	}
+	n, err := o.rc.Read(p)
+	o.offset += int64(n)
+	return n, err
+}
+
+func (o *objectReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = o.offset + offset
+	case io.SeekEnd:
+		abs = o.size + offset
+	default:
+		return 0, errors.New("whence tidak valid")
+	}
+	if abs < 0 {
+		return 0, errors.New("posisi negatif")
+	}
+	if abs != o.offset && o.rc != nil {
+		o.rc.Close()
+		o.rc = nil
+	}
+	o.offset = abs
+	return abs, nil
+}
+
+func (o *objectReadSeeker) Close() error {
+	if o.rc != nil {
+		return o.rc.Close()
+	}
+	return nil
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 meniru sebagian kecil API S3/MinIO (path-style, satu bucket) dan memeriksa
+// tanda tangan SigV4 setiap request dengan perhitungannya sendiri
+type fakeS3 struct {
+	t         *testing.T
+	bucket    string
+	region    string
+	accessKey string
+	secretKey string
+	pageSize  int // jumlah key per halaman ListObjectsV2
+
+	mu      sync.Mutex
+	objects map[string][]byte
+	modTime time.Time
+	puts    []int64 // Content-Length tiap PUT
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *httptest.Server) {
+	f := &fakeS3{
+		t:         t,
+		bucket:    "mar-test",
+		region:    "us-east-1",
+		accessKey: "AKIAFAKE",
+		secretKey: "rahasia-fake",
+		pageSize:  2,
+		objects:   map[string][]byte{},
+		modTime:   time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+	}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func (f *fakeS3) storage(endpoint string) *S3Storage {
+	return &S3Storage{Endpoint: endpoint, Bucket: f.bucket, Region: f.region, AccessKey: f.accessKey, SecretKey: f.secretKey}
+}
+
+// verifySignature menghitung ulang SigV4 dari request yang diterima server
+func (f *fakeS3) verifySignature(r *http.Request) error {
+	auth := r.Header.Get("Authorization")
+	rest, ok := strings.CutPrefix(auth, "AWS4-HMAC-SHA256 ")
+	if !ok {
+		return fmt.Errorf("Authorization bukan SigV4: %q", auth)
+	}
+	fields := map[string]string{}
+	for _, part := range strings.Split(rest, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		fields[k] = v
+	}
+	cred := strings.Split(fields["Credential"], "/")
+	if len(cred) != 5 || cred[0] != f.accessKey || cred[2] != f.region || cred[3] != "s3" || cred[4] != "aws4_request" {
+		return fmt.Errorf("Credential tidak cocok: %q", fields["Credential"])
+	}
+	amzDate := r.Header.Get("X-Amz-Date")
+	if !strings.HasPrefix(amzDate, cred[1]) {
+		return fmt.Errorf("x-amz-date %q tidak sesuai scope %q", amzDate, cred[1])
+	}
+
+	signed := strings.Split(fields["SignedHeaders"], ";")
+	if !sort.StringsAreSorted(signed) {
+		return fmt.Errorf("SignedHeaders tidak urut: %v", signed)
+	}
+	for _, required := range []string{"host", "x-amz-content-sha256", "x-amz-date"} {
+		if !containsString(signed, required) {
+			return fmt.Errorf("header %s tidak ditandatangani", required)
+		}
+	}
+	if r.Header.Get("Range") != "" && !containsString(signed, "range") {
+		return errors.New("header Range tidak ditandatangani")
+	}
+	var headers strings.Builder
+	for _, h := range signed {
+		v := r.Header.Get(h)
+		if h == "host" {
+			v = r.Host
+		}
+		headers.WriteString(h + ":" + strings.TrimSpace(v) + "\n")
+	}
+
+	// Path dan query diambil mentah dari request line, query diurutkan ulang di sini
+	path, rawQuery, _ := strings.Cut(r.RequestURI, "?")
+	var query []string
+	if rawQuery != "" {
+		query = strings.Split(rawQuery, "&")
+		sort.Strings(query)
+	}
+
+	canonical := strings.Join([]string{
+		r.Method, path, strings.Join(query, "&"), headers.String(),
+		fields["SignedHeaders"], r.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+	sum := sha256.Sum256([]byte(canonical))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + strings.Join(cred[1:], "/") + "\n" + hex.EncodeToString(sum[:])
+
+	key := []byte("AWS4" + f.secretKey)
+	for _, s := range []string{cred[1], f.region, "s3", "aws4_request"} {
+		m := hmac.New(sha256.New, key)
+		m.Write([]byte(s))
+		key = m.Sum(nil)
+	}
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(stringToSign))
+	if want := hex.EncodeToString(m.Sum(nil)); !hmac.Equal([]byte(want), []byte(fields["Signature"])) {
+		return fmt.Errorf("signature salah untuk canonical request:\n%s", canonical)
+	}
+	return nil
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := f.verifySignature(r); err != nil {
+		f.t.Logf("fakeS3: %s %s: %v", r.Method, r.RequestURI, err)
+		http.Error(w, "<Error><Code>SignatureDoesNotMatch</Code></Error>", http.StatusForbidden)
+		return
+	}
+
+	rawPath, _, _ := strings.Cut(r.RequestURI, "?")
+	p, err := url.PathUnescape(strings.TrimPrefix(rawPath, "/"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	bucket, key, _ := strings.Cut(p, "/")
+	if bucket != f.bucket {
+		http.Error(w, "<Error><Code>NoSuchBucket</Code></Error>", http.StatusNotFound)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case key == "" && r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2":
+		f.list(w, r)
+	case r.Method == http.MethodPut:
+		if r.ContentLength < 0 || len(r.TransferEncoding) > 0 {
+			http.Error(w, "<Error><Code>MissingContentLength</Code></Error>", http.StatusLengthRequired)
+			return
+		}
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.objects[key] = data
+		f.puts = append(f.puts, r.ContentLength)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		data, ok := f.objects[key]
+		if !ok {
+			http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+			return
+		}
+		http.ServeContent(w, r, key, f.modTime, bytes.NewReader(data))
+	case r.Method == http.MethodDelete:
+		// MinIO membalas 204 juga untuk key yang tidak ada; 404 dipakai di sini supaya
+		// jalur errObjectNotFound di S3Storage.Delete ikut teruji
+		if _, ok := f.objects[key]; !ok {
+			http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+			return
+		}
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method tidak didukung", http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+	var keys []string
+	for k := range f.objects {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	start := 0
+	if token := r.URL.Query().Get("continuation-token"); token != "" {
+		start, _ = strconv.Atoi(strings.TrimPrefix(token, "page-"))
+	}
+	end := min(start+f.pageSize, len(keys))
+
+	type content struct {
+		Key          string
+		Size         int64
+		LastModified string
+	}
+	result := struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		Contents              []content
+		IsTruncated           bool
+		NextContinuationToken string `xml:",omitempty"`
+	}{IsTruncated: end < len(keys)}
+	for _, k := range keys[start:end] {
+		result.Contents = append(result.Contents, content{k, int64(len(f.objects[k])), f.modTime.Format(time.RFC3339)})
+	}
+	if result.IsTruncated {
+		result.NextContinuationToken = "page-" + strconv.Itoa(end)
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(result)
+}
+
+func TestS3StoragePutGetStat(t *testing.T) {
+	f, srv := newFakeS3(t)
+	s := f.storage(srv.URL)
+	ctx := context.Background()
+
+	key := "blobs/ab/cd/nama file+tanda~(1).bin"
+	data := []byte("0123456789abcdefghij")
+	if err := s.Put(ctx, key, bytes.NewReader(data), int64(len(data))); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	// Ukuran tidak diketahui: isi ditampung dulu supaya Content-Length tetap terkirim
+	if err := s.Put(ctx, "unknown-size", io.MultiReader(strings.NewReader("abc"), strings.NewReader("def")), -1); err != nil {
+		t.Fatalf("Put size<0: %v", err)
+	}
+	if want := []int64{20, 6}; fmt.Sprint(f.puts) != fmt.Sprint(want) {
+		t.Fatalf("Content-Length PUT = %v, mau %v", f.puts, want)
+	}
+	if got := string(f.objects["unknown-size"]); got != "abcdef" {
+		t.Fatalf("isi object size<0 = %q", got)
+	}
+
+	tests := []struct {
+		offset, length int64
+		want           string
+	}{
+		{0, -1, string(data)},
+		{5, 4, "5678"},
+		{15, -1, "fghij"},
+		{0, 0, ""},
+	}
+	for _, tc := range tests {
+		rc, err := s.Get(ctx, key, tc.offset, tc.length)
+		if err != nil {
+			t.Fatalf("Get(%d, %d): %v", tc.offset, tc.length, err)
+		}
+		got, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil || string(got) != tc.want {
+			t.Errorf("Get(%d, %d) = %q, %v; mau %q", tc.offset, tc.length, got, err, tc.want)
+		}
+	}
+
+	info, err := s.Stat(ctx, key)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Size != int64(len(data)) || !info.ModTime.Equal(f.modTime) {
+		t.Errorf("Stat = %+v, mau size %d modtime %v", info, len(data), f.modTime)
+	}
+
+	if _, err := s.Get(ctx, "tidak-ada", 0, -1); !errors.Is(err, errObjectNotFound) {
+		t.Errorf("Get key hilang: %v, mau errObjectNotFound", err)
+	}
+	if _, err := s.Stat(ctx, "tidak-ada"); !errors.Is(err, errObjectNotFound) {
+		t.Errorf("Stat key hilang: %v, mau errObjectNotFound", err)
+	}
+}
+
+func TestS3StorageDelete(t *testing.T) {
+	f, srv := newFakeS3(t)
+	s := f.storage(srv.URL)
+	ctx := context.Background()
+
+	if err := s.Put(ctx, "a", strings.NewReader("x"), 1); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := s.Delete(ctx, "a"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, ok := f.objects["a"]; ok {
+		t.Fatal("object masih ada setelah Delete")
+	}
+	// Menghapus key yang tidak ada bukan error
+	if err := s.Delete(ctx, "a"); err != nil {
+		t.Fatalf("Delete key hilang: %v", err)
+	}
+}
+
+func TestS3StorageListPaginated(t *testing.T) {
+	f, srv := newFakeS3(t)
+	s := f.storage(srv.URL)
+	ctx := context.Background()
+
+	for _, k := range []string{"blobs/aa/1", "blobs/aa/2", "blobs/bb/3", "blobs/cc/4", "blobs/dd/5", "other/6"} {
+		if err := s.Put(ctx, k, strings.NewReader(k), int64(len(k))); err != nil {
+			t.Fatalf("Put %s: %v", k, err)
+		}
+	}
+
+	objs, err := s.List(ctx, "blobs/")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	var keys []string
+	for _, o := range objs {
+		keys = append(keys, o.Key)
+		if o.Size != int64(len(o.Key)) || !o.ModTime.Equal(f.modTime) {
+			t.Errorf("List %s = %+v", o.Key, o)
+		}
+	}
+	if want := "blobs/aa/1 blobs/aa/2 blobs/bb/3 blobs/cc/4 blobs/dd/5"; strings.Join(keys, " ") != want {
+		t.Fatalf("List = %v, mau %s (3 halaman @%d key)", keys, want, f.pageSize)
+	}
+}
+
+func TestS3StorageBadSecret(t *testing.T) {
+	f, srv := newFakeS3(t)
+	s := f.storage(srv.URL)
+	s.SecretKey = "salah"
+
+	err := s.Put(context.Background(), "a", strings.NewReader("x"), 1)
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Fatalf("Put dengan secret salah = %v, mau 403", err)
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 7 * 24 * time.Hour
+)
+
+var errRefreshTokenInvalid = errors.New("refresh token tidak valid")
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// randomToken menghasilkan string acak URL-safe sepanjang n byte entropi
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// -------------------------
+// Penerbitan token
+// -------------------------
+func issueAccessToken(u *User) (string, error) {
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := &Claims{
+		Username: u.Username,
+		Role:     u.Role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(accessTokenTTL)),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(jwtKey)
+}
+
+// storeRefreshToken membuat refresh token baru dalam family tertentu dan menyimpan hash-nya
+func storeRefreshToken(tx *sql.Tx, username, familyID string) (string, string, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	hash := hashRefreshToken(token)
+
+	now := time.Now()
+	_, err = tx.Exec("INSERT INTO refresh_tokens (token_hash, family_id, username, created_at, expires_at) VALUES (?, ?, ?, ?, ?)",
+		hash, familyID, username, now, now.Add(refreshTokenTTL))
+	if err != nil {
+		return "", "", err
+	}
+	return token, hash, nil
+}
+
+// issueTokenPair dipakai saat login: membuka family refresh token baru
+func issueTokenPair(u *User) (*tokenResponse, error) {
+	familyID, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	refreshToken, _, err := storeRefreshToken(tx, u.Username, familyID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	accessToken, err := issueAccessToken(u)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(accessTokenTTL.Seconds()),
+	}, nil
+}
+
+// rotateRefreshToken menukar refresh token lama dengan pasangan token baru.
+// Refresh token yang sudah pernah dirotasi lalu dipakai lagi dianggap bocor,
+// sehingga seluruh family-nya dicabut.
+func rotateRefreshToken(token string) (*tokenResponse, error) {
+	hash := hashRefreshToken(token)
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var familyID, username string
+	var expiresAt time.Time
+	var revokedAt sql.NullTime
+	err = tx.QueryRow("SELECT family_id, username, expires_at, revoked_at FROM refresh_tokens WHERE token_hash = ?", hash).
+		Scan(&familyID, &username, &expiresAt, &revokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errRefreshTokenInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if revokedAt.Valid {
+		if _, err := tx.Exec("UPDATE refresh_tokens SET revoked_at = ? WHERE family_id = ? AND revoked_at IS NULL", time.Now(), familyID); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		log.Printf("rotateRefreshToken: refresh token lama dipakai ulang (user=%s), family dicabut", username)
+		return nil, errRefreshTokenInvalid
+	}
+	if time.Now().After(expiresAt) {
+		return nil, errRefreshTokenInvalid
+	}
+
+	u, err := getUser(username)
+	if err != nil || u.Disabled {
+		return nil, errRefreshTokenInvalid
+	}
+
+	newToken, newHash, err := storeRefreshToken(tx, username, familyID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("UPDATE refresh_tokens SET revoked_at = ?, replaced_by = ? WHERE token_hash = ?", time.Now(), newHash, hash); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	accessToken, err := issueAccessToken(u)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: newToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(accessTokenTTL.Seconds()),
+	}, nil
+}
+
+// revokeRefreshFamily mencabut semua refresh token hasil rotasi dari token yang diberikan
+func revokeRefreshFamily(token, username string) error {
+	res, err := DB.Exec(`
+		UPDATE refresh_tokens SET revoked_at = ?
+		WHERE revoked_at IS NULL AND family_id = (
+			SELECT family_id FROM refresh_tokens WHERE token_hash = ? AND username = ?
+		)`, time.Now(), hashRefreshToken(token), username)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errRefreshTokenInvalid
+	}
+	return nil
+}
+
+func revokeAccessToken(jti string, expiresAt time.Time) error {
+	_, err := DB.Exec("INSERT OR IGNORE INTO revoked_tokens (jti, expires_at) VALUES (?, ?)", jti, expiresAt)
+	return err
+}
+
+func isAccessTokenRevoked(jti string) (bool, error) {
+	var n int
+	err := DB.QueryRow("SELECT COUNT(*) FROM revoked_tokens WHERE jti = ?", jti).Scan(&n)
+	return n > 0, err
+}
+
+// purgeExpiredTokens membuang baris token yang sudah lewat masa berlakunya
+func purgeExpiredTokens() {
+	now := time.Now()
+	if _, err := DB.Exec("DELETE FROM refresh_tokens WHERE expires_at < ?", now); err != nil {
+		log.Printf("purgeExpiredTokens: refresh_tokens: %v", err)
+	}
+	if _, err := DB.Exec("DELETE FROM revoked_tokens WHERE expires_at < ?", now); err != nil {
+		log.Printf("purgeExpiredTokens: revoked_tokens: %v", err)
+	}
+}
+
+// -------------------------
+// Endpoint refresh & logout
+// -------------------------
+func RefreshHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Cuma boleh POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	refreshToken := r.FormValue("refresh_token")
+	if refreshToken == "" {
+		http.Error(w, "refresh_token diperlukan", http.StatusBadRequest)
+		return
+	}
+
+	pair, err := rotateRefreshToken(refreshToken)
+	if errors.Is(err, errRefreshTokenInvalid) {
+		http.Error(w, "Refresh token expired atau tidak sah", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Gagal Membuat Token", http.StatusInternalServerError)
+		log.Printf("RefreshHandler: rotate error: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(pair)
+}
+
+// Dilindungi requireAuth: mencabut access token yang sedang dipakai dan refresh token-nya
+func LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Cuma boleh POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	p, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	if err := revokeAccessToken(p.TokenID, p.ExpiresAt); err != nil {
+		http.Error(w, "Gagal logout", http.StatusInternalServerError)
+		log.Printf("LogoutHandler: gagal cabut jti %s: %v", p.TokenID, err)
+		return
+	}
+
+	if refreshToken := r.FormValue("refresh_token"); refreshToken != "" {
+		if err := revokeRefreshFamily(refreshToken, p.Username); err != nil {
+			log.Printf("LogoutHandler: refresh token user=%s tidak dicabut: %v", p.Username, err)
+		}
+	}
+
+	fmt.Fprint(w, "Logout berhasil")
+	log.Printf("LogoutHandler: user=%s logout", p.Username)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func loginTokens(t *testing.T, username string) *tokenResponse {
+	t.Helper()
+	u, err := getUser(username)
+	if err != nil {
+		t.Fatalf("getUser: %v", err)
+	}
+	pair, err := issueTokenPair(u)
+	if err != nil {
+		t.Fatalf("issueTokenPair: %v", err)
+	}
+	return pair
+}
+
+func mustRotate(t *testing.T, token string) string {
+	t.Helper()
+	pair, err := rotateRefreshToken(token)
+	if err != nil {
+		t.Fatalf("rotateRefreshToken: %v", err)
+	}
+	return pair.RefreshToken
+}
+
+// Refresh token yang sudah dirotasi lalu dipakai lagi mencabut seluruh family-nya,
+// termasuk token terbaru yang dipegang pemilik sah; login lain tidak terpengaruh
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	setupTestEnv(t)
+	if _, err := createUser("alice", "password-alice", RoleUser); err != nil {
+		t.Fatalf("createUser: %v", err)
+	}
+	other := loginTokens(t, "alice").RefreshToken
+
+	first := loginTokens(t, "alice").RefreshToken
+	second := mustRotate(t, first)
+	third := mustRotate(t, second)
+
+	// Pencuri memakai token yang sudah dirotasi
+	if _, err := rotateRefreshToken(first); !errors.Is(err, errRefreshTokenInvalid) {
+		t.Fatalf("pakai ulang token lama = %v, mau errRefreshTokenInvalid", err)
+	}
+	for desc, token := range map[string]string{"token kedua": second, "token terbaru": third} {
+		if _, err := rotateRefreshToken(token); !errors.Is(err, errRefreshTokenInvalid) {
+			t.Errorf("%s setelah family dicabut = %v, mau errRefreshTokenInvalid", desc, err)
+		}
+	}
+	if _, err := rotateRefreshToken(other); err != nil {
+		t.Errorf("family login lain ikut dicabut: %v", err)
+	}
+}
+
+func TestRotateRefreshTokenRejects(t *testing.T) {
+	tests := []struct {
+		desc  string
+		setup func(t *testing.T, token string) string // mengembalikan token yang dipakai
+	}{
+		{"token tidak dikenal", func(t *testing.T, token string) string {
+			return token + "x"
+		}},
+		{"kedaluwarsa", func(t *testing.T, token string) string {
+			if _, err := DB.Exec("UPDATE refresh_tokens SET expires_at = ? WHERE token_hash = ?", time.Now().Add(-time.Minute), hashRefreshToken(token)); err != nil {
+				t.Fatal(err)
+			}
+			return token
+		}},
+		{"user dinonaktifkan", func(t *testing.T, token string) string {
+			if err := setUserDisabled("alice", true); err != nil {
+				t.Fatal(err)
+			}
+			return token
+		}},
+		{"password direset admin", func(t *testing.T, token string) string {
+			if err := setUserPassword("alice", "password-baru"); err != nil {
+				t.Fatal(err)
+			}
+			return token
+		}},
+		{"logout", func(t *testing.T, token string) string {
+			if err := revokeRefreshFamily(token, "alice"); err != nil {
+				t.Fatal(err)
+			}
+			return token
+		}},
+		{"token hasil rotasi setelah logout", func(t *testing.T, token string) string {
+			next := mustRotate(t, token)
+			if err := revokeRefreshFamily(token, "alice"); err != nil {
+				t.Fatal(err)
+			}
+			return next
+		}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			setupTestEnv(t)
+			if _, err := createUser("alice", "password-alice", RoleUser); err != nil {
+				t.Fatalf("createUser: %v", err)
+			}
+			token := tc.setup(t, loginTokens(t, "alice").RefreshToken)
+			if _, err := rotateRefreshToken(token); !errors.Is(err, errRefreshTokenInvalid) {
+				t.Errorf("rotateRefreshToken = %v, mau errRefreshTokenInvalid", err)
+			}
+		})
+	}
+}
+
+func TestRevokeRefreshFamilyChecksOwner(t *testing.T) {
+	setupTestEnv(t)
+	for _, name := range []string{"alice", "bob"} {
+		if _, err := createUser(name, "password-"+name, RoleUser); err != nil {
+			t.Fatalf("createUser: %v", err)
+		}
+	}
+	token := loginTokens(t, "alice").RefreshToken
+	if err := revokeRefreshFamily(token, "bob"); !errors.Is(err, errRefreshTokenInvalid) {
+		t.Fatalf("bob mencabut token alice = %v, mau errRefreshTokenInvalid", err)
+	}
+	if _, err := rotateRefreshToken(token); err != nil {
+		t.Errorf("token alice tercabut oleh bob: %v", err)
+	}
+}
+
+func TestRefreshHandler(t *testing.T) {
+	setupTestEnv(t)
+	if _, err := createUser("alice", "password-alice", RoleUser); err != nil {
+		t.Fatalf("createUser: %v", err)
+	}
+	token := loginTokens(t, "alice").RefreshToken
+	refresh := func(token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/refresh", strings.NewReader(url.Values{"refresh_token": {token}}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		RefreshHandler(w, r)
+		return w
+	}
+
+	if w := refresh(token); w.Code != http.StatusOK || w.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("refresh pertama: status %d, Cache-Control %q", w.Code, w.Header().Get("Cache-Control"))
+	}
+	if w := refresh(token); w.Code != http.StatusUnauthorized {
+		t.Errorf("refresh ulang token lama: status %d, mau 401", w.Code)
+	}
+	if w := refresh(""); w.Code != http.StatusBadRequest {
+		t.Errorf("tanpa refresh_token: status %d, mau 400", w.Code)
+	}
+}
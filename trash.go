@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Menghapus file hanya mengisi uploads.deleted_at untuk semua versinya (satu nilai yang sama
+// per penghapusan). Blob isinya tetap direferensikan, jadi file bisa dipulihkan utuh sampai
+// tempat sampah dikosongkan atau lewat trashRetention; baru saat itu barisnya benar-benar dihapus.
+// Link share dan hak akses file itu dibekukan dengan stempel waktu yang sama (suspended_at),
+// supaya file baru dengan nama yang sama tidak ikut terbagi, dan dicairkan lagi saat dipulihkan.
+
+// Diisi dari config saat startup (lihat applyConfig)
+var trashRetention = 30 * 24 * time.Hour
+
+var errTrashConflict = errors.New("sudah ada file aktif dengan nama yang sama")
+
+// TrashItem: satu file di tempat sampah. ID adalah id baris versi terakhirnya.
+type TrashItem struct {
+	ID        int64     `json:"id"`
+	Filename  string    `json:"filename"`
+	Versions  int       `json:"versions"`
+	Size      int64     `json:"size"`
+	DeletedAt time.Time `json:"deleted_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// sameTrashItem: kondisi SQL untuk semua baris satu item tempat sampah (argumen: id item),
+// dibandingkan langsung dengan nilai deleted_at yang tersimpan
+const sameTrashItem = `username = (SELECT username FROM uploads WHERE id = ?)
+	AND filename = (SELECT filename FROM uploads WHERE id = ?)
+	AND deleted_at = (SELECT deleted_at FROM uploads WHERE id = ?)`
+
+// trashUpload memindah file aktif milik user (semua versinya) ke tempat sampah
+func trashUpload(username, filename string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	res, err := tx.Exec("UPDATE uploads SET deleted_at = ? WHERE username = ? AND filename = ? AND deleted_at IS NULL",
+		now, username, filename)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errFileNotFound
+	}
+	if err := suspendFileAccess(tx, now, username, func(col string) string { return col + " = ?" }, filename); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// suspendFileAccess membekukan link share dan hak akses file milik owner yang kolom namanya
+// memenuhi match (argumen: args) dengan stempel at, yaitu deleted_at baris yang baru dibuang
+func suspendFileAccess(tx *sql.Tx, at time.Time, owner string, match func(col string) string, args ...interface{}) error {
+	_, err := tx.Exec("UPDATE shares SET suspended_at = ? WHERE owner = ? AND revoked_at IS NULL AND suspended_at IS NULL AND "+match("filename"),
+		append([]interface{}{at, owner}, args...)...)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE acl SET suspended_at = ? WHERE owner = ? AND resource_type = ? AND suspended_at IS NULL AND "+match("resource"),
+		append([]interface{}{at, owner, ResourceFile}, args...)...)
+	return err
+}
+
+func listTrash(username string) ([]TrashItem, error) {
+	rows, err := DB.Query(`SELECT MAX(id), filename, COUNT(*), COALESCE(SUM(size), 0), deleted_at
+		FROM uploads WHERE username = ? AND deleted_at IS NOT NULL
+		GROUP BY filename, deleted_at ORDER BY deleted_at DESC`, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []TrashItem{}
+	for rows.Next() {
+		var t TrashItem
+		if err := rows.Scan(&t.ID, &t.Filename, &t.Versions, &t.Size, &t.DeletedAt); err != nil {
+			return nil, err
+		}
+		t.ExpiresAt = t.DeletedAt.Add(trashRetention)
+		items = append(items, t)
+	}
+	return items, rows.Err()
+}
+
+// trashItemOwned memastikan id adalah baris di tempat sampah milik username
+func trashItemOwned(username string, id int64) (string, error) {
+	var filename string
+	err := DB.QueryRow("SELECT filename FROM uploads WHERE id = ? AND username = ? AND deleted_at IS NOT NULL", id, username).Scan(&filename)
+	if err != nil {
+		return "", errFileNotFound
+	}
+	return filename, nil
+}
+
+// restoreTrash mengembalikan item tempat sampah (semua versinya) menjadi file aktif.
+// errTrashConflict kalau sementara itu sudah ada file aktif dengan nama yang sama.
+func restoreTrash(username string, id int64) (string, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var filename string
+	err = tx.QueryRow("SELECT filename FROM uploads WHERE id = ? AND username = ? AND deleted_at IS NOT NULL", id, username).Scan(&filename)
+	if err != nil {
+		return "", errFileNotFound
+	}
+	var live int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM uploads WHERE username = ? AND filename = ? AND deleted_at IS NULL", username, filename).Scan(&live); err != nil {
+		return "", err
+	}
+	if live > 0 {
+		return "", errTrashConflict
+	}
+	// Folder asalnya mungkin sudah dihapus (lihat deleteFolder)
+	if folder, _ := splitPath(filename); folder != "" {
+		if _, err := ensureFolderPath(tx, username, folder); err != nil {
+			return "", err
+		}
+	}
+	// Link dan hak akses yang dibekukan bersama item ini aktif lagi (dicocokkan sebelum deleted_at dikosongkan)
+	_, err = tx.Exec("UPDATE shares SET suspended_at = NULL WHERE owner = ? AND filename = ? AND suspended_at = (SELECT deleted_at FROM uploads WHERE id = ?)",
+		username, filename, id)
+	if err != nil {
+		return "", err
+	}
+	_, err = tx.Exec("UPDATE acl SET suspended_at = NULL WHERE owner = ? AND resource_type = ? AND resource = ? AND suspended_at = (SELECT deleted_at FROM uploads WHERE id = ?)",
+		username, ResourceFile, filename, id)
+	if err != nil {
+		return "", err
+	}
+	if _, err := tx.Exec("UPDATE uploads SET deleted_at = NULL WHERE "+sameTrashItem, id, id, id); err != nil {
+		return "", err
+	}
+	return filename, tx.Commit()
+}
+
+// purgeTrash menghapus permanen isi tempat sampah yang lebih tua dari maxAge
+// (dipanggil dari startTrashCleaner)
+func purgeTrash(maxAge time.Duration) {
+	n, err := releaseUploads(context.Background(), "deleted_at IS NOT NULL AND deleted_at < ?", time.Now().Add(-maxAge))
+	if err != nil {
+		log.Printf("purgeTrash: %v", err)
+	}
+	if n > 0 {
+		log.Printf("Cleaner: menghapus permanen %d versi file dari tempat sampah", n)
+	}
+}
+
+// -------------------------
+// Tempat sampah (milik user yang login)
+// -------------------------
+
+// GET: daftar isi, DELETE: kosongkan, DELETE ?id=: hapus permanen satu item
+func TrashHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		items, err := listTrash(p.Username)
+		if err != nil {
+			http.Error(w, "Gagal ambil isi tempat sampah", http.StatusInternalServerError)
+			log.Printf("TrashHandler: list error: %v", err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(items)
+
+	case http.MethodDelete:
+		where, args := "username = ? AND deleted_at IS NOT NULL", []interface{}{p.Username}
+		if idParam := r.URL.Query().Get("id"); idParam != "" {
+			id, err := strconv.ParseInt(idParam, 10, 64)
+			if err != nil {
+				http.Error(w, "id tidak valid", http.StatusBadRequest)
+				return
+			}
+			if _, err := trashItemOwned(p.Username, id); err != nil {
+				http.Error(w, "Item tidak ditemukan di tempat sampah", http.StatusNotFound)
+				return
+			}
+			where, args = sameTrashItem, []interface{}{id, id, id}
+		}
+
+		n, err := releaseUploads(r.Context(), where, args...)
+		if err != nil {
+			http.Error(w, "Gagal mengosongkan tempat sampah", http.StatusInternalServerError)
+			log.Printf("TrashHandler: user=%s: %v", p.Username, err)
+			return
+		}
+		fmt.Fprintf(w, "%d versi file dihapus permanen", n)
+		log.Printf("TrashHandler: user=%s menghapus permanen %d versi", p.Username, n)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// POST /trash/restore?id=: kembalikan item ke daftar file
+func RestoreTrashHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	p, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "id tidak valid", http.StatusBadRequest)
+		return
+	}
+
+	filename, err := restoreTrash(p.Username, id)
+	switch {
+	case errors.Is(err, errFileNotFound):
+		http.Error(w, "Item tidak ditemukan di tempat sampah", http.StatusNotFound)
+		return
+	case errors.Is(err, errTrashConflict):
+		http.Error(w, "Sudah ada file dengan nama yang sama, hapus atau ganti namanya dulu", http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "Gagal memulihkan file", http.StatusInternalServerError)
+		log.Printf("RestoreTrashHandler: id=%d user=%s: %v", id, p.Username, err)
+		return
+	}
+	fmt.Fprintf(w, "File %s dipulihkan", filename)
+	log.Printf("RestoreTrashHandler: user=%s memulihkan %s (id=%d)", p.Username, filename, id)
+}
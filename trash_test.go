@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// shareBody mengunduh link share tanpa Range dan mengembalikan status serta isinya
+func shareBody(t *testing.T, sh *Share) (int, string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	ShareDownloadHandler(w, httptest.NewRequest(http.MethodGet, sh.URL, nil))
+	return w.Code, w.Body.String()
+}
+
+func bobPermission(t *testing.T, filename string) string {
+	t.Helper()
+	perm, err := filePermission("bob", "alice", filename)
+	if err != nil {
+		t.Fatalf("filePermission: %v", err)
+	}
+	return perm
+}
+
+// Link share dan hak akses file yang dibuang tidak boleh berlaku untuk file baru dengan nama yang sama
+func TestTrashSuspendsSharesAndGrants(t *testing.T) {
+	setupTestEnv(t)
+	if _, err := createUser("bob", "password-bob", RoleUser); err != nil {
+		t.Fatalf("createUser: %v", err)
+	}
+	uploadTestFile(t, "alice", "laporan.pdf", "isi lama")
+	sh, err := createShare("alice", createShareRequest{Filename: "laporan.pdf"})
+	if err != nil {
+		t.Fatalf("createShare: %v", err)
+	}
+	pinned, err := createShare("alice", createShareRequest{Filename: "laporan.pdf", Version: int64Ptr(1)})
+	if err != nil {
+		t.Fatalf("createShare: %v", err)
+	}
+	if _, err := grantAccess("alice", ResourceFile, "laporan.pdf", GranteeUser, "bob", PermRead); err != nil {
+		t.Fatalf("grantAccess: %v", err)
+	}
+
+	if err := trashUpload("alice", "laporan.pdf"); err != nil {
+		t.Fatalf("trashUpload: %v", err)
+	}
+	oldItem, err := listTrash("alice")
+	if err != nil || len(oldItem) != 1 {
+		t.Fatalf("listTrash = %v, %v", oldItem, err)
+	}
+
+	// File baru dengan nama sama (versinya mulai lagi dari 1)
+	if v := uploadTestFile(t, "alice", "laporan.pdf", "isi baru"); v != 1 {
+		t.Fatalf("versi file baru = %d, mau 1", v)
+	}
+	for _, s := range []*Share{sh, pinned} {
+		if code, body := shareBody(t, s); code != http.StatusNotFound {
+			t.Errorf("share %s setelah file dibuang: status %d (%q), mau 404", s.ID, code, body)
+		}
+	}
+	if perm := bobPermission(t, "laporan.pdf"); perm != "" {
+		t.Errorf("hak bob atas file baru = %q, mau tidak ada", perm)
+	}
+
+	// Setelah file baru dibuang, item lama bisa dipulihkan beserta link dan hak aksesnya
+	if err := trashUpload("alice", "laporan.pdf"); err != nil {
+		t.Fatalf("trashUpload: %v", err)
+	}
+	if _, err := restoreTrash("alice", oldItem[0].ID); err != nil {
+		t.Fatalf("restoreTrash: %v", err)
+	}
+	for _, s := range []*Share{sh, pinned} {
+		if code, body := shareBody(t, s); code != http.StatusOK || body != "isi lama" {
+			t.Errorf("share %s setelah dipulihkan: status %d (%q), mau 200 isi lama", s.ID, code, body)
+		}
+	}
+	if perm := bobPermission(t, "laporan.pdf"); perm != PermRead {
+		t.Errorf("hak bob setelah dipulihkan = %q, mau read", perm)
+	}
+
+	// Item tempat sampah (isi baru) dikosongkan: link dan hak akses yang aktif tidak tersentuh
+	if _, err := releaseUploads(context.Background(), "username = ? AND deleted_at IS NOT NULL", "alice"); err != nil {
+		t.Fatalf("releaseUploads: %v", err)
+	}
+	if code, _ := shareBody(t, sh); code != http.StatusOK {
+		t.Errorf("share setelah tempat sampah dikosongkan: status %d, mau 200", code)
+	}
+
+	// Dibuang lalu dihapus permanen: link dicabut dan hak akses hilang meski nama dipakai lagi
+	if err := trashUpload("alice", "laporan.pdf"); err != nil {
+		t.Fatalf("trashUpload: %v", err)
+	}
+	uploadTestFile(t, "alice", "laporan.pdf", "isi ketiga")
+	if _, err := releaseUploads(context.Background(), "username = ? AND deleted_at IS NOT NULL", "alice"); err != nil {
+		t.Fatalf("releaseUploads: %v", err)
+	}
+	if got, err := getShare(sh.ID); err != nil || got.RevokedAt == nil {
+		t.Errorf("share setelah purge = %+v, %v; mau dicabut", got, err)
+	}
+	grants, err := listGrants("alice", ResourceFile, "laporan.pdf")
+	if err != nil || len(grants) != 0 {
+		t.Errorf("grant setelah purge = %+v, %v; mau kosong", grants, err)
+	}
+}
@@ -0,0 +1,433 @@
+package main
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// -------------------------
+// Endpoint tus 1.0 (https://tus.io/protocols/resumable-upload)
+//
+//	OPTIONS /files/       → info server
+//	POST    /files/       → buat upload (extension creation)
+//	HEAD    /files/<id>   → offset saat ini
+//	PATCH   /files/<id>   → tambah data mulai Upload-Offset
+//	DELETE  /files/<id>   → batalkan upload (extension termination)
+//
+// Data ditulis ke file data sesi (chunkTempDir/<id>/data) dan dicatat di upload_sessions,
+// jadi cleaner dan tabel uploads diperlakukan sama persis dengan /upload-chunk + /merge.
+// -------------------------
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,termination,checksum,expiration"
+	tusBasePath   = "/files/"
+)
+
+// Status 460 dari spesifikasi tus (extension checksum)
+const statusChecksumMismatch = 460
+
+// TusHandler: OPTIONS boleh tanpa login (discovery), method lain wajib token
+func TusHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Tus-Version", tusVersion)
+		w.Header().Set("Tus-Extension", tusExtensions)
+		w.Header().Set("Tus-Checksum-Algorithm", "sha1,sha256")
+		if maxUploadSize > 0 {
+			w.Header().Set("Tus-Max-Size", strconv.FormatInt(maxUploadSize, 10))
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	requireAuth(tusServe)(w, r)
+}
+
+func tusServe(w http.ResponseWriter, r *http.Request) {
+	p, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		http.Error(w, "Tus-Resumable tidak didukung", http.StatusPreconditionFailed)
+		return
+	}
+
+	// Sebagian client di belakang proxy hanya bisa mengirim POST
+	method := r.Method
+	if m := r.Header.Get("X-HTTP-Method-Override"); m != "" && method == http.MethodPost {
+		method = strings.ToUpper(m)
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, tusBasePath)
+	if id == "" {
+		if method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		tusCreate(w, r, p)
+		return
+	}
+
+	chunkDir, err := safeJoin(chunkTempDir, id)
+	if err != nil {
+		http.Error(w, "Upload tidak ditemukan", http.StatusNotFound)
+		return
+	}
+
+	switch method {
+	case http.MethodHead:
+		tusHead(w, id, p)
+	case http.MethodPatch:
+		tusPatch(w, r, id, chunkDir, p)
+	case http.MethodDelete:
+		tusTerminate(w, id, chunkDir, p)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// parseTusMetadata: "key base64,key2 base64" → map (nilai kosong boleh tanpa base64)
+func parseTusMetadata(header string) (map[string]string, error) {
+	meta := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return meta, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		parts := strings.Fields(pair)
+		if len(parts) == 0 || len(parts) > 2 {
+			return nil, errors.New("Upload-Metadata tidak valid")
+		}
+		value := ""
+		if len(parts) == 2 {
+			b, err := base64.StdEncoding.DecodeString(parts[1])
+			if err != nil {
+				return nil, errors.New("Upload-Metadata tidak valid")
+			}
+			value = string(b)
+		}
+		meta[parts[0]] = value
+	}
+	return meta, nil
+}
+
+func tusCreate(w http.ResponseWriter, r *http.Request, p *Principal) {
+	if r.Header.Get("Upload-Defer-Length") != "" {
+		http.Error(w, "Upload-Defer-Length tidak didukung", http.StatusBadRequest)
+		return
+	}
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		http.Error(w, "Upload-Length tidak valid", http.StatusBadRequest)
+		return
+	}
+
+	meta, err := parseTusMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// tus-js-client/Uppy biasanya mengirim "filename", sebagian client lain "name"
+	rawName := meta["filename"]
+	if rawName == "" {
+		rawName = meta["name"]
+	}
+
+	// Metadata "folder" (opsional) adalah path folder tujuan.
+	// Seluruh upload dicatat sebagai satu chunk seukuran Upload-Length; PATCH mengisinya berurutan
+	sess, err := newUploadSession(p, meta["folder"], rawName, length, length)
+	if err != nil {
+		writeSessionError(w, err)
+		log.Printf("tusCreate: ditolak user=%s filename=%q: %v", p.Username, rawName, err)
+		return
+	}
+	chunkDir := filepath.Join(chunkTempDir, sess.ID)
+
+	w.Header().Set("Location", tusBasePath+sess.ID)
+	w.Header().Set("Upload-Expires", sess.expiresAt().UTC().Format(http.TimeFormat))
+
+	// File kosong langsung selesai tanpa PATCH
+	if length == 0 {
+		if err := tusFinish(r, sess, chunkDir); err != nil {
+			tusFinishError(w, err)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	log.Printf("tusCreate: user=%s id=%s filename=%s length=%d", p.Username, sess.ID, sess.Filename, length)
+}
+
+func tusHead(w http.ResponseWriter, id string, p *Principal) {
+	sess, err := getOwnedSession(id, p.Username)
+	if err != nil {
+		writeSessionError(w, err)
+		return
+	}
+	if sess.expired() {
+		http.Error(w, "Upload sudah kedaluwarsa", http.StatusGone)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(sess.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(sess.TotalSize, 10))
+	w.Header().Set("Upload-Metadata", "filename "+base64.StdEncoding.EncodeToString([]byte(sess.Filename)))
+	if sess.Status != SessionCompleted {
+		w.Header().Set("Upload-Expires", sess.expiresAt().UTC().Format(http.TimeFormat))
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// parseUploadChecksum: "sha1 <base64>" → hash baru + digest yang diharapkan
+func parseUploadChecksum(header string) (hash.Hash, []byte, error) {
+	if header == "" {
+		return nil, nil, nil
+	}
+	alg, value, ok := strings.Cut(header, " ")
+	if !ok {
+		return nil, nil, errors.New("Upload-Checksum tidak valid")
+	}
+	sum, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil {
+		return nil, nil, errors.New("Upload-Checksum tidak valid")
+	}
+	switch alg {
+	case "sha1":
+		return sha1.New(), sum, nil
+	case "sha256":
+		return sha256.New(), sum, nil
+	default:
+		return nil, nil, errors.New("algoritma checksum tidak didukung")
+	}
+}
+
+func tusPatch(w http.ResponseWriter, r *http.Request, id, chunkDir string, p *Principal) {
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		http.Error(w, "Content-Type harus application/offset+octet-stream", http.StatusUnsupportedMediaType)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, "Upload-Offset tidak valid", http.StatusBadRequest)
+		return
+	}
+	hasher, expectedSum, err := parseUploadChecksum(r.Header.Get("Upload-Checksum"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := getOwnedSession(id, p.Username); err != nil {
+		writeSessionError(w, err)
+		return
+	}
+
+	lock := sessionLock(id)
+	if !lock.TryLock() {
+		http.Error(w, "Upload sedang ditulis request lain", http.StatusLocked)
+		return
+	}
+	defer lock.Unlock()
+
+	// Baca ulang setelah lock supaya offset yang dipakai adalah yang terbaru
+	sess, err := getOwnedSession(id, p.Username)
+	if err != nil {
+		writeSessionError(w, err)
+		return
+	}
+	if sess.expired() {
+		http.Error(w, "Upload sudah kedaluwarsa", http.StatusGone)
+		return
+	}
+	if sess.Status != SessionActive {
+		writeSessionError(w, errSessionNotActive)
+		return
+	}
+	if offset != sess.Offset {
+		http.Error(w, "Upload-Offset tidak cocok", http.StatusConflict)
+		return
+	}
+	if err := checkQuota(p.Username, sess.TotalSize, sess.ID); err != nil {
+		writeSessionError(w, err)
+		log.Printf("tusPatch: kuota user=%s id=%s: %v", p.Username, id, err)
+		return
+	}
+
+	// File data sudah dialokasikan sebesar Upload-Length; byte setelah offset tercatat
+	// (sisa PATCH yang gagal) cukup ditimpa, tidak perlu dipotong
+	dataPath := filepath.Join(chunkDir, sessionDataFile)
+	f, err := os.OpenFile(dataPath, os.O_WRONLY, 0644)
+	if err != nil {
+		http.Error(w, "Gagal membuka data upload", http.StatusInternalServerError)
+		log.Printf("tusPatch: open %s: %v", dataPath, err)
+		return
+	}
+
+	var dst io.Writer = io.NewOffsetWriter(f, offset)
+	if hasher != nil {
+		dst = io.MultiWriter(dst, hasher)
+	}
+	body := http.MaxBytesReader(w, r.Body, sess.TotalSize-offset)
+	n, copyErr := io.Copy(dst, body)
+	if err := f.Close(); copyErr == nil {
+		copyErr = err
+	}
+
+	switch {
+	case copyErr != nil && isBodyTooLarge(copyErr):
+		http.Error(w, "Data melebihi Upload-Length", http.StatusRequestEntityTooLarge)
+		return
+	case hasher != nil && (copyErr != nil || subtle.ConstantTimeCompare(hasher.Sum(nil), expectedSum) != 1):
+		// Dengan checksum, potongan yang tidak utuh/tidak cocok tidak dihitung (offset tetap)
+		if copyErr != nil {
+			http.Error(w, "Gagal menerima data", http.StatusBadRequest)
+			log.Printf("tusPatch: id=%s copy error: %v", id, copyErr)
+			return
+		}
+		http.Error(w, "Checksum Mismatch", statusChecksumMismatch)
+		log.Printf("tusPatch: id=%s checksum mismatch di offset %d", id, offset)
+		return
+	}
+
+	// Tanpa checksum, data yang sempat diterima tetap disimpan (client bisa lanjut dari offset baru)
+	newOffset := offset + n
+	if err := setUploadOffset(id, newOffset); err != nil {
+		http.Error(w, "Gagal mencatat offset", http.StatusInternalServerError)
+		log.Printf("tusPatch: set offset %s: %v", id, err)
+		return
+	}
+	if copyErr != nil {
+		log.Printf("tusPatch: id=%s koneksi putus di offset %d: %v", id, newOffset, copyErr)
+		return
+	}
+
+	if newOffset == sess.TotalSize {
+		sess.Offset = newOffset
+		if err := tusFinish(r, sess, chunkDir); err != nil {
+			tusFinishError(w, err)
+			return
+		}
+		sessionLocks.Delete(id)
+	} else {
+		w.Header().Set("Upload-Expires", sess.expiresAt().UTC().Format(http.TimeFormat))
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(newOffset, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// tusFinish memindahkan data yang sudah lengkap ke storage, sama seperti /merge
+func tusFinish(r *http.Request, sess *UploadSession, chunkDir string) error {
+	if err := setChunkReceived(sess.ID, 0, true); err != nil {
+		return err
+	}
+	if err := setSessionStatus(sess.ID, SessionActive, SessionMerging); err != nil {
+		return err
+	}
+
+	// Cukup pastikan file data masih utuh; offset sudah sama dengan Upload-Length
+	var version int64
+	dataPath := filepath.Join(chunkDir, sessionDataFile)
+	_, err := checkChunks(chunkDir, sess)
+	if err == nil {
+		err = checkQuota(sess.Owner, sess.TotalSize, sess.ID)
+	}
+	if err == nil {
+		err = checkSessionType(r, sess, dataPath)
+	}
+	if err == nil {
+		version, _, err = storeUploadFile(r.Context(), sess.Owner, sess.Filename, dataPath, "", FileMeta{OriginalName: sess.OriginalName})
+	}
+	if errors.Is(err, errTypeNotAllowed) {
+		quarantineSession(sess, chunkDir, err)
+		return err
+	}
+	if err != nil {
+		if err := setSessionStatus(sess.ID, SessionMerging, SessionActive); err != nil {
+			log.Printf("tusFinish: gagal kembalikan status sesi %s: %v", sess.ID, err)
+		}
+		return err
+	}
+
+	if err := setSessionStatus(sess.ID, SessionMerging, SessionCompleted); err != nil {
+		log.Printf("tusFinish: gagal tandai sesi %s selesai: %v", sess.ID, err)
+	}
+	if err := os.RemoveAll(chunkDir); err != nil {
+		log.Printf("tusFinish: warning: gagal hapus chunkDir %s: %v", chunkDir, err)
+	}
+	log.Printf("tusFinish: id=%s -> %s v%d (user=%s)", sess.ID, sess.Filename, version, sess.Owner)
+	return nil
+}
+
+func tusFinishError(w http.ResponseWriter, err error) {
+	log.Printf("tusFinish: %v", err)
+	if errors.Is(err, errSessionNotActive) || errors.Is(err, errQuotaExceeded) || errors.Is(err, errFileExceedsQuota) ||
+		errors.Is(err, errTypeNotAllowed) || errors.Is(err, errTypeForbidden) || errors.Is(err, errExtensionNotAllowed) {
+		writeSessionError(w, err)
+		return
+	}
+	http.Error(w, "Gagal menyimpan file", http.StatusInternalServerError)
+}
+
+func tusTerminate(w http.ResponseWriter, id, chunkDir string, p *Principal) {
+	if _, err := getOwnedSession(id, p.Username); err != nil {
+		writeSessionError(w, err)
+		return
+	}
+
+	lock := sessionLock(id)
+	if !lock.TryLock() {
+		http.Error(w, "Upload sedang ditulis request lain", http.StatusLocked)
+		return
+	}
+	defer lock.Unlock()
+
+	// Baca ulang setelah lock; upload yang sedang dipindah ke storage tidak bisa dibatalkan
+	sess, err := getOwnedSession(id, p.Username)
+	if err != nil {
+		writeSessionError(w, err)
+		return
+	}
+	if sess.Status == SessionMerging {
+		writeSessionError(w, errSessionNotActive)
+		return
+	}
+	if err := deleteUploadSession(id); err != nil {
+		http.Error(w, "Gagal membatalkan upload", http.StatusInternalServerError)
+		log.Printf("tusTerminate: hapus sesi %s: %v", id, err)
+		return
+	}
+	if err := os.RemoveAll(chunkDir); err != nil {
+		log.Printf("tusTerminate: warning: gagal hapus chunkDir %s: %v", chunkDir, err)
+	}
+	sessionLocks.Delete(id)
+
+	w.WriteHeader(http.StatusNoContent)
+	log.Printf("tusTerminate: user=%s id=%s", p.Username, id)
+}
+
+// checkSessionType menjalankan kebijakan tipe file pada data tus yang sudah lengkap
+func checkSessionType(r *http.Request, sess *UploadSession, dataPath string) error {
+	var roles []string
+	if p, ok := PrincipalFrom(r.Context()); ok {
+		roles = p.Roles
+	}
+	ftype, err := filePolicy.Check(roles, sess.Filename, sess.TotalSize)
+	if err != nil {
+		return err
+	}
+	return filePolicy.CheckContentFile(ftype, dataPath)
+}
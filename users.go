@@ -0,0 +1,383 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
+
+const minPasswordLength = 8
+
+var allowRegistration = true // dari config allow_registration
+
+var (
+	errUserExists      = errors.New("username sudah dipakai")
+	errUserNotFound    = errors.New("user tidak ditemukan")
+	errInvalidUsername = errors.New("username harus 3-32 karakter: huruf, angka, titik, strip atau underscore")
+	errWeakPassword    = fmt.Errorf("password minimal %d karakter", minPasswordLength)
+	errInvalidRole     = errors.New("role tidak dikenal")
+	errRegistrationOff = errors.New("registrasi ditutup, hubungi admin")
+)
+
+// Username juga dipakai sebagai nama folder, jadi dibatasi ke karakter aman
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{2,31}$`)
+
+// Dipakai saat username tidak ada, supaya login tetap menjalankan bcrypt
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+
+type User struct {
+	ID           int64     `json:"id"`
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"-"`
+	Role         string    `json:"role"`
+	Disabled     bool      `json:"disabled"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// -------------------------
+// Akses tabel users
+// -------------------------
+func validateCredentials(username, password string) error {
+	if !usernamePattern.MatchString(username) {
+		return errInvalidUsername
+	}
+	if len(password) < minPasswordLength {
+		return errWeakPassword
+	}
+	return nil
+}
+
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func createUser(username, password, role string) (*User, error) {
+	if err := validateCredentials(username, password); err != nil {
+		return nil, err
+	}
+	if role != RoleAdmin && role != RoleUser {
+		return nil, errInvalidRole
+	}
+
+	hash, err := hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	res, err := DB.Exec("INSERT INTO users (username, password_hash, role, disabled, created_at) VALUES (?, ?, ?, 0, ?)", username, hash, role, now)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return nil, errUserExists
+		}
+		return nil, err
+	}
+	id, _ := res.LastInsertId()
+
+	return &User{ID: id, Username: username, PasswordHash: hash, Role: role, CreatedAt: now}, nil
+}
+
+// registerUser mendaftarkan user lewat /register. User pertama jadi admin; role ditentukan di
+// dalam INSERT yang sama, jadi dua registrasi paralel di server baru tidak bisa sama-sama jadi admin.
+// Kalau registrasi ditutup, hanya user pertama yang boleh mendaftar.
+func registerUser(username, password string) (*User, error) {
+	if err := validateCredentials(username, password); err != nil {
+		return nil, err
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	u := &User{Username: username, PasswordHash: hash, CreatedAt: time.Now()}
+	err = DB.QueryRow(`INSERT INTO users (username, password_hash, role, disabled, created_at)
+		SELECT ?, ?, CASE WHEN EXISTS (SELECT 1 FROM users) THEN ? ELSE ? END, 0, ?
+		WHERE ? OR NOT EXISTS (SELECT 1 FROM users)
+		RETURNING id, role`, username, hash, RoleUser, RoleAdmin, u.CreatedAt, allowRegistration).Scan(&u.ID, &u.Role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errRegistrationOff
+	}
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return nil, errUserExists
+		}
+		return nil, err
+	}
+	return u, nil
+}
+
+// bootstrapAdmin membuat akun admin dari config (admin_username/admin_password) kalau belum ada
+// user sama sekali, supaya admin tidak bergantung pada siapa yang lebih dulu memanggil /register
+func bootstrapAdmin(username, password string) error {
+	n, err := countUsers()
+	if err != nil || n > 0 {
+		return err
+	}
+	if _, err := createUser(username, password, RoleAdmin); err != nil && !errors.Is(err, errUserExists) {
+		return err
+	}
+	log.Printf("bootstrapAdmin: admin %s dibuat dari config", username)
+	return nil
+}
+
+func getUser(username string) (*User, error) {
+	var u User
+	err := DB.QueryRow("SELECT id, username, password_hash, role, disabled, created_at FROM users WHERE username = ?", username).
+		Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Role, &u.Disabled, &u.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func listUsers() ([]User, error) {
+	rows, err := DB.Query("SELECT id, username, role, disabled, created_at FROM users ORDER BY username")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.Username, &u.Role, &u.Disabled, &u.CreatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+func countUsers() (int, error) {
+	var n int
+	err := DB.QueryRow("SELECT COUNT(*) FROM users").Scan(&n)
+	return n, err
+}
+
+func setUserDisabled(username string, disabled bool) error {
+	res, err := DB.Exec("UPDATE users SET disabled = ? WHERE username = ?", disabled, username)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errUserNotFound
+	}
+	return nil
+}
+
+func setUserPassword(username, password string) error {
+	if len(password) < minPasswordLength {
+		return errWeakPassword
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	// Semua refresh token user dicabut bersamaan, supaya sesi yang dicuri ikut terputus
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec("UPDATE users SET password_hash = ? WHERE username = ?", hash, username)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errUserNotFound
+	}
+	if _, err := tx.Exec("UPDATE refresh_tokens SET revoked_at = ? WHERE username = ? AND revoked_at IS NULL", time.Now(), username); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// authenticateUser mengembalikan user jika username/password cocok (status disabled dicek pemanggil)
+func authenticateUser(username, password string) (*User, error) {
+	u, err := getUser(username)
+	if err != nil {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return nil, err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// -------------------------
+// Registrasi (publik)
+// -------------------------
+func RegisterHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Cuma boleh POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	username := r.FormValue("username")
+	password := r.FormValue("password")
+
+	// User pertama otomatis jadi admin supaya server baru bisa dikelola (lihat registerUser)
+	u, err := registerUser(username, password)
+	if err != nil {
+		writeUserError(w, err)
+		log.Printf("RegisterHandler: gagal daftar %q: %v", username, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	fmt.Fprintf(w, "Registrasi berhasil: %s", u.Username)
+	log.Printf("RegisterHandler: user=%s terdaftar (role=%s)", u.Username, u.Role)
+}
+
+// -------------------------
+// Manajemen user (khusus admin)
+// -------------------------
+
+// requireAdmin: token valid + role admin (role dibaca requireAuth dari database, bukan dari klaim token)
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return requireAuth(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := currentPrincipal(w, r)
+		if !ok {
+			return
+		}
+		if !p.HasRole(RoleAdmin) {
+			http.Error(w, "Khusus admin", http.StatusForbidden)
+			log.Printf("requireAdmin: user=%s ditolak", p.Username)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// GET: daftar user, POST: buat user baru
+func AdminUsersHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		users, err := listUsers()
+		if err != nil {
+			http.Error(w, "Gagal ambil data user", http.StatusInternalServerError)
+			log.Printf("AdminUsersHandler: list error: %v", err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(users)
+
+	case http.MethodPost:
+		var req struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+			Role     string `json:"role"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+		if req.Role == "" {
+			req.Role = RoleUser
+		}
+
+		u, err := createUser(req.Username, req.Password, req.Role)
+		if err != nil {
+			writeUserError(w, err)
+			log.Printf("AdminUsersHandler: gagal buat user %q: %v", req.Username, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(u)
+		log.Printf("AdminUsersHandler: user=%s dibuat (role=%s)", u.Username, u.Role)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// POST {"username": "...", "disabled": true|false}
+func AdminDisableUserHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Username string `json:"username"`
+		Disabled bool   `json:"disabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Username == "" {
+		http.Error(w, "username diperlukan", http.StatusBadRequest)
+		return
+	}
+
+	if err := setUserDisabled(req.Username, req.Disabled); err != nil {
+		writeUserError(w, err)
+		log.Printf("AdminDisableUserHandler: gagal update %q: %v", req.Username, err)
+		return
+	}
+
+	fmt.Fprintf(w, "User %s disabled=%t", req.Username, req.Disabled)
+	log.Printf("AdminDisableUserHandler: user=%s disabled=%t", req.Username, req.Disabled)
+}
+
+// POST {"username": "...", "password": "..."}
+func AdminResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Username == "" {
+		http.Error(w, "username diperlukan", http.StatusBadRequest)
+		return
+	}
+
+	if err := setUserPassword(req.Username, req.Password); err != nil {
+		writeUserError(w, err)
+		log.Printf("AdminResetPasswordHandler: gagal reset %q: %v", req.Username, err)
+		return
+	}
+
+	fmt.Fprintf(w, "Password %s berhasil direset", req.Username)
+	log.Printf("AdminResetPasswordHandler: password user=%s direset", req.Username)
+}
+
+func writeUserError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errUserExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, errRegistrationOff):
+		http.Error(w, "Registrasi ditutup, hubungi admin", http.StatusForbidden)
+	case errors.Is(err, errUserNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, errInvalidUsername), errors.Is(err, errWeakPassword), errors.Is(err, errInvalidRole):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, "Gagal memproses user", http.StatusInternalServerError)
+	}
+}
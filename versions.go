@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Upload dengan nama yang sudah ada menjadi versi baru dari file yang sama: tiap baris uploads
+// adalah satu versi (kolom version, mulai dari 1) dan versi terbesar adalah versi aktif.
+// Versi lama tetap bisa diunduh dan dipulihkan sampai dihapus retensi (max_versions, version_max_age).
+
+// Diisi dari config saat startup (lihat applyConfig); 0 = tanpa batas
+var (
+	maxVersions   int64
+	versionMaxAge time.Duration
+)
+
+type VersionInfo struct {
+	Version    int64     `json:"version"`
+	Size       int64     `json:"size"`
+	SHA256     string    `json:"sha256"`
+	Status     string    `json:"status"` // pending/clean/infected
+	UploadedAt time.Time `json:"uploaded_at"`
+	Current    bool      `json:"current"`
+
+	id int64
+}
+
+// listVersions: semua versi filename milik username, terbaru dulu
+func listVersions(username, filename string) ([]VersionInfo, error) {
+	rows, err := DB.Query(`SELECT id, version, COALESCE(size, 0), COALESCE(blob_sha256, ''), status, uploaded_at
+		FROM uploads WHERE username = ? AND filename = ? AND deleted_at IS NULL ORDER BY version DESC`, username, filename)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []VersionInfo{}
+	for rows.Next() {
+		var v VersionInfo
+		if err := rows.Scan(&v.id, &v.Version, &v.Size, &v.SHA256, &v.Status, &v.UploadedAt); err != nil {
+			return nil, err
+		}
+		v.Current = len(versions) == 0
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// recordVersion menjalankan addVersion dalam transaksi sendiri
+func recordVersion(username, filename, sum string, size int64, meta FileMeta) (int64, bool, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return 0, false, err
+	}
+	defer tx.Rollback()
+
+	version, created, err := addVersion(tx, username, filename, sum, size, meta)
+	if err != nil || !created {
+		return version, false, err
+	}
+	return version, true, tx.Commit()
+}
+
+// addVersion mencatat blob sum sebagai versi baru filename milik username. Kalau versi aktif
+// sudah berisi blob yang sama, tidak ada versi baru (created false, nomor versi aktif dikembalikan).
+// Tags dan deskripsi diwarisi dari versi aktif sebelumnya.
+func addVersion(tx *sql.Tx, username, filename, sum string, size int64, meta FileMeta) (version int64, created bool, err error) {
+	var current, tags, description string
+	err = tx.QueryRow("SELECT COALESCE(blob_sha256, ''), version, COALESCE(tags, ''), COALESCE(description, '') FROM uploads WHERE username = ? AND filename = ? AND deleted_at IS NULL ORDER BY version DESC LIMIT 1",
+		username, filename).Scan(&current, &version, &tags, &description)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, false, err
+	}
+	if current == sum {
+		return version, false, nil
+	}
+	version++
+
+	if meta.CheckQuota {
+		if err := checkQuotaIn(tx, username, size, ""); err != nil {
+			return 0, false, err
+		}
+	}
+
+	// Folder tujuan bisa saja dihapus selagi upload berjalan; buat ulang supaya file tetap terlihat
+	if folder, _ := splitPath(filename); folder != "" {
+		if _, err := ensureFolderPath(tx, username, folder); err != nil {
+			return 0, false, err
+		}
+	}
+
+	// Hasil pemindaian isi yang sama dipakai ulang, tidak perlu dipindai lagi
+	status := initialScanStatus()
+	var result sql.NullString
+	var scannedAt sql.NullTime
+	err = tx.QueryRow("SELECT status, scan_result, scanned_at FROM uploads WHERE blob_sha256 = ? AND status != ? LIMIT 1", sum, ScanPending).Scan(&status, &result, &scannedAt)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, false, err
+	}
+
+	_, err = tx.Exec(`INSERT INTO uploads (filename, username, uploaded_at, sha256, blob_sha256, size, status, scan_result, scanned_at, version,
+		mime_type, original_name, storage_key, tags, description) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		filename, username, time.Now(), sum, sum, size, status, result, scannedAt, version,
+		meta.MIMEType, meta.OriginalName, blobKey(sum), tags, description)
+	if err != nil {
+		return 0, false, err
+	}
+	if err := addBlobRef(tx, sum, size); err != nil {
+		return 0, false, err
+	}
+	return version, true, nil
+}
+
+// restoreVersion menjadikan isi versi lama sebagai versi aktif yang baru (riwayat tidak diubah)
+func restoreVersion(ctx context.Context, username, filename string, version int64) (int64, error) {
+	old, err := getUpload(username, filename, version)
+	if err != nil {
+		return 0, err
+	}
+	if old.Blob == "" {
+		return 0, errFileNotFound
+	}
+
+	newVersion, created, err := func() (int64, bool, error) {
+		unlock := lockBlob(old.Blob)
+		defer unlock()
+		// Versi lama bisa saja baru dihapus; jangan menunjuk ke blob yang sudah hilang
+		if ok, err := blobExists(old.Blob); err != nil || !ok {
+			return 0, false, errors.Join(err, errFileNotFound)
+		}
+		return recordVersion(username, filename, old.Blob, old.Size, FileMeta{MIMEType: old.MIMEType, OriginalName: old.OriginalName})
+	}()
+	if err != nil {
+		return 0, err
+	}
+	if created {
+		if _, err := pruneVersions(ctx, username, filename, maxVersions, versionMaxAge); err != nil {
+			log.Printf("restoreVersion: gagal hapus versi lama %s milik %s: %v", filename, username, err)
+		}
+	}
+	return newVersion, nil
+}
+
+// pruneVersions menghapus versi lama di luar keep versi terbaru atau yang lebih tua dari maxAge
+// (0 = tanpa batas). Versi aktif tidak pernah dihapus. Mengembalikan jumlah versi yang dihapus.
+func pruneVersions(ctx context.Context, username, filename string, keep int64, maxAge time.Duration) (int, error) {
+	if keep == 0 && maxAge == 0 {
+		return 0, nil
+	}
+	versions, err := listVersions(username, filename)
+	if err != nil {
+		return 0, err
+	}
+
+	cutoff := time.Now().Add(-maxAge)
+	removed := 0
+	for i, v := range versions {
+		if v.Current {
+			continue
+		}
+		if (keep > 0 && int64(i) >= keep) || (maxAge > 0 && v.UploadedAt.Before(cutoff)) {
+			if err := releaseUpload(ctx, v.id, v.SHA256); err != nil {
+				return removed, err
+			}
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// pruneAllVersions menerapkan retensi ke semua file (dipanggil dari startVersionCleaner),
+// termasuk setelah max_versions / version_max_age diperketat
+func pruneAllVersions() {
+	if maxVersions == 0 && versionMaxAge == 0 {
+		return
+	}
+	rows, err := DB.Query("SELECT username, filename FROM uploads WHERE deleted_at IS NULL GROUP BY username, filename HAVING COUNT(*) > 1")
+	if err != nil {
+		log.Printf("pruneAllVersions: query: %v", err)
+		return
+	}
+	type file struct{ username, filename string }
+	var files []file
+	for rows.Next() {
+		var f file
+		if err := rows.Scan(&f.username, &f.filename); err == nil {
+			files = append(files, f)
+		}
+	}
+	rows.Close()
+
+	for _, f := range files {
+		n, err := pruneVersions(context.Background(), f.username, f.filename, maxVersions, versionMaxAge)
+		if err != nil {
+			log.Printf("pruneAllVersions: %s milik %s: %v", f.filename, f.username, err)
+			continue
+		}
+		if n > 0 {
+			log.Printf("Cleaner: menghapus %d versi lama %s milik %s", n, f.filename, f.username)
+		}
+	}
+}
+
+// parseVersionParam membaca ?version=; 0 kalau tidak diisi (versi aktif)
+func parseVersionParam(r *http.Request) (int64, error) {
+	raw := r.URL.Query().Get("version")
+	if raw == "" {
+		return 0, nil
+	}
+	v, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || v < 1 {
+		return 0, fmt.Errorf("version %q tidak valid", raw)
+	}
+	return v, nil
+}
+
+// -------------------------
+// Versi file (milik user yang login)
+// -------------------------
+
+// GET /versions?file=: daftar versi, terbaru dulu
+func VersionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	p, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+	filename, err := cleanFilePath(r.URL.Query().Get("file"))
+	if err != nil {
+		http.Error(w, "Parameter file kosong atau tidak valid", http.StatusBadRequest)
+		return
+	}
+
+	versions, err := listVersions(p.Username, filename)
+	if err != nil {
+		http.Error(w, "Gagal ambil daftar versi", http.StatusInternalServerError)
+		log.Printf("VersionsHandler: DB error: %v", err)
+		return
+	}
+	if len(versions) == 0 {
+		http.Error(w, "File tidak ditemukan", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(versions)
+}
+
+// POST /versions/restore?file=&version=: isi versi itu menjadi versi aktif yang baru
+func RestoreVersionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	p, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+	filename, err := cleanFilePath(r.URL.Query().Get("file"))
+	if err != nil {
+		http.Error(w, "Nama file tidak valid", http.StatusBadRequest)
+		return
+	}
+	version, err := parseVersionParam(r)
+	if version == 0 || err != nil {
+		http.Error(w, "Parameter file dan version wajib diisi", http.StatusBadRequest)
+		return
+	}
+
+	old, err := getUpload(p.Username, filename, version)
+	if errors.Is(err, errFileNotFound) {
+		http.Error(w, "Versi tidak ditemukan", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Gagal ambil versi", http.StatusInternalServerError)
+		log.Printf("RestoreVersionHandler: DB error: %v", err)
+		return
+	}
+	// Versi baru dihitung penuh di kuota walaupun isinya sama dengan versi lama
+	if err := checkQuota(p.Username, old.Size, ""); err != nil {
+		if !writeQuotaError(w, err) {
+			http.Error(w, "Gagal cek kuota", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	newVersion, err := restoreVersion(r.Context(), p.Username, filename, version)
+	if errors.Is(err, errFileNotFound) {
+		http.Error(w, "Versi tidak ditemukan", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Gagal memulihkan versi", http.StatusInternalServerError)
+		log.Printf("RestoreVersionHandler: %s v%d milik %s: %v", filename, version, p.Username, err)
+		return
+	}
+	fmt.Fprintf(w, "Versi %d dari %s dipulihkan sebagai versi %d", version, filename, newVersion)
+	log.Printf("RestoreVersionHandler: user=%s %s v%d -> v%d", p.Username, filename, version, newVersion)
+}
+
+// POST /versions/prune?file=[&keep=N]: hapus versi lama sesuai retensi; keep menggantikan max_versions
+func PruneVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	p, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+	filename, err := cleanFilePath(r.URL.Query().Get("file"))
+	if err != nil {
+		http.Error(w, "Parameter file kosong atau tidak valid", http.StatusBadRequest)
+		return
+	}
+	keep := maxVersions
+	if raw := r.URL.Query().Get("keep"); raw != "" {
+		v, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || v < 1 {
+			http.Error(w, "keep minimal 1", http.StatusBadRequest)
+			return
+		}
+		keep = v
+	}
+
+	removed, err := pruneVersions(r.Context(), p.Username, filename, keep, versionMaxAge)
+	if err != nil {
+		http.Error(w, "Gagal menghapus versi lama", http.StatusInternalServerError)
+		log.Printf("PruneVersionsHandler: %s milik %s: %v", filename, p.Username, err)
+		return
+	}
+	fmt.Fprintf(w, "%d versi lama %s dihapus", removed, filename)
+	log.Printf("PruneVersionsHandler: user=%s %s: %d versi dihapus (keep=%d)", p.Username, filename, removed, keep)
+}
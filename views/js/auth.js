@@ -0,0 +1,66 @@
+// Helper token: access token pendek + refresh token yang dirotasi server
+function getToken() {
+  return localStorage.getItem("token");
+}
+
+function saveTokens(data) {
+  localStorage.setItem("token", data.access_token);
+  localStorage.setItem("refreshToken", data.refresh_token);
+}
+
+function clearTokens() {
+  localStorage.removeItem("token");
+  localStorage.removeItem("refreshToken");
+}
+
+// Satu refresh untuk semua request paralel (refresh token hanya bisa dipakai sekali)
+let refreshPromise = null;
+
+function refreshAccessToken() {
+  if (refreshPromise) return refreshPromise;
+
+  const refreshToken = localStorage.getItem("refreshToken");
+  if (!refreshToken) return Promise.resolve(false);
+
+  const body = new FormData();
+  body.append("refresh_token", refreshToken);
+
+  refreshPromise = fetch("/refresh", { method: "POST", body })
+    .then(async (res) => {
+      if (!res.ok) {
+        clearTokens();
+        return false;
+      }
+      saveTokens(await res.json());
+      return true;
+    })
+    .catch(() => false)
+    .finally(() => { refreshPromise = null; });
+
+  return refreshPromise;
+}
+
+// fetch dengan header Authorization; kalau 401, refresh token lalu ulangi sekali
+async function authFetch(url, options = {}) {
+  const withAuth = () => ({
+    ...options,
+    headers: { ...(options.headers || {}), "Authorization": "Bearer " + getToken() },
+  });
+
+  let res = await fetch(url, withAuth());
+  if (res.status === 401 && await refreshAccessToken()) {
+    res = await fetch(url, withAuth());
+  }
+  return res;
+}
+
+async function logout() {
+  const body = new FormData();
+  body.append("refresh_token", localStorage.getItem("refreshToken") || "");
+  try {
+    await authFetch("/logout", { method: "POST", body });
+  } finally {
+    clearTokens();
+    window.location.href = "/login.html";
+  }
+}
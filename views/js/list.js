@@ -12,18 +12,49 @@ document.addEventListener("DOMContentLoaded", () => {
     const prevBtn = document.getElementById("prevBtn");
     const nextBtn = document.getElementById("nextBtn");
     const pageInfo = document.getElementById("pageInfo");
+    const usageInfo = document.getElementById("usageInfo");
 
     let page = 1;
     let totalPages = 1;
 
+    function formatBytes(n) {
+        const units = ["B", "KB", "MB", "GB", "TB"];
+        let i = 0;
+        while (n >= 1024 && i < units.length - 1) {
+            n /= 1024;
+            i++;
+        }
+        return `${i ? n.toFixed(1) : n} ${units[i]}`;
+    }
+
+    // Pemakaian penyimpanan dari /me/usage (quota null = tanpa batas)
+    async function loadUsage() {
+        const res = await authFetch(`/me/usage?_=${Date.now()}`, { cache: "no-store" });
+        if (!res.ok) {
+            usageInfo.textContent = "";
+            return;
+        }
+        const u = await res.json();
+        let text = `Terpakai: ${formatBytes(u.used)} (${u.files} file)`;
+        if (u.trash > 0) {
+            text += `, di tempat sampah: ${formatBytes(u.trash)}`;
+        }
+        if (u.reserved > 0) {
+            text += `, sedang diupload: ${formatBytes(u.reserved)}`;
+        }
+        text += u.quota === null
+            ? " - kuota tanpa batas"
+            : ` dari ${formatBytes(u.quota)}, sisa ${formatBytes(u.available)}`;
+        usageInfo.textContent = text;
+    }
+
     async function loadFiles() {
         fileList.innerHTML = "<p>Memuat daftar file...</p>";
 
         const date = dateFilter.value;
         const limit = limitSelect.value;
 
-        const res = await fetch(`/list-json?page=${page}&limit=${limit}&date=${date}&_=${Date.now()}`, {
-            headers: { "Authorization": "Bearer " + token },
+        const res = await authFetch(`/list-json?page=${page}&limit=${limit}&date=${date}&_=${Date.now()}`, {
             cache: "no-store"
         });
 
@@ -42,13 +73,21 @@ document.addEventListener("DOMContentLoaded", () => {
         }
 
         fileList.innerHTML = "";
+        // File baru bisa diunduh setelah lolos pemindaian malware
+        const statusLabel = {
+            pending: " (sedang dipindai)",
+            infected: " (terdeteksi malware)"
+        };
+
         files.forEach(file => {
             const div = document.createElement("div");
             div.className = "file-item";
+            const blocked = file.status && file.status !== "clean";
+            const version = file.version > 1 ? ` (versi ${file.version})` : "";
             div.innerHTML = `
-                <span>${file.filename} - ${file.uploaded_at || ''}</span>
+                <span>${file.filename}${version} - ${file.uploaded_at || ''}${statusLabel[file.status] || ''}</span>
                 <div>
-                    <button class="downloadBtn" data-file="${file.filename}">Download</button>
+                    <button class="downloadBtn" data-file="${file.filename}" ${blocked ? "disabled" : ""}>Download</button>
                     <button class="deleteBtn" data-file="${file.filename}">Hapus</button>
                 </div>
             `;
@@ -63,12 +102,10 @@ document.addEventListener("DOMContentLoaded", () => {
                 const filename = e.target.getAttribute("data-file");
 
                 try {
-                    const res = await fetch(`/download?file=${encodeURIComponent(filename)}&_=${Date.now()}`, {
-                        headers: { "Authorization": "Bearer " + token }
-                    });
+                    const res = await authFetch(`/download?file=${encodeURIComponent(filename)}&_=${Date.now()}`);
 
                     if (!res.ok) {
-                        alert("Gagal mengunduh file");
+                        alert(res.status === 409 || res.status === 403 ? await res.text() : "Gagal mengunduh file");
                         return;
                     }
 
@@ -77,7 +114,7 @@ document.addEventListener("DOMContentLoaded", () => {
 
                     const a = document.createElement("a");
                     a.href = url;
-                    a.download = filename;
+                    a.download = filename.split("/").pop();
                     document.body.appendChild(a);
                     a.click();
                     a.remove();
@@ -94,17 +131,17 @@ document.addEventListener("DOMContentLoaded", () => {
         document.querySelectorAll(".deleteBtn").forEach(btn => {
             btn.addEventListener("click", async (e) => {
                 const filename = e.target.getAttribute("data-file");
-                if (!confirm(`Yakin mau hapus file ${filename}?`)) return;
+                if (!confirm(`Pindahkan file ${filename} ke tempat sampah?`)) return;
 
-                const delRes = await fetch(`/delete?file=${encodeURIComponent(filename)}&_=${Date.now()}`, {
+                const delRes = await authFetch(`/delete?file=${encodeURIComponent(filename)}&_=${Date.now()}`, {
                     method: "DELETE",
-                    headers: { "Authorization": "Bearer " + token },
                     cache: "no-store"
                 });
 
                 if (delRes.ok) {
-                    alert("File berhasil dihapus.");
+                    alert("File dipindah ke tempat sampah.");
                     loadFiles();
+                    loadUsage();
                 } else {
                     alert("Gagal menghapus file.");
                 }
@@ -112,6 +149,8 @@ document.addEventListener("DOMContentLoaded", () => {
         });
     }
 
+    document.getElementById("logoutBtn").addEventListener("click", logout);
+
     // Event listeners filter & pagination
     dateFilter.addEventListener("change", () => { page = 1; loadFiles(); });
     limitSelect.addEventListener("change", () => { page = 1; loadFiles(); });
@@ -132,4 +171,5 @@ document.addEventListener("DOMContentLoaded", () => {
 
     // Load awal
     loadFiles();
+    loadUsage();
 });
@@ -6,12 +6,26 @@ const form = document.getElementById('loginForm');
         method: 'POST',
         body: formData
       });
-      const token = await response.text();
       if (response.ok) {
-        localStorage.setItem('token', token);
+        saveTokens(await response.json());
         alert('Login berhasil!');
         window.location.href = '/upload.html';
       } else {
         alert('Login gagal!');
       }
-});
\ No newline at end of file
+});
+
+document.getElementById('registerBtn').addEventListener('click', async () => {
+      if (!form.reportValidity()) return;
+      const formData = new FormData(form);
+      const response = await fetch('/register', {
+        method: 'POST',
+        body: formData
+      });
+      const msg = await response.text();
+      if (response.ok) {
+        alert('Registrasi berhasil, silakan login.');
+      } else {
+        alert('Registrasi gagal: ' + msg);
+      }
+});
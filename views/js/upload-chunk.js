@@ -1,5 +1,6 @@
 document.addEventListener("DOMContentLoaded", () => {
-  const CHUNK_SIZE = 2 * 1024 * 1024;
+  let chunkSize = 0;   // ditentukan server lewat POST /uploads
+  let totalChunks = 0;
   let currentChunk = 0;
   let isPaused = false;
   let fileToUpload = null;
@@ -45,11 +46,30 @@ document.addEventListener("DOMContentLoaded", () => {
     uploadNextFile();
   }
 
-  function uploadNextFile() {
+  async function uploadNextFile() {
     if (filesQueue.length === 0) return;
 
     fileToUpload = filesQueue.shift();
-    uploadId = `${fileToUpload.name}-${Date.now()}`;
+
+    // Minta server membuat sesi: upload_id & ukuran chunk berasal dari server
+    const res = await fetch("/uploads", {
+      method: "POST",
+      headers: {
+        "Authorization": "Bearer " + localStorage.getItem("token"),
+        "Content-Type": "application/json",
+      },
+      body: JSON.stringify({ filename: fileToUpload.name, size: fileToUpload.size, mime_type: fileToUpload.type }),
+    });
+    if (!res.ok) {
+      alert(`File ${fileToUpload.name} ditolak: ${await res.text()}`);
+      uploadNextFile();
+      return;
+    }
+    const session = await res.json();
+
+    uploadId = session.upload_id;
+    chunkSize = session.chunk_size;
+    totalChunks = session.total_chunks;
     currentChunk = 0;
     uploadedChunks.clear();
 
@@ -60,13 +80,14 @@ document.addEventListener("DOMContentLoaded", () => {
     const token = localStorage.getItem("token");
     if (!token) return alert("Belum login!");
 
-    const totalChunks = Math.ceil(fileToUpload.size / CHUNK_SIZE);
     progressBarFile.max = totalChunks;
     progressBarFile.value = 0;
 
     // Ambil daftar chunk yang sudah terupload
     try {
-      const resumeRes = await fetch(`/resume?upload_id=${uploadId}`);
+      const resumeRes = await fetch(`/resume?upload_id=${uploadId}`, {
+        headers: { "Authorization": "Bearer " + token },
+      });
       const uploadedList = await resumeRes.json();
       uploadedChunks = new Set(uploadedList.map(c => c.toString()));
     } catch (err) {
@@ -83,16 +104,14 @@ document.addEventListener("DOMContentLoaded", () => {
         continue;
       }
 
-      const start = currentChunk * CHUNK_SIZE;
-      const end = Math.min(fileToUpload.size, start + CHUNK_SIZE);
+      const start = currentChunk * chunkSize;
+      const end = Math.min(fileToUpload.size, start + chunkSize);
       const chunk = fileToUpload.slice(start, end);
 
       const formData = new FormData();
       formData.append("chunk", chunk);
       formData.append("chunk_index", currentChunk);
-      formData.append("total_chunks", totalChunks);
       formData.append("upload_id", uploadId);
-      formData.append("filename", fileToUpload.name);
 
       try {
         const res = await fetch("/upload-chunk", {
@@ -122,10 +141,7 @@ document.addEventListener("DOMContentLoaded", () => {
           "Authorization": "Bearer " + token,
           "Content-Type": "application/json",
         },
-        body: JSON.stringify({
-          uploadId,
-          filename: fileToUpload.name,
-        }),
+        body: JSON.stringify({ uploadId }),
       });
 
       const msg = await res.text();
@@ -80,7 +80,7 @@ document.addEventListener("DOMContentLoaded", () => {
 
     for (let i = 0; i < filesToUpload.length; i++) {
       let { file, renamed } = filesToUpload[i];
-      await uploadFile(file, renamed, token, (progress) => {
+      await uploadFile(file, renamed, (progress) => {
         totalUploaded += (file.size * progress) / 100;
         totalProgressBar.value = Math.floor((totalUploaded / totalSize) * 100);
         document.querySelectorAll(".file-progress")[i].value = progress;
@@ -91,7 +91,7 @@ document.addEventListener("DOMContentLoaded", () => {
     location.reload();
   });
 
-  function uploadFile(file, newName, token, onProgress) {
+  function uploadFile(file, newName, onProgress, retried = false) {
     return new Promise((resolve, reject) => {
       let xhr = new XMLHttpRequest();
       let formData = new FormData();
@@ -106,8 +106,15 @@ document.addEventListener("DOMContentLoaded", () => {
       });
 
       xhr.open("POST", "/upload");
-      xhr.setRequestHeader("Authorization", "Bearer " + token);
-      xhr.onload = () => resolve();
+      xhr.setRequestHeader("Authorization", "Bearer " + getToken());
+      xhr.onload = async () => {
+        // Access token expired di tengah antrean: refresh lalu ulangi file ini sekali
+        if (xhr.status === 401 && !retried && await refreshAccessToken()) {
+          uploadFile(file, newName, onProgress, true).then(resolve, reject);
+          return;
+        }
+        resolve();
+      };
       xhr.onerror = () => reject();
       xhr.send(formData);
     });
@@ -116,8 +123,16 @@ document.addEventListener("DOMContentLoaded", () => {
   // ==========================================================
   // BAGIAN 2: UPLOAD CHUNKED (FILE JUMBO)
   // ==========================================================
-  const CHUNK_SIZE = 2 * 1024 * 1024;
-  let currentChunk = 0;
+
+  // crypto.subtle hanya ada di HTTPS/localhost; tanpa itu checksum dilewati
+  async function sha256Hex(blob) {
+    if (!window.crypto || !crypto.subtle) return null;
+    const digest = await crypto.subtle.digest("SHA-256", await blob.arrayBuffer());
+    return Array.from(new Uint8Array(digest)).map(b => b.toString(16).padStart(2, "0")).join("");
+  }
+  let chunkSize = 0;   // ditentukan server saat sesi dibuat (POST /uploads)
+  let totalChunks = 0;
+  const PARALLEL_CHUNKS = 4;
   let isPaused = false;
   let fileToUpload = null;
   let uploadId = null;
@@ -153,108 +168,129 @@ document.addEventListener("DOMContentLoaded", () => {
     }
   });
 
-  function uploadNextFile() {
+  async function uploadNextFile() {
     if (filesQueue.length === 0) return;
     fileToUpload = filesQueue.shift();
 
-    // ✅ Filter sesuai backend Go
-    const allowedExt = [".jpg", ".png", ".pdf", ".mp4", ".iso", ".deb"];
-    const ext = fileToUpload.name.substring(fileToUpload.name.lastIndexOf(".")).toLowerCase();
-    if (!allowedExt.includes(ext)) {
-      alert(`File ${fileToUpload.name} memiliki ekstensi tidak diizinkan.`);
-      uploadNextFile();
-      return;
-    }
-
-    const allowedMime = [
-      "image/jpeg",
-      "image/png",
-      "application/pdf",
-      "video/mp4",
-      "application/x-iso9660-image",
-      "application/vnd.debian.binary-package",
-      "application/x-debian-package"
-    ];
-    if (!allowedMime.includes(fileToUpload.type)) {
-      alert(`File ${fileToUpload.name} memiliki tipe tidak diizinkan (${fileToUpload.type}).`);
-      uploadNextFile();
+    // Server memvalidasi nama, ekstensi, tipe & ukuran sebelum ada byte yang dikirim,
+    // lalu memberi upload_id dan ukuran chunk yang harus dipakai
+    let session;
+    try {
+      const res = await authFetch("/uploads", {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify({
+          filename: fileToUpload.name,
+          size: fileToUpload.size,
+          mime_type: fileToUpload.type,
+        }),
+      });
+      if (!res.ok) {
+        alert(`File ${fileToUpload.name} ditolak: ${(await res.text()).trim()}`);
+        uploadNextFile();
+        return;
+      }
+      session = await res.json();
+    } catch (err) {
+      alert(`Gagal memulai upload ${fileToUpload.name}`);
       return;
     }
 
-    uploadId = `${fileToUpload.name}-${Date.now()}`;
-    currentChunk = 0;
+    uploadId = session.upload_id;
+    chunkSize = session.chunk_size;
+    totalChunks = session.total_chunks;
     uploadedChunks.clear();
     uploadChunks();
   }
 
+  async function uploadOneChunk(index) {
+    const start = index * chunkSize;
+    const end = Math.min(fileToUpload.size, start + chunkSize);
+    const chunk = fileToUpload.slice(start, end);
+
+    const formData = new FormData();
+    formData.append("chunk", chunk);
+    formData.append("chunk_index", index);
+    formData.append("upload_id", uploadId);
+
+    const chunkSum = await sha256Hex(chunk);
+    if (chunkSum) formData.append("chunk_sha256", chunkSum);
+
+    try {
+      let res;
+      // 422 = checksum tidak cocok di server, kirim ulang chunk yang sama
+      for (let attempt = 0; attempt < 3; attempt++) {
+        res = await authFetch("/upload-chunk", {
+          method: "POST",
+          body: formData,
+        });
+        if (res.status !== 422) break;
+        console.warn(`Checksum chunk ${index} tidak cocok, kirim ulang (${attempt + 1})`);
+      }
+
+      if (!res.ok) {
+        alert(`Gagal upload chunk ${index}: ${res.status}`);
+        return false;
+      }
+    } catch (err) {
+      console.error(`Chunk ${index} gagal diupload:`, err);
+      return false;
+    }
+    return true;
+  }
+
   async function uploadChunks() {
     const token = localStorage.getItem("token");
     if (!token) return alert("Belum login!");
 
-    const totalChunks = Math.ceil(fileToUpload.size / CHUNK_SIZE);
     chunkProgressBar.max = totalChunks;
     chunkProgressBar.value = 0;
 
     try {
-      const resumeRes = await fetch(`/resume?upload_id=${uploadId}`, {
-        headers: { "Authorization": "Bearer " + token }
-      });
+      const resumeRes = await authFetch(`/resume?upload_id=${uploadId}`);
       const uploadedList = await resumeRes.json();
       uploadedChunks = new Set(uploadedList.map(c => c.toString()));
     } catch {
       console.warn("Gagal ambil status resume, lanjut dari awal.");
     }
 
-    while (currentChunk < totalChunks) {
-      if (isPaused) return;
-
-      if (uploadedChunks.has(currentChunk.toString())) {
-        currentChunk++;
-        chunkProgressBar.value = currentChunk;
-        continue;
-      }
-
-      const start = currentChunk * CHUNK_SIZE;
-      const end = Math.min(fileToUpload.size, start + CHUNK_SIZE);
-      const chunk = fileToUpload.slice(start, end);
-
-      const formData = new FormData();
-      formData.append("chunk", chunk);
-      formData.append("chunk_index", currentChunk);
-      formData.append("total_chunks", totalChunks);
-      formData.append("upload_id", uploadId);
-      formData.append("filename", fileToUpload.name);
-
-      try {
-        const res = await fetch("/upload-chunk", {
-          method: "POST",
-          headers: { "Authorization": "Bearer " + token },
-          body: formData,
-        });
-
-        if (!res.ok) {
-          alert(`Gagal upload chunk ${currentChunk}: ${res.status}`);
+    // Server menulis tiap chunk langsung di offset-nya, jadi beberapa chunk
+    // boleh dikirim bersamaan dan selesai dalam urutan apa pun
+    const pending = [];
+    for (let i = 0; i < totalChunks; i++) {
+      if (!uploadedChunks.has(i.toString())) pending.push(i);
+    }
+    let done = totalChunks - pending.length;
+    let failed = false;
+    chunkProgressBar.value = done;
+
+    async function worker() {
+      while (pending.length && !isPaused && !failed) {
+        const index = pending.shift();
+        if (!(await uploadOneChunk(index))) {
+          failed = true;
           return;
         }
-      } catch (err) {
-        console.error(`Chunk ${currentChunk} gagal diupload:`, err);
-        return;
+        done++;
+        chunkProgressBar.value = done;
       }
-
-      currentChunk++;
-      chunkProgressBar.value = currentChunk;
     }
+    await Promise.all(Array.from({ length: PARALLEL_CHUNKS }, worker));
+    if (failed || isPaused) return;
 
     try {
-      const mergeRes = await fetch("/merge", {
+      const mergeRes = await authFetch("/merge", {
         method: "POST",
-        headers: {
-          "Authorization": "Bearer " + token,
-          "Content-Type": "application/json",
-        },
-        body: JSON.stringify({ uploadId, filename: fileToUpload.name }),
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify({ uploadId }),
       });
 
+      if (mergeRes.status === 409) {
+        // Server menolak merge karena masih ada chunk yang belum diterima
+        const report = await mergeRes.json();
+        alert(`Gagal merge file! Chunk belum lengkap: ${report.missing.join(", ")}. Silakan resume upload.`);
+        return;
+      }
       if (!mergeRes.ok) {
         alert("Gagal merge file!");
         return;